@@ -2,17 +2,24 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/awakari/conditions-number/model"
 	"github.com/awakari/conditions-number/service"
 	"github.com/awakari/conditions-number/storage"
+	"github.com/awakari/conditions-number/unit"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 	"log/slog"
+	"math"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -22,6 +29,8 @@ var log = slog.Default()
 
 func TestMain(m *testing.M) {
 	svc := service.NewService(storage.NewStorageMock())
+	svc = service.NewServiceUnits(svc, unit.NewDefaultRegistry())
+	svc = service.NewServiceValidation(svc)
 	svc = service.NewServiceLogging(svc, log)
 	go func() {
 		err := Serve(svc, port)
@@ -41,20 +50,191 @@ func TestClient_Create(t *testing.T) {
 	client := NewServiceClient(conn)
 	//
 	cases := map[string]struct {
-		key string
-		val float64
-		err error
+		key   string
+		op    Operation
+		val   float64
+		rng   *RangeBounds
+		set   []float64
+		tol   *Tolerance
+		km    KeyMatch
+		terms []*Term
+		unit  string
+		mod   *Modulo
+		per   float64
+		not   bool
+		err   error
 	}{
 		"ok": {
 			key: "key0",
+			op:  Operation_Gte,
 			val: 42,
 		},
+		"ok ne": {
+			key: "key0",
+			op:  Operation_Ne,
+			val: 0,
+		},
+		"ok range": {
+			key: "key0",
+			op:  Operation_Range,
+			rng: &RangeBounds{
+				Min:          10,
+				MinInclusive: true,
+				Max:          20,
+			},
+		},
+		"ok in": {
+			key: "key0",
+			op:  Operation_In,
+			set: []float64{
+				500, 502, 503, 504,
+			},
+		},
+		"ok tolerant eq": {
+			key: "key0",
+			op:  Operation_Eq,
+			val: 0.3,
+			tol: &Tolerance{
+				Abs: 1e-9,
+			},
+		},
+		"ok glob key": {
+			key: "sensor.*.temperature",
+			km:  KeyMatch_Glob,
+			op:  Operation_Gt,
+			val: 50,
+		},
+		"ok cross-attribute": {
+			op: Operation_Lt,
+			terms: []*Term{
+				{
+					Key:  "sale_price",
+					Coef: 1,
+				},
+				{
+					Key:  "list_price",
+					Coef: -1,
+				},
+			},
+		},
+		"ok unit": {
+			key:  "distance",
+			op:   Operation_Lt,
+			val:  5,
+			unit: "km",
+		},
+		"ok bits": {
+			key: "flags",
+			op:  Operation_BitsAllSet,
+			val: 0b101,
+		},
+		"invalid bit mask": {
+			key: "flags",
+			op:  Operation_BitsAnySet,
+			val: 1.5,
+			err: encodeError(storage.InvalidError{Field: "val", Err: fmt.Errorf("%w: 1.5", model.ErrInvalidBitMask)}),
+		},
+		"bits with unit": {
+			key:  "flags",
+			op:   Operation_BitsNoneSet,
+			val:  1,
+			unit: "km",
+			err:  encodeError(fmt.Errorf("%w: bitwise condition can not have a unit", unit.ErrIncompatible)),
+		},
+		"ok mod": {
+			key: "block",
+			op:  Operation_Mod,
+			mod: &Modulo{
+				Div: 1000,
+			},
+		},
+		"zero divisor": {
+			key: "block",
+			op:  Operation_Mod,
+			mod: &Modulo{},
+			err: encodeError(storage.InvalidError{Field: "mod", Err: fmt.Errorf("%w: zero divisor", model.ErrInvalidMod)}),
+		},
+		"ok cyclic range": {
+			key: "hour",
+			op:  Operation_CyclicRange,
+			rng: &RangeBounds{
+				Min:          22,
+				MinInclusive: true,
+				Max:          6,
+			},
+			per: 24,
+		},
+		"zero period": {
+			key: "hour",
+			op:  Operation_CyclicRange,
+			rng: &RangeBounds{
+				Min: 22,
+				Max: 6,
+			},
+			err: encodeError(storage.InvalidError{Field: "period", Err: fmt.Errorf("%w: 0", model.ErrInvalidPeriod)}),
+		},
+		"ok not": {
+			key: "status_code",
+			op:  Operation_In,
+			set: []float64{
+				200, 204,
+			},
+			not: true,
+		},
+		"not stateful": {
+			key: "cpu",
+			op:  Operation_CrossAbove,
+			val: 90,
+			not: true,
+			err: encodeError(storage.InvalidError{Field: "not", Err: fmt.Errorf("%w: CrossAbove", model.ErrInvalidNot)}),
+		},
+		"unknown unit": {
+			key:  "distance",
+			op:   Operation_Lt,
+			val:  5,
+			unit: "parsec",
+			err:  encodeError(fmt.Errorf("%w: parsec", unit.ErrUnknown)),
+		},
+		"undefined op": {
+			key: "key0",
+			err: encodeError(storage.InvalidError{Field: "op", Err: errors.New("undefined operation 0")}),
+		},
+		"nan": {
+			key: "key0",
+			op:  Operation_Gt,
+			val: math.NaN(),
+			err: encodeError(storage.InvalidError{Field: "val", Err: errors.New("value NaN should be a finite number")}),
+		},
+		"infinite set value": {
+			key: "key0",
+			op:  Operation_In,
+			set: []float64{
+				1, math.Inf(-1),
+			},
+			err: encodeError(storage.InvalidError{Field: "vals", Err: errors.New("value -Inf should be a finite number")}),
+		},
+		"long key": {
+			key: strings.Repeat("k", 257),
+			op:  Operation_Gt,
+			err: encodeError(storage.InvalidError{Field: "key", Err: errors.New("length 257 exceeds the limit 256")}),
+		},
+		"empty term key": {
+			op: Operation_Lt,
+			terms: []*Term{
+				{
+					Coef: 1,
+				},
+			},
+			err: encodeError(storage.InvalidError{Field: "terms", Err: errors.New("key should not be empty")}),
+		},
 		"fail": {
 			key: "fail",
+			op:  Operation_Gt,
 			err: status.Error(codes.Internal, "internal failure"),
 		},
 		"conflict": {
 			key: "conflict",
+			op:  Operation_Gt,
 			err: status.Error(codes.AlreadyExists, "already exists"),
 		},
 	}
@@ -63,9 +243,19 @@ func TestClient_Create(t *testing.T) {
 		t.Run(k, func(t *testing.T) {
 			var resp *CreateResponse
 			resp, err = client.Create(context.TODO(), &CreateRequest{
-				Key: c.key,
-				Op:  Operation_Gte,
-				Val: c.val,
+				InterestId: "interest1",
+				Key:        c.key,
+				Op:         c.op,
+				Val:        c.val,
+				Range:      c.rng,
+				Vals:       c.set,
+				Tolerance:  c.tol,
+				KeyMatch:   c.km,
+				Terms:      c.terms,
+				Unit:       c.unit,
+				Mod:        c.mod,
+				Period:     c.per,
+				Not:        c.not,
 			})
 			if c.err == nil {
 				assert.NotEmpty(t, resp.Id)
@@ -75,6 +265,118 @@ func TestClient_Create(t *testing.T) {
 	}
 }
 
+func TestClient_CreateExpr(t *testing.T) {
+	//
+	addr := fmt.Sprintf("localhost:%d", port)
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.Nil(t, err)
+	client := NewServiceClient(conn)
+	//
+	cases := map[string]struct {
+		expr  string
+		code  codes.Code
+		field string
+		desc  string
+	}{
+		"ok": {
+			expr: "price >= 10.5",
+		},
+		"ok without key": {
+			expr: "in [10, 20)",
+		},
+		"ok relative": {
+			expr: "published >= now - 24 h",
+		},
+		"ok decimal": {
+			expr: "price <= dec 19.99",
+		},
+		"ok int": {
+			expr: "id = int 9007199254740993",
+		},
+		"ok crossing": {
+			expr: "cpu crosses above 90 hysteresis 5",
+		},
+		"ok change": {
+			expr: "price changes down by 10%",
+		},
+		"ok anomaly": {
+			expr: "latency deviates by 3 sigma",
+		},
+		"ok bits": {
+			expr: "flags has any bits 0x6",
+		},
+		"ok mod": {
+			expr: "id % 2 == 0",
+		},
+		"ok cyclic range": {
+			expr: "time_of_day in [22, 6) cycle 24 h",
+		},
+		"ok not": {
+			expr: "not x > 5",
+		},
+		"ok window": {
+			expr: "count(amount > 0) over 1h > 100",
+		},
+		"change rel with offset": {
+			expr:  "t changes by 10% °C",
+			code:  codes.InvalidArgument,
+			field: "unit",
+			desc:  "incompatible unit dimensions: relative change condition unit should have no offset",
+		},
+		"relative not time": {
+			expr:  "published >= now - 24 km",
+			code:  codes.InvalidArgument,
+			field: "unit",
+			desc:  "incompatible unit dimensions: relative-time condition unit should be of time dimension",
+		},
+		"invalid": {
+			expr:  "price >> 10",
+			code:  codes.InvalidArgument,
+			field: "expr",
+			desc:  "invalid condition expression at position 7: expected number",
+		},
+		"nan": {
+			expr:  "x > NaN",
+			code:  codes.InvalidArgument,
+			field: "expr",
+			desc:  "invalid condition expression at position 4: invalid number \"NaN\"",
+		},
+		"empty key pattern": {
+			expr:  "** > 1",
+			code:  codes.InvalidArgument,
+			field: "key",
+			desc:  "key pattern should not be empty",
+		},
+		"fail": {
+			expr: "fail < 0",
+			code: codes.Internal,
+		},
+	}
+	//
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			var resp *CreateResponse
+			resp, err = client.CreateExpr(context.TODO(), &CreateExprRequest{
+				Expr:       c.expr,
+				InterestId: "interest1",
+			})
+			assert.Equal(t, c.code, status.Code(err))
+			if c.code == codes.OK {
+				assert.NotEmpty(t, resp.Id)
+			}
+			if c.field != "" {
+				details := status.Convert(err).Details()
+				require.Len(t, details, 1)
+				br, ok := details[0].(*errdetails.BadRequest)
+				require.True(t, ok)
+				require.Len(t, br.FieldViolations, 1)
+				assert.Equal(t, c.field, br.FieldViolations[0].Field)
+				assert.Equal(t, c.desc, br.FieldViolations[0].Description)
+			}
+		})
+	}
+}
+
 func TestClient_LockCreate(t *testing.T) {
 	//
 	addr := fmt.Sprintf("localhost:%d", port)
@@ -93,6 +395,9 @@ func TestClient_LockCreate(t *testing.T) {
 			id:  "missing",
 			err: status.Error(codes.NotFound, "not found"),
 		},
+		"empty id": {
+			err: encodeError(storage.InvalidError{Field: "id", Err: errors.New("should not be empty")}),
+		},
 	}
 	//
 	for k, c := range cases {
@@ -154,7 +459,8 @@ func TestClient_Delete(t *testing.T) {
 	for k, c := range cases {
 		t.Run(k, func(t *testing.T) {
 			_, err = client.Delete(context.TODO(), &DeleteRequest{
-				Id: c.id,
+				InterestId: "interest1",
+				Id:         c.id,
 			})
 			assert.ErrorIs(t, err, c.err)
 		})
@@ -171,12 +477,16 @@ func TestClient_SearchPage(t *testing.T) {
 	cases := map[string]struct {
 		key   string
 		val   float64
+		unit  string
+		dec   string
+		int   *int64
 		limit uint32
 		ids   []string
+		stats *Stats
 		err   error
 	}{
 		"ok": {
-			key:   "",
+			key:   "x",
 			val:   42,
 			limit: 3,
 			ids: []string{
@@ -185,6 +495,71 @@ func TestClient_SearchPage(t *testing.T) {
 				"cond2",
 			},
 		},
+		"ok unit": {
+			key:   "size",
+			val:   42,
+			unit:  "MiB",
+			limit: 1,
+			ids: []string{
+				"cond0",
+			},
+		},
+		"ok decimal": {
+			key:   "price",
+			dec:   "19.99",
+			limit: 1,
+			ids: []string{
+				"cond0",
+			},
+		},
+		"ok int": {
+			key:   "id",
+			int:   proto.Int64(9007199254740993),
+			limit: 1,
+			ids: []string{
+				"cond0",
+			},
+		},
+		"ok stats": {
+			key:   "latency",
+			val:   5,
+			limit: 1,
+			ids: []string{
+				"cond0",
+			},
+			stats: &Stats{
+				Count:  2,
+				Mean:   2,
+				StdDev: math.Sqrt2,
+				ZScore: proto.Float64(3 / math.Sqrt2),
+			},
+		},
+		"ok tolerance": {
+			key:   "tolerance",
+			val:   0.1 + 0.2,
+			limit: 3,
+			ids: []string{
+				"cond0",
+			},
+		},
+		"tolerance exceeded": {
+			key:   "tolerance",
+			val:   0.31,
+			limit: 3,
+		},
+		"invalid decimal": {
+			key:   "price",
+			dec:   "19,99",
+			limit: 1,
+			err:   encodeError(fmt.Errorf("%w: %q", model.ErrInvalidDecimal, "19,99")),
+		},
+		"unknown unit": {
+			key:   "size",
+			val:   42,
+			unit:  "parsec",
+			limit: 1,
+			err:   encodeError(fmt.Errorf("%w: parsec", unit.ErrUnknown)),
+		},
 		"fail": {
 			key:   "fail",
 			val:   42,
@@ -199,11 +574,63 @@ func TestClient_SearchPage(t *testing.T) {
 			resp, err = client.SearchPage(context.TODO(), &SearchPageRequest{
 				Key:   c.key,
 				Val:   c.val,
+				Unit:  c.unit,
+				Dec:   c.dec,
+				Int:   c.int,
 				Limit: c.limit,
 			})
 			assert.ErrorIs(t, err, c.err)
 			if c.err == nil {
 				assert.Equal(t, len(c.ids), len(resp.Ids))
+				assert.True(t, proto.Equal(c.stats, resp.Stats), resp.Stats.String())
+			}
+		})
+	}
+}
+
+func TestClient_SearchMultiPage(t *testing.T) {
+	//
+	addr := fmt.Sprintf("localhost:%d", port)
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.Nil(t, err)
+	client := NewServiceClient(conn)
+	//
+	cases := map[string]struct {
+		attrs map[string]float64
+		limit uint32
+		ids   []string
+		err   error
+	}{
+		"ok": {
+			attrs: map[string]float64{
+				"sale_price": 90,
+				"list_price": 100,
+			},
+			limit: 2,
+			ids: []string{
+				"cond0",
+				"cond1",
+			},
+		},
+		"fail": {
+			attrs: map[string]float64{
+				"fail": 0,
+			},
+			limit: 2,
+			err:   status.Error(codes.Internal, "internal failure"),
+		},
+	}
+	//
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			var resp *SearchPageResponse
+			resp, err = client.SearchMultiPage(context.TODO(), &SearchMultiPageRequest{
+				Attrs: c.attrs,
+				Limit: c.limit,
+			})
+			assert.ErrorIs(t, err, c.err)
+			if c.err == nil {
+				assert.Equal(t, c.ids, resp.Ids)
 			}
 		})
 	}
@@ -6,6 +6,8 @@ import (
 	"github.com/awakari/conditions-number/model"
 	"github.com/awakari/conditions-number/service"
 	"github.com/awakari/conditions-number/storage"
+	"github.com/awakari/conditions-number/unit"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -22,22 +24,79 @@ func NewController(svc service.Service) ServiceServer {
 
 func (c controller) Create(ctx context.Context, req *CreateRequest) (resp *CreateResponse, err error) {
 	resp = &CreateResponse{}
-	var op model.Op
-	switch req.Op {
-	case Operation_Gt:
-		op = model.OpGt
-	case Operation_Gte:
-		op = model.OpGte
-	case Operation_Eq:
-		op = model.OpEq
-	case Operation_Lte:
-		op = model.OpLte
-	case Operation_Lt:
-		op = model.OpLt
-	default:
-		op = model.OpUndefined
+	cond := model.Condition{
+		Key:        req.Key,
+		KeyMatch:   decodeKeyMatch(req.KeyMatch),
+		Op:         decodeOp(req.Op),
+		Val:        req.Val,
+		Vals:       req.Vals,
+		Unit:       req.Unit,
+		Relative:   req.Relative,
+		Int:        req.Int,
+		Hysteresis: req.Hysteresis,
+		Period:     req.Period,
+		Not:        req.Not,
+	}
+	if req.Dec != "" {
+		cond.Dec, err = model.ParseDecimal(req.Dec)
+	}
+	if req.Range != nil {
+		cond.Range = model.Range{
+			Min:          req.Range.Min,
+			MinInclusive: req.Range.MinInclusive,
+			Max:          req.Range.Max,
+			MaxInclusive: req.Range.MaxInclusive,
+		}
+	}
+	for _, t := range req.Terms {
+		cond.Terms = append(cond.Terms, model.Term{
+			Key:  t.Key,
+			Coef: t.Coef,
+		})
+	}
+	if req.Tolerance != nil {
+		cond.Tolerance = model.Tolerance{
+			Abs: req.Tolerance.Abs,
+			Rel: req.Tolerance.Rel,
+		}
+	}
+	if req.Change != nil {
+		cond.Change = model.Change{
+			Dir: decodeChangeDir(req.Change.Dir),
+			Rel: req.Change.Rel,
+		}
+	}
+	if req.Mod != nil {
+		cond.Mod = model.Mod{
+			Div: req.Mod.Div,
+			Rem: req.Mod.Rem,
+		}
+	}
+	if req.Window != nil {
+		cond.Window = model.Window{
+			Agg:      decodeAgg(req.Window.Agg),
+			Dur:      req.Window.Dur.AsDuration(),
+			Tumbling: req.Window.Tumbling,
+			Filter: model.WindowFilter{
+				Op:  decodeOp(req.Window.FilterOp),
+				Val: req.Window.FilterVal,
+			},
+		}
+	}
+	if err == nil {
+		resp.Id, err = c.svc.Create(ctx, req.InterestId, cond)
+	}
+	err = encodeError(err)
+	return
+}
+
+func (c controller) CreateExpr(ctx context.Context, req *CreateExprRequest) (resp *CreateResponse, err error) {
+	resp = &CreateResponse{}
+	var cond model.Condition
+	cond, err = model.ParseCondition(req.Expr)
+	if err == nil {
+		resp.Id, err = c.svc.Create(ctx, req.InterestId, cond)
 	}
-	resp.Id, err = c.svc.Create(ctx, req.InterestId, req.Key, op, req.Val)
 	err = encodeError(err)
 	return
 }
@@ -65,15 +124,154 @@ func (c controller) Delete(ctx context.Context, req *DeleteRequest) (resp *Delet
 
 func (c controller) SearchPage(ctx context.Context, req *SearchPageRequest) (resp *SearchPageResponse, err error) {
 	resp = &SearchPageResponse{}
-	resp.Ids, err = c.svc.SearchPage(ctx, req.Key, req.Val, req.Limit, req.Cursor)
+	attr := model.Attr{
+		Key:    req.Key,
+		Val:    req.Val,
+		Unit:   req.Unit,
+		Int:    req.Int,
+		Entity: req.Entity,
+	}
+	if req.Dec != "" {
+		attr.Dec, err = model.ParseDecimal(req.Dec)
+	}
+	var stats model.Stats
+	if err == nil {
+		resp.Ids, stats, err = c.svc.SearchPage(ctx, attr, req.Limit, req.Cursor)
+	}
+	if err == nil && stats.Count > 0 {
+		resp.Stats = encodeStats(stats, attr.Float64())
+	}
+	err = encodeError(err)
+	return
+}
+
+func (c controller) SearchMultiPage(ctx context.Context, req *SearchMultiPageRequest) (resp *SearchPageResponse, err error) {
+	resp = &SearchPageResponse{}
+	resp.Ids, err = c.svc.SearchMultiPage(ctx, req.Attrs, req.Limit, req.Cursor)
 	err = encodeError(err)
 	return
 }
 
+func decodeOp(src Operation) (dst model.Op) {
+	switch src {
+	case Operation_Gt:
+		dst = model.OpGt
+	case Operation_Gte:
+		dst = model.OpGte
+	case Operation_Eq:
+		dst = model.OpEq
+	case Operation_Lte:
+		dst = model.OpLte
+	case Operation_Lt:
+		dst = model.OpLt
+	case Operation_Ne:
+		dst = model.OpNe
+	case Operation_Range:
+		dst = model.OpRange
+	case Operation_In:
+		dst = model.OpIn
+	case Operation_NotIn:
+		dst = model.OpNotIn
+	case Operation_CrossAbove:
+		dst = model.OpCrossAbove
+	case Operation_CrossBelow:
+		dst = model.OpCrossBelow
+	case Operation_Change:
+		dst = model.OpChange
+	case Operation_Anomaly:
+		dst = model.OpAnomaly
+	case Operation_BitsAllSet:
+		dst = model.OpBitsAllSet
+	case Operation_BitsAnySet:
+		dst = model.OpBitsAnySet
+	case Operation_BitsNoneSet:
+		dst = model.OpBitsNoneSet
+	case Operation_Mod:
+		dst = model.OpMod
+	case Operation_CyclicRange:
+		dst = model.OpCyclicRange
+	default:
+		dst = model.OpUndefined
+	}
+	return
+}
+
+func decodeChangeDir(src ChangeDir) (dst model.ChangeDir) {
+	switch src {
+	case ChangeDir_Up:
+		dst = model.ChangeUp
+	case ChangeDir_Down:
+		dst = model.ChangeDown
+	default:
+		dst = model.ChangeAny
+	}
+	return
+}
+
+func decodeAgg(src Aggregate) (dst model.Agg) {
+	switch src {
+	case Aggregate_Count:
+		dst = model.AggCount
+	case Aggregate_Sum:
+		dst = model.AggSum
+	case Aggregate_Avg:
+		dst = model.AggAvg
+	case Aggregate_Min:
+		dst = model.AggMin
+	case Aggregate_Max:
+		dst = model.AggMax
+	default:
+		dst = model.AggUndefined
+	}
+	return
+}
+
+func encodeStats(src model.Stats, val float64) (dst *Stats) {
+	dst = &Stats{
+		Count:  src.Count,
+		Mean:   src.Mean,
+		StdDev: src.StdDev(),
+	}
+	if z, ok := src.ZScore(val); ok {
+		dst.ZScore = &z
+	}
+	return
+}
+
+func decodeKeyMatch(src KeyMatch) (dst model.KeyMatch) {
+	switch src {
+	case KeyMatch_Prefix:
+		dst = model.KeyMatchPrefix
+	case KeyMatch_Glob:
+		dst = model.KeyMatchGlob
+	default:
+		dst = model.KeyMatchExact
+	}
+	return
+}
+
 func encodeError(src error) (dst error) {
+	var errParse model.ParseError
+	var errInvalid storage.InvalidError
 	switch {
 	case src == nil:
 		dst = nil
+	case errors.As(src, &errParse):
+		dst = encodeInvalidArgument(src, "expr", errParse.Error())
+	case errors.As(src, &errInvalid):
+		dst = encodeInvalidArgument(src, errInvalid.Field, errInvalid.Err.Error())
+	case errors.Is(src, model.ErrInvalidDecimal):
+		dst = encodeInvalidArgument(src, "dec", src.Error())
+	case errors.Is(src, model.ErrInvalidBitMask):
+		dst = encodeInvalidArgument(src, "val", src.Error())
+	case errors.Is(src, model.ErrInvalidMod):
+		dst = encodeInvalidArgument(src, "mod", src.Error())
+	case errors.Is(src, model.ErrInvalidPeriod):
+		dst = encodeInvalidArgument(src, "period", src.Error())
+	case errors.Is(src, model.ErrInvalidNot):
+		dst = encodeInvalidArgument(src, "not", src.Error())
+	case errors.Is(src, unit.ErrUnknown), errors.Is(src, unit.ErrIncompatible):
+		dst = encodeInvalidArgument(src, "unit", src.Error())
 	case errors.Is(src, storage.ErrInternal):
 		dst = status.Error(codes.Internal, src.Error())
 	case errors.Is(src, storage.ErrConflict):
@@ -85,3 +283,21 @@ func encodeError(src error) (dst error) {
 	}
 	return
 }
+
+func encodeInvalidArgument(src error, field, desc string) (dst error) {
+	st := status.New(codes.InvalidArgument, src.Error())
+	details := &errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{
+				Field:       field,
+				Description: desc,
+			},
+		},
+	}
+	stWithDetails, err := st.WithDetails(details)
+	if err == nil {
+		st = stWithDetails
+	}
+	dst = st.Err()
+	return
+}
@@ -10,13 +10,27 @@ type Config struct {
 		Port uint16 `envconfig:"API_PORT" default:"50051" required:"true"`
 	}
 	Db  DbConfig
+	Key struct {
+		// Norm defines the normalization applied to the condition and the attribute keys.
+		Norm struct {
+			Trim bool   `envconfig:"KEY_NORM_TRIM" default:"false"`
+			Fold bool   `envconfig:"KEY_NORM_FOLD" default:"false"`
+			Nfc  bool   `envconfig:"KEY_NORM_NFC" default:"false"`
+			Sep  string `envconfig:"KEY_NORM_SEP" default:""`
+			// Migrate normalizes the keys of the already stored conditions on start, supported by the mongo db only.
+			Migrate bool `envconfig:"KEY_NORM_MIGRATE" default:"false"`
+		}
+	}
 	Log struct {
 		Level int `envconfig:"LOG_LEVEL" default:"-4" required:"true"`
 	}
 }
 
 type DbConfig struct {
-	Type     string `envconfig:"DB_TYPE" default:"mongo" required:"true"`
+	// Type is either "mongo", "sqlite" or "memory", the latter keeps the conditions in the process memory only.
+	Type string `envconfig:"DB_TYPE" default:"mongo" required:"true"`
+	// Path is the database file path used by the sqlite type.
+	Path     string `envconfig:"DB_PATH" default:"conditions-number.sqlite"`
 	Uri      string `envconfig:"DB_URI" default:"mongodb://localhost:27017/?retryWrites=true&w=majority"`
 	Host     string `envconfig:"DB_HOST" default:"127.0.0.1"`
 	Port     uint16 `envconfig:"DB_PORT" default:"5433"`
@@ -29,6 +43,15 @@ type DbConfig struct {
 			Create time.Duration `envconfig:"DB_TABLE_LOCK_TTL_CREATE" default:"1000s"`
 		}
 		Shard bool `envconfig:"DB_TABLE_SHARD" default:"true"`
+		State struct {
+			// Memory keeps the stateful conditions state in memory instead of the database, it's not shared between
+			// the replicas then. The sqlite type always keeps the state in memory, it's lost on restart.
+			Memory bool `envconfig:"DB_TABLE_STATE_MEMORY" default:"false"`
+			// Limit is the count of the in-memory state entries, the least recently used ones are evicted.
+			Limit int `envconfig:"DB_TABLE_STATE_LIMIT" default:"1000000"`
+			// Ttl is the time the database state entry not updated for expires after, zero means never.
+			Ttl time.Duration `envconfig:"DB_TABLE_STATE_TTL" default:"720h"`
+		}
 	}
 	Tls struct {
 		Enabled  bool `envconfig:"DB_TLS_ENABLED" default:"false" required:"true"`
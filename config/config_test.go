@@ -12,12 +12,22 @@ func TestConfig(t *testing.T) {
 	os.Setenv("API_PORT", "55555")
 	os.Setenv("LOG_LEVEL", "8")
 	os.Setenv("DB_TABLE_LOCK_TTL_CREATE", "12m")
+	os.Setenv("KEY_NORM_FOLD", "true")
+	os.Setenv("KEY_NORM_SEP", "_")
 	cfg, err := NewConfigFromEnv()
 	assert.Nil(t, err)
 	assert.Equal(t, uint16(55555), cfg.Api.Port)
 	assert.Equal(t, "mongodb://localhost:27017/?retryWrites=true&w=majority", cfg.Db.Uri)
 	assert.Equal(t, "conditions-number", cfg.Db.Name)
+	assert.Equal(t, "conditions-number.sqlite", cfg.Db.Path)
 	assert.Equal(t, "conditions-number", cfg.Db.Table.Name)
 	assert.Equal(t, int(slog.LevelError), cfg.Log.Level)
 	assert.Equal(t, 12*time.Minute, cfg.Db.Table.LockTtl.Create)
+	assert.False(t, cfg.Db.Table.State.Memory)
+	assert.Equal(t, 1_000_000, cfg.Db.Table.State.Limit)
+	assert.Equal(t, 720*time.Hour, cfg.Db.Table.State.Ttl)
+	assert.False(t, cfg.Key.Norm.Trim)
+	assert.True(t, cfg.Key.Norm.Fold)
+	assert.Equal(t, "_", cfg.Key.Norm.Sep)
+	assert.False(t, cfg.Key.Norm.Migrate)
 }
@@ -5,11 +5,16 @@ import (
 	"fmt"
 	apiGrpc "github.com/awakari/conditions-number/api/grpc"
 	"github.com/awakari/conditions-number/config"
+	"github.com/awakari/conditions-number/model"
 	"github.com/awakari/conditions-number/service"
 	"github.com/awakari/conditions-number/storage"
+	"github.com/awakari/conditions-number/storage/memory"
 	"github.com/awakari/conditions-number/storage/mongo"
+	"github.com/awakari/conditions-number/storage/sqlite"
+	"github.com/awakari/conditions-number/unit"
 	"log/slog"
 	"os"
+	"time"
 )
 
 func main() {
@@ -27,7 +32,11 @@ func main() {
 	var stor storage.Storage
 	switch cfg.Db.Type {
 	case "mongo":
-		stor, err = mongo.NewStorage(context.TODO(), cfg.Db)
+		stor, err = mongo.NewStorage(context.TODO(), cfg.Db, time.Now)
+	case "sqlite":
+		stor, err = sqlite.NewStorage(context.TODO(), cfg.Db, time.Now)
+	case "memory":
+		stor = memory.NewStorage(cfg.Db, time.Now)
 	default:
 		panic("unknown db type")
 	}
@@ -35,7 +44,32 @@ func main() {
 		panic(err)
 	}
 	//
+	keyNorm := model.KeyNorm{
+		Trim: cfg.Key.Norm.Trim,
+		Fold: cfg.Key.Norm.Fold,
+		Nfc:  cfg.Key.Norm.Nfc,
+		Sep:  cfg.Key.Norm.Sep,
+	}
+	if cfg.Key.Norm.Migrate {
+		km, ok := stor.(storage.KeyMigration)
+		if !ok {
+			panic(fmt.Sprintf("db type %s doesn't support the key migration", cfg.Db.Type))
+		}
+		log.Info("normalizing the stored condition keys...")
+		updated, conflicts, errMigrate := km.NormalizeKeys(context.TODO(), keyNorm)
+		if errMigrate != nil {
+			panic(errMigrate)
+		}
+		log.Info(fmt.Sprintf("normalized the stored condition keys, updated: %d, conflicts: %d", updated, len(conflicts)))
+		if len(conflicts) > 0 {
+			log.Warn(fmt.Sprintf("conditions left with the not normalized keys never match, recreate them: %v", conflicts))
+		}
+	}
+	//
 	svc := service.NewService(stor)
+	svc = service.NewServiceUnits(svc, unit.NewDefaultRegistry())
+	svc = service.NewServiceValidation(svc)
+	svc = service.NewServiceKeys(svc, keyNorm)
 	svc = service.NewServiceLogging(svc, log)
 	//
 	log.Info("connected, starting to listen for incoming requests...")
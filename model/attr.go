@@ -0,0 +1,67 @@
+package model
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Attr is the event attribute to search the matching conditions for.
+type Attr struct {
+	Key string
+	Val float64
+	// Dec is the exact decimal value used instead of Val when set.
+	Dec Decimal
+	// Int is the exact 64-bit integer value used instead of Val when set.
+	Int *int64
+	// Unit is optional, the attribute matches only the conditions having the same unit.
+	Unit string
+	// Entity is optional, it identifies the thing the value belongs to, e.g. the host or the product id.
+	// The stateful conditions keep the state per attribute key and entity.
+	Entity string
+}
+
+func (a Attr) isExact() bool {
+	return a.Dec != "" || a.Int != nil
+}
+
+// exactVal returns the exact attribute value, nil when it's not a number.
+func (a Attr) exactVal() (v *big.Rat) {
+	return exactVal(a.Dec, a.Int, a.Val)
+}
+
+// Float64 returns the attribute value as float64 even if it's the exact one.
+func (a Attr) Float64() (v float64) {
+	v = a.Val
+	switch {
+	case a.Dec != "":
+		v = a.Dec.Float64()
+	case a.Int != nil:
+		v = float64(*a.Int)
+	}
+	return
+}
+
+// String returns the attribute like "price = dec 19.99 USD" in the same notation as the condition expression has.
+func (a Attr) String() string {
+	var sb strings.Builder
+	sb.WriteString(formatKey(a.Key))
+	sb.WriteString(" = ")
+	switch {
+	case a.Dec != "":
+		sb.WriteString(exprKeywordDec)
+		sb.WriteByte(' ')
+		sb.WriteString(string(a.Dec))
+	case a.Int != nil:
+		sb.WriteString(exprKeywordInt)
+		sb.WriteByte(' ')
+		sb.WriteString(strconv.FormatInt(*a.Int, 10))
+	default:
+		sb.WriteString(formatNum(a.Val))
+	}
+	if a.Unit != "" {
+		sb.WriteByte(' ')
+		sb.WriteString(formatKey(a.Unit))
+	}
+	return sb.String()
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAttr_String(t *testing.T) {
+	cases := map[string]struct {
+		attr Attr
+		str  string
+	}{
+		"float": {
+			attr: Attr{
+				Key: "price",
+				Val: 1.5,
+			},
+			str: "price = 1.5",
+		},
+		"decimal with unit": {
+			attr: Attr{
+				Key:  "price",
+				Dec:  "19.99",
+				Unit: "USD",
+			},
+			str: "price = dec 19.99 USD",
+		},
+		"int": {
+			attr: Attr{
+				Key: "key with spaces",
+				Int: ptr(int64(9007199254740993)),
+			},
+			str: `"key with spaces" = int 9007199254740993`,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.str, c.attr.String())
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+var ErrInvalidBitMask = errors.New("bit mask should be a non-negative integer")
+
+// BitMask returns the bit mask of the bitwise condition, it's either Int or the integer Val.
+func (c Condition) BitMask() (mask int64, err error) {
+	var ok bool
+	switch {
+	case c.Int != nil:
+		mask, ok = *c.Int, *c.Int >= 0
+	case c.Dec != "":
+		mask, ok = ratInt(c.Dec.Rat())
+	default:
+		mask, ok = floatInt(c.Val)
+	}
+	if ok && mask < 0 {
+		ok = false
+	}
+	if !ok {
+		mask = 0
+		err = fmt.Errorf("%w: %s", ErrInvalidBitMask, c.formatScalar())
+	}
+	return
+}
+
+// Bits returns the attribute value as the set of bits, ok is false when the value is not a non-negative integer.
+func (a Attr) Bits() (bits int64, ok bool) {
+	bits, ok = a.Integer()
+	if ok && bits < 0 {
+		bits, ok = 0, false
+	}
+	return
+}
+
+// Integer returns the attribute value as the integer, ok is false when the value is not an integer fitting 64 bits.
+func (a Attr) Integer() (i int64, ok bool) {
+	switch {
+	case a.Int != nil:
+		i, ok = *a.Int, true
+	case a.Dec != "":
+		i, ok = ratInt(a.Dec.Rat())
+	default:
+		i, ok = floatInt(a.Val)
+	}
+	if !ok {
+		i = 0
+	}
+	return
+}
+
+func (c Condition) matchesBits(bits int64) (matches bool) {
+	mask, err := c.BitMask()
+	if err == nil {
+		switch c.Op {
+		case OpBitsAllSet:
+			matches = bits&mask == mask
+		case OpBitsAnySet:
+			matches = bits&mask != 0
+		case OpBitsNoneSet:
+			matches = bits&mask == 0
+		}
+	}
+	return
+}
+
+func floatInt(v float64) (i int64, ok bool) {
+	ok = v >= math.MinInt64 && v < math.MaxInt64 && v == math.Trunc(v)
+	if ok {
+		i = int64(v)
+	}
+	return
+}
+
+func ratInt(v *big.Rat) (i int64, ok bool) {
+	ok = v != nil && v.IsInt() && v.Num().IsInt64()
+	if ok {
+		i = v.Num().Int64()
+	}
+	return
+}
@@ -0,0 +1,153 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCondition_BitMask(t *testing.T) {
+	cases := map[string]struct {
+		cond Condition
+		mask int64
+		err  error
+	}{
+		"int": {
+			cond: Condition{
+				Op:  OpBitsAllSet,
+				Int: ptr(int64(0x5)),
+			},
+			mask: 0x5,
+		},
+		"val": {
+			cond: Condition{
+				Op:  OpBitsAllSet,
+				Val: 6,
+			},
+			mask: 6,
+		},
+		"negative int": {
+			cond: Condition{
+				Op:  OpBitsAnySet,
+				Int: ptr(int64(-1)),
+			},
+			err: ErrInvalidBitMask,
+		},
+		"fraction": {
+			cond: Condition{
+				Op:  OpBitsAnySet,
+				Val: 1.5,
+			},
+			err: ErrInvalidBitMask,
+		},
+		"too big": {
+			cond: Condition{
+				Op:  OpBitsAnySet,
+				Val: 1e19,
+			},
+			err: ErrInvalidBitMask,
+		},
+		"decimal": {
+			cond: Condition{
+				Op:  OpBitsNoneSet,
+				Dec: "12",
+			},
+			mask: 12,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			mask, err := c.cond.BitMask()
+			assert.ErrorIs(t, err, c.err)
+			assert.Equal(t, c.mask, mask)
+		})
+	}
+}
+
+func TestCondition_MatchesAttr_Bits(t *testing.T) {
+	cases := map[string]struct {
+		cond    Condition
+		attr    Attr
+		matches bool
+	}{
+		"all set": {
+			cond: Condition{
+				Op:  OpBitsAllSet,
+				Int: ptr(int64(0b101)),
+			},
+			attr: Attr{
+				Int: ptr(int64(0b1101)),
+			},
+			matches: true,
+		},
+		"all set missing bit": {
+			cond: Condition{
+				Op:  OpBitsAllSet,
+				Int: ptr(int64(0b101)),
+			},
+			attr: Attr{
+				Val: 0b1001,
+			},
+		},
+		"any set": {
+			cond: Condition{
+				Op:  OpBitsAnySet,
+				Val: 0b110,
+			},
+			attr: Attr{
+				Val: 0b100,
+			},
+			matches: true,
+		},
+		"any set none": {
+			cond: Condition{
+				Op:  OpBitsAnySet,
+				Val: 0b110,
+			},
+			attr: Attr{
+				Dec: "1",
+			},
+		},
+		"none set": {
+			cond: Condition{
+				Op:  OpBitsNoneSet,
+				Int: ptr(int64(0b110)),
+			},
+			attr: Attr{
+				Val: 0b1001,
+			},
+			matches: true,
+		},
+		"none set but one": {
+			cond: Condition{
+				Op:  OpBitsNoneSet,
+				Int: ptr(int64(0b110)),
+			},
+			attr: Attr{
+				Val: 0b11,
+			},
+		},
+		"not integer value": {
+			cond: Condition{
+				Op:  OpBitsNoneSet,
+				Int: ptr(int64(0b110)),
+			},
+			attr: Attr{
+				Val: 1.5,
+			},
+		},
+		"negative value": {
+			cond: Condition{
+				Op:  OpBitsNoneSet,
+				Int: ptr(int64(0b110)),
+			},
+			attr: Attr{
+				Int: ptr(int64(-8)),
+			},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.matches, c.cond.MatchesAttr(c.attr))
+		})
+	}
+}
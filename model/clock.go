@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// Clock returns the current time, the relative-time conditions are evaluated against it.
+type Clock func() time.Time
+
+// UnixSeconds returns the Unix time in seconds including the fractional part.
+func UnixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
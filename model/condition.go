@@ -0,0 +1,372 @@
+package model
+
+import (
+	"math"
+	"math/big"
+	"slices"
+	"time"
+)
+
+type Condition struct {
+	Key      string
+	KeyMatch KeyMatch
+	// Terms is used by the cross-attribute conditions only, those compare the sum of the terms with Val.
+	Terms []Term
+	Op    Op
+	Val   float64
+	// Dec is the exact decimal value used instead of Val when set.
+	Dec Decimal
+	// Int is the exact 64-bit integer value used instead of Val when set.
+	Int *int64
+	// Unit is optional, all the condition values are in this unit.
+	Unit string
+	// Relative means all the condition values are the offsets from the current time at the search time.
+	// The attribute value is the Unix time in seconds then, e.g. "published >= now - 86400".
+	Relative bool
+	// Range is used by OpRange and OpCyclicRange only.
+	Range Range
+	// Period is used by OpCyclicRange only, e.g. 24 for the hours or 360 for the angles in degrees.
+	Period float64
+	// Vals is used by OpIn and OpNotIn only.
+	Vals []float64
+	// Tolerance is used by OpEq only.
+	Tolerance Tolerance
+	// Hysteresis is used by OpCrossAbove and OpCrossBelow only: the distance from Val to the re-arm level.
+	Hysteresis float64
+	// Change is used by OpChange only.
+	Change Change
+	// Mod is used by OpMod only.
+	Mod Mod
+	// Window is optional, it makes the comparison condition compare the aggregate of the values within the window.
+	Window Window
+	// Not inverts the stateless condition, e.g. "not x > 5" matches the value of x not greater than 5.
+	Not bool
+}
+
+// Term is the attribute value multiplied by the coefficient.
+type Term struct {
+	Key  string
+	Coef float64
+}
+
+type Range struct {
+	Min          float64
+	MinInclusive bool
+	Max          float64
+	MaxInclusive bool
+}
+
+// Tolerance defines the allowed deviation for the equality: the value matches when |v - Val| <= max(Abs, Rel * |Val|).
+// The zero Tolerance means the exact equality.
+type Tolerance struct {
+	Abs float64
+	Rel float64
+}
+
+// Change defines the change condition: the value changed since the previous one by more than Val in the direction.
+type Change struct {
+	Dir ChangeDir
+	// Rel means Val is the change relative to the previous value, e.g. 0.1 for 10%, otherwise it's the delta.
+	Rel bool
+}
+
+type ChangeDir int
+
+const (
+	// ChangeAny matches both the increase and the decrease.
+	ChangeAny ChangeDir = iota
+	ChangeUp
+	ChangeDown
+)
+
+func (t Tolerance) IsZero() bool {
+	return t.Abs <= 0 && t.Rel <= 0
+}
+
+// Bounds returns the closed interval of values equal to the specified one within the tolerance.
+func (t Tolerance) Bounds(val float64) (min, max float64) {
+	d := math.Max(0, math.Max(t.Abs, t.Rel*math.Abs(val)))
+	min = val - d
+	max = val + d
+	return
+}
+
+// Matches reports whether the specified attribute without a unit satisfies the condition.
+// The semantics is the same as the storage search has: the condition with an empty key matches any attribute key.
+// The cross-attribute condition never matches the single attribute. The crossing condition matches any value beyond
+// the threshold regardless of its state. Neither the change, the anomaly nor the windowed aggregate condition matches
+// as there are no previous values.
+func (c Condition) Matches(key string, val float64) (matches bool) {
+	return c.MatchesAttr(Attr{
+		Key: key,
+		Val: val,
+	})
+}
+
+// MatchesAttr is the same as Matches but also requires the same unit for the attribute and the condition.
+func (c Condition) MatchesAttr(a Attr) (matches bool) {
+	return c.MatchesAttrAt(a, time.Now())
+}
+
+// MatchesAttrAt is the same as MatchesAttr but evaluates the relative-time condition at the specified time.
+func (c Condition) MatchesAttrAt(a Attr, now time.Time) (matches bool) {
+	if len(c.Terms) == 0 && c.Window.IsZero() && c.Unit == a.Unit && c.MatchesKey(a.Key) {
+		matches = c.matchesAttrAt(a, now) != c.Not
+	}
+	return
+}
+
+func (c Condition) matchesAttrAt(a Attr, now time.Time) (matches bool) {
+	switch {
+	case c.Op.IsBitwise():
+		bits, ok := a.Bits()
+		matches = ok && c.matchesBits(bits)
+	case c.Op == OpMod:
+		i, ok := a.Integer()
+		matches = ok && c.Mod.Matches(i)
+	case c.Op == OpCyclicRange:
+		matches = !c.Relative && c.Range.ContainsCyclic(a.Float64(), c.Period)
+	case !c.isExact() && !a.isExact():
+		v := a.Val
+		if c.Relative {
+			v -= UnixSeconds(now)
+		}
+		matches = c.matchesVal(v)
+	default:
+		v := a.exactVal()
+		if v != nil && c.Relative {
+			v.Sub(v, big.NewRat(now.UnixNano(), int64(time.Second)))
+		}
+		matches = c.matchesExact(v)
+	}
+	return
+}
+
+// MatchesAttrs reports whether the cross-attribute condition holds for the specified attributes.
+// Every key referenced by the condition terms should be present, the negated condition matches when any is absent.
+// Only the comparison operations are supported, the relative-time conditions are not.
+// The negated single attribute condition having the exact key matches when the attribute is absent.
+func (c Condition) MatchesAttrs(attrs map[string]float64) (matches bool) {
+	switch {
+	case len(c.Terms) == 0:
+		_, present := attrs[c.Key]
+		matches = c.Not && c.KeyMatch == KeyMatchExact && c.Key != "" && !present
+	case c.Unit != "", c.Relative, !c.Window.IsZero(), !c.Op.IsComparison():
+	default:
+		matches = c.matchesAttrs(attrs) != c.Not
+	}
+	return
+}
+
+func (c Condition) matchesAttrs(attrs map[string]float64) (matches bool) {
+	var sum float64
+	for _, t := range c.Terms {
+		v, present := attrs[t.Key]
+		if !present {
+			return
+		}
+		sum += t.Coef * v
+	}
+	switch {
+	case c.isExact():
+		matches = c.matchesExact(new(big.Rat).SetFloat64(sum))
+	default:
+		matches = c.matchesVal(sum)
+	}
+	return
+}
+
+func (c Condition) matchesVal(val float64) (matches bool) {
+	switch c.Op {
+	case OpGt:
+		matches = val > c.Val
+	case OpGte:
+		matches = val >= c.Val
+	case OpEq:
+		matches = val == c.Val
+		if !matches && !c.Tolerance.IsZero() {
+			min, max := c.Tolerance.Bounds(c.Val)
+			matches = min <= val && val <= max
+		}
+	case OpLte:
+		matches = val <= c.Val
+	case OpLt:
+		matches = val < c.Val
+	case OpNe:
+		matches = val != c.Val
+	case OpRange:
+		matches = c.Range.Contains(val)
+	case OpCyclicRange:
+		matches = c.Range.ContainsCyclic(val, c.Period)
+	case OpIn:
+		matches = slices.Contains(c.Vals, val)
+	case OpNotIn:
+		matches = !slices.Contains(c.Vals, val)
+	case OpCrossAbove:
+		matches = val > c.Val
+	case OpCrossBelow:
+		matches = val < c.Val
+	}
+	return
+}
+
+// Crossing evaluates the threshold crossing condition statelessly. The condition fires when the value is beyond the
+// threshold and the condition is armed, it's disarmed then until the value passes the re-arm level back.
+// E.g. the condition crossing above 90 with the hysteresis 5 fires when the value goes above 90 and re-arms when the
+// value goes below 85. The new condition is armed.
+func (c Condition) Crossing(val float64) (beyond, rearms bool) {
+	switch c.Op {
+	case OpCrossAbove:
+		beyond = val > c.Val
+		rearms = val < c.Val-c.Hysteresis
+	case OpCrossBelow:
+		beyond = val < c.Val
+		rearms = val > c.Val+c.Hysteresis
+	}
+	return
+}
+
+// Changed evaluates the change condition for the value following the previous one of the same attribute key and
+// entity. E.g. the condition "changes down by 10%" holds for the value 89 following 100.
+func (c Condition) Changed(prev, val float64) (changed bool) {
+	d := val - prev
+	if c.Change.Rel {
+		d = RelChange(prev, val)
+	}
+	switch c.Change.Dir {
+	case ChangeUp:
+		changed = d > c.Val
+	case ChangeDown:
+		changed = -d > c.Val
+	default:
+		changed = math.Abs(d) > c.Val
+	}
+	return
+}
+
+// RelChange returns the change of the value relative to the previous one, e.g. -0.11 for 89 following 100.
+// The change from zero is infinite unless the value is zero too.
+func RelChange(prev, val float64) (rel float64) {
+	switch {
+	case val == prev:
+	case prev == 0:
+		rel = math.Inf(1)
+		if val < 0 {
+			rel = math.Inf(-1)
+		}
+	default:
+		rel = (val - prev) / math.Abs(prev)
+	}
+	return
+}
+
+// matchesExact is the same as matchesVal but compares the exact values, nil stands for the value not being a number.
+func (c Condition) matchesExact(v *big.Rat) (matches bool) {
+	if v == nil {
+		return c.Op == OpNe || c.Op == OpNotIn
+	}
+	cmp := func() int {
+		if c.isExact() {
+			return v.Cmp(c.exactVal())
+		}
+		return cmpExact(v, c.Val)
+	}
+	switch c.Op {
+	case OpGt:
+		matches = cmp() > 0
+	case OpGte:
+		matches = cmp() >= 0
+	case OpEq:
+		matches = cmp() == 0
+		if !matches && !c.Tolerance.IsZero() {
+			min, max := c.Tolerance.Bounds(c.approxVal())
+			matches = cmpExact(v, min) >= 0 && cmpExact(v, max) <= 0
+		}
+	case OpLte:
+		matches = cmp() <= 0
+	case OpLt:
+		matches = cmp() < 0
+	case OpNe:
+		matches = cmp() != 0
+	case OpRange:
+		cmpMin, cmpMax := cmpExact(v, c.Range.Min), cmpExact(v, c.Range.Max)
+		aboveMin := cmpMin > 0 || c.Range.MinInclusive && cmpMin == 0
+		belowMax := cmpMax < 0 || c.Range.MaxInclusive && cmpMax == 0
+		matches = aboveMin && belowMax
+	case OpIn:
+		matches = slices.ContainsFunc(c.Vals, func(val float64) bool {
+			return cmpExact(v, val) == 0
+		})
+	case OpNotIn:
+		matches = !slices.ContainsFunc(c.Vals, func(val float64) bool {
+			return cmpExact(v, val) == 0
+		})
+	case OpCrossAbove:
+		matches = cmp() > 0
+	case OpCrossBelow:
+		matches = cmp() < 0
+	}
+	return
+}
+
+func (c Condition) isExact() bool {
+	return c.Dec != "" || c.Int != nil
+}
+
+// exactVal returns the exact condition value, nil when it's not a number.
+func (c Condition) exactVal() (v *big.Rat) {
+	return exactVal(c.Dec, c.Int, c.Val)
+}
+
+// approxVal returns the condition value as float64 even if it's the exact one.
+func (c Condition) approxVal() (v float64) {
+	v = c.Val
+	switch {
+	case c.Dec != "":
+		v = c.Dec.Float64()
+	case c.Int != nil:
+		v = float64(*c.Int)
+	}
+	return
+}
+
+func exactVal(dec Decimal, i *int64, val float64) (v *big.Rat) {
+	switch {
+	case dec != "":
+		v = dec.Rat()
+	case i != nil:
+		v = new(big.Rat).SetInt64(*i)
+	default:
+		v = new(big.Rat).SetFloat64(val)
+	}
+	return
+}
+
+func (r Range) Contains(val float64) bool {
+	aboveMin := val > r.Min || r.MinInclusive && val == r.Min
+	belowMax := val < r.Max || r.MaxInclusive && val == r.Max
+	return aboveMin && belowMax
+}
+
+// ValBounds returns the bounds of the values the condition may hold for, both are nil when the condition can not be
+// selected by the value alone, e.g. the stateful or the negated one. Every bound is inclusive. The exact value is
+// approximated by the nearest float64: the rounding is monotonic, so the bounds still cover every matching value.
+func (c Condition) ValBounds() (min, max *float64) {
+	if c.Not || c.Relative || !c.Window.IsZero() || len(c.Terms) > 0 {
+		return
+	}
+	v := c.approxVal()
+	switch c.Op {
+	case OpGt, OpGte:
+		min = &v
+	case OpLt, OpLte:
+		max = &v
+	case OpEq:
+		lo, hi := c.Tolerance.Bounds(v)
+		min, max = &lo, &hi
+	case OpRange:
+		lo, hi := c.Range.Min, c.Range.Max
+		min, max = &lo, &hi
+	}
+	return
+}
@@ -0,0 +1,909 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTolerance_Bounds(t *testing.T) {
+	cases := map[string]struct {
+		tol Tolerance
+		val float64
+		min float64
+		max float64
+	}{
+		"zero": {
+			val: 0.3,
+			min: 0.3,
+			max: 0.3,
+		},
+		"abs": {
+			tol: Tolerance{
+				Abs: 0.5,
+			},
+			val: 10,
+			min: 9.5,
+			max: 10.5,
+		},
+		"rel": {
+			tol: Tolerance{
+				Rel: 0.1,
+			},
+			val: -10,
+			min: -11,
+			max: -9,
+		},
+		"abs wins": {
+			tol: Tolerance{
+				Abs: 2,
+				Rel: 0.1,
+			},
+			val: 10,
+			min: 8,
+			max: 12,
+		},
+		"negative is ignored": {
+			tol: Tolerance{
+				Abs: -1,
+			},
+			val: 1,
+			min: 1,
+			max: 1,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			min, max := c.tol.Bounds(c.val)
+			assert.InDelta(t, c.min, min, 1e-12)
+			assert.InDelta(t, c.max, max, 1e-12)
+		})
+	}
+}
+
+func TestTolerance_Bounds_FloatSum(t *testing.T) {
+	min, max := Tolerance{Abs: 1e-9}.Bounds(0.3)
+	a, b := 0.1, 0.2
+	v := a + b
+	assert.NotEqual(t, 0.3, v)
+	assert.True(t, min <= v && v <= max)
+}
+
+func TestTolerance_IsZero(t *testing.T) {
+	assert.True(t, Tolerance{}.IsZero())
+	assert.False(t, Tolerance{Rel: 1e-6}.IsZero())
+}
+
+func TestCondition_Matches(t *testing.T) {
+	cases := map[string]struct {
+		cond    Condition
+		key     string
+		val     float64
+		matches bool
+	}{
+		"undefined op": {
+			cond: Condition{
+				Key: "k0",
+				Val: 1,
+			},
+			key: "k0",
+			val: 1,
+		},
+		"different key": {
+			cond: Condition{
+				Key: "k0",
+				Op:  OpEq,
+				Val: 1,
+			},
+			key: "k1",
+			val: 1,
+		},
+		"empty key matches any": {
+			cond: Condition{
+				Op:  OpEq,
+				Val: 1,
+			},
+			key:     "k1",
+			val:     1,
+			matches: true,
+		},
+		"gt": {
+			cond: Condition{
+				Key: "k0",
+				Op:  OpGt,
+				Val: 1,
+			},
+			key:     "k0",
+			val:     1.1,
+			matches: true,
+		},
+		"gt equal": {
+			cond: Condition{
+				Key: "k0",
+				Op:  OpGt,
+				Val: 1,
+			},
+			key: "k0",
+			val: 1,
+		},
+		"gte equal": {
+			cond: Condition{
+				Key: "k0",
+				Op:  OpGte,
+				Val: 1,
+			},
+			key:     "k0",
+			val:     1,
+			matches: true,
+		},
+		"eq": {
+			cond: Condition{
+				Key: "k0",
+				Op:  OpEq,
+				Val: 0.3,
+			},
+			key:     "k0",
+			val:     0.3,
+			matches: true,
+		},
+		"eq float sum": {
+			cond: Condition{
+				Key: "k0",
+				Op:  OpEq,
+				Val: 0.3,
+			},
+			key: "k0",
+			val: 0.30000000000000004,
+		},
+		"eq float sum with tolerance": {
+			cond: Condition{
+				Key: "k0",
+				Op:  OpEq,
+				Val: 0.3,
+				Tolerance: Tolerance{
+					Abs: 1e-9,
+				},
+			},
+			key:     "k0",
+			val:     0.30000000000000004,
+			matches: true,
+		},
+		"lte equal": {
+			cond: Condition{
+				Key: "k0",
+				Op:  OpLte,
+				Val: 1,
+			},
+			key:     "k0",
+			val:     1,
+			matches: true,
+		},
+		"lt equal": {
+			cond: Condition{
+				Key: "k0",
+				Op:  OpLt,
+				Val: 1,
+			},
+			key: "k0",
+			val: 1,
+		},
+		"lt": {
+			cond: Condition{
+				Key: "k0",
+				Op:  OpLt,
+				Val: 1,
+			},
+			key:     "k0",
+			val:     -1,
+			matches: true,
+		},
+		"ne": {
+			cond: Condition{
+				Key: "k0",
+				Op:  OpNe,
+				Val: 0,
+			},
+			key:     "k0",
+			val:     1,
+			matches: true,
+		},
+		"ne equal": {
+			cond: Condition{
+				Key: "k0",
+				Op:  OpNe,
+				Val: 0,
+			},
+			key: "k0",
+			val: 0,
+		},
+		"range inclusive min": {
+			cond: Condition{
+				Key: "k0",
+				Op:  OpRange,
+				Range: Range{
+					Min:          10,
+					MinInclusive: true,
+					Max:          20,
+				},
+			},
+			key:     "k0",
+			val:     10,
+			matches: true,
+		},
+		"range exclusive max": {
+			cond: Condition{
+				Key: "k0",
+				Op:  OpRange,
+				Range: Range{
+					Min:          10,
+					MinInclusive: true,
+					Max:          20,
+				},
+			},
+			key: "k0",
+			val: 20,
+		},
+		"in": {
+			cond: Condition{
+				Key:  "k0",
+				Op:   OpIn,
+				Vals: []float64{500, 502},
+			},
+			key:     "k0",
+			val:     502,
+			matches: true,
+		},
+		"not in": {
+			cond: Condition{
+				Key:  "k0",
+				Op:   OpNotIn,
+				Vals: []float64{500, 502},
+			},
+			key: "k0",
+			val: 502,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.matches, c.cond.Matches(c.key, c.val))
+		})
+	}
+}
+
+func TestCondition_MatchesAttrAt(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	ts := UnixSeconds(now)
+	cases := map[string]struct {
+		cond    Condition
+		attr    Attr
+		matches bool
+	}{
+		"within last day": {
+			cond: Condition{
+				Key:      "published",
+				Op:       OpGte,
+				Val:      -86400,
+				Relative: true,
+			},
+			attr: Attr{
+				Key: "published",
+				Val: ts - 3600,
+			},
+			matches: true,
+		},
+		"older than last day": {
+			cond: Condition{
+				Key:      "published",
+				Op:       OpGte,
+				Val:      -86400,
+				Relative: true,
+			},
+			attr: Attr{
+				Key: "published",
+				Val: ts - 86401,
+			},
+		},
+		"expires in more than week": {
+			cond: Condition{
+				Key:      "expires",
+				Op:       OpGt,
+				Val:      604800,
+				Relative: true,
+			},
+			attr: Attr{
+				Key: "expires",
+				Val: ts + 604801,
+			},
+			matches: true,
+		},
+		"relative range": {
+			cond: Condition{
+				Key: "t",
+				Op:  OpRange,
+				Range: Range{
+					Min:          -60,
+					MinInclusive: true,
+				},
+				Relative: true,
+			},
+			attr: Attr{
+				Key: "t",
+				Val: ts - 60,
+			},
+			matches: true,
+		},
+		"absolute": {
+			cond: Condition{
+				Key: "t",
+				Op:  OpGt,
+				Val: -86400,
+			},
+			attr: Attr{
+				Key: "t",
+				Val: 0,
+			},
+			matches: true,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.matches, c.cond.MatchesAttrAt(c.attr, now))
+		})
+	}
+}
+
+func TestCondition_MatchesAttr_Exact(t *testing.T) {
+	cases := map[string]struct {
+		cond    Condition
+		attr    Attr
+		matches bool
+	}{
+		"exact eq": {
+			cond: Condition{
+				Key: "price",
+				Op:  OpEq,
+				Dec: "19.99",
+			},
+			attr: Attr{
+				Key: "price",
+				Dec: "19.990",
+			},
+			matches: true,
+		},
+		"exact eq float attribute": {
+			cond: Condition{
+				Key: "price",
+				Op:  OpEq,
+				Dec: "19.99",
+			},
+			attr: Attr{
+				Key: "price",
+				Val: 19.99,
+			},
+		},
+		"float lt exact attribute": {
+			cond: Condition{
+				Key: "price",
+				Op:  OpLt,
+				Val: 19.99,
+			},
+			attr: Attr{
+				Key: "price",
+				Dec: "19.99",
+			},
+		},
+		"float gt exact attribute": {
+			cond: Condition{
+				Key: "price",
+				Op:  OpGt,
+				Val: 19.99,
+			},
+			attr: Attr{
+				Key: "price",
+				Dec: "19.99",
+			},
+			matches: true,
+		},
+		"exact lte": {
+			cond: Condition{
+				Key: "price",
+				Op:  OpLte,
+				Dec: "0.3",
+			},
+			attr: Attr{
+				Key: "price",
+				Dec: "0.30000000000000000000000000000001",
+			},
+		},
+		"exact eq with tolerance": {
+			cond: Condition{
+				Key: "price",
+				Op:  OpEq,
+				Dec: "20",
+				Tolerance: Tolerance{
+					Abs: 0.5,
+				},
+			},
+			attr: Attr{
+				Key: "price",
+				Dec: "19.5",
+			},
+			matches: true,
+		},
+		"range": {
+			cond: Condition{
+				Key: "price",
+				Op:  OpRange,
+				Range: Range{
+					Min:          10,
+					MinInclusive: true,
+					Max:          20,
+				},
+			},
+			attr: Attr{
+				Key: "price",
+				Dec: "10",
+			},
+			matches: true,
+		},
+		"int eq beyond float precision": {
+			cond: Condition{
+				Key: "id",
+				Op:  OpEq,
+				Int: ptr(int64(9007199254740993)),
+			},
+			attr: Attr{
+				Key: "id",
+				Int: ptr(int64(9007199254740992)),
+			},
+		},
+		"int lt": {
+			cond: Condition{
+				Key: "id",
+				Op:  OpLt,
+				Int: ptr(int64(9007199254740993)),
+			},
+			attr: Attr{
+				Key: "id",
+				Int: ptr(int64(9007199254740992)),
+			},
+			matches: true,
+		},
+		"int gte float attribute": {
+			cond: Condition{
+				Key: "id",
+				Op:  OpGte,
+				Int: ptr(int64(9007199254740993)),
+			},
+			attr: Attr{
+				Key: "id",
+				Val: 9007199254740992,
+			},
+		},
+		"float eq int attribute": {
+			cond: Condition{
+				Key: "id",
+				Op:  OpEq,
+				Val: 9007199254740992,
+			},
+			attr: Attr{
+				Key: "id",
+				Int: ptr(int64(9007199254740993)),
+			},
+		},
+		"not in": {
+			cond: Condition{
+				Key:  "price",
+				Op:   OpNotIn,
+				Vals: []float64{0.5},
+			},
+			attr: Attr{
+				Key: "price",
+				Dec: "0.5",
+			},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.matches, c.cond.MatchesAttr(c.attr))
+		})
+	}
+}
+
+func TestCondition_Crossing(t *testing.T) {
+	cases := map[string]struct {
+		cond   Condition
+		val    float64
+		beyond bool
+		rearms bool
+	}{
+		"above": {
+			cond: Condition{
+				Op:         OpCrossAbove,
+				Val:        90,
+				Hysteresis: 5,
+			},
+			val:    91,
+			beyond: true,
+		},
+		"above at threshold": {
+			cond: Condition{
+				Op:         OpCrossAbove,
+				Val:        90,
+				Hysteresis: 5,
+			},
+			val: 90,
+		},
+		"above within hysteresis": {
+			cond: Condition{
+				Op:         OpCrossAbove,
+				Val:        90,
+				Hysteresis: 5,
+			},
+			val: 85,
+		},
+		"above re-arms": {
+			cond: Condition{
+				Op:         OpCrossAbove,
+				Val:        90,
+				Hysteresis: 5,
+			},
+			val:    84.9,
+			rearms: true,
+		},
+		"below": {
+			cond: Condition{
+				Op:  OpCrossBelow,
+				Val: 10,
+			},
+			val:    9,
+			beyond: true,
+		},
+		"below re-arms without hysteresis": {
+			cond: Condition{
+				Op:  OpCrossBelow,
+				Val: 10,
+			},
+			val:    11,
+			rearms: true,
+		},
+		"not crossing": {
+			cond: Condition{
+				Op:  OpGt,
+				Val: 10,
+			},
+			val: 11,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			beyond, rearms := c.cond.Crossing(c.val)
+			assert.Equal(t, c.beyond, beyond)
+			assert.Equal(t, c.rearms, rearms)
+		})
+	}
+}
+
+func TestCondition_Changed(t *testing.T) {
+	cases := map[string]struct {
+		cond    Condition
+		prev    float64
+		val     float64
+		changed bool
+	}{
+		"any up": {
+			cond: Condition{
+				Op:  OpChange,
+				Val: 5,
+			},
+			prev:    10,
+			val:     16,
+			changed: true,
+		},
+		"any down": {
+			cond: Condition{
+				Op:  OpChange,
+				Val: 5,
+			},
+			prev:    10,
+			val:     4,
+			changed: true,
+		},
+		"any not more than": {
+			cond: Condition{
+				Op:  OpChange,
+				Val: 5,
+			},
+			prev: 10,
+			val:  15,
+		},
+		"up": {
+			cond: Condition{
+				Op:  OpChange,
+				Val: 5,
+				Change: Change{
+					Dir: ChangeUp,
+				},
+			},
+			prev:    10,
+			val:     16,
+			changed: true,
+		},
+		"up but down": {
+			cond: Condition{
+				Op:  OpChange,
+				Val: 5,
+				Change: Change{
+					Dir: ChangeUp,
+				},
+			},
+			prev: 10,
+			val:  4,
+		},
+		"down": {
+			cond: Condition{
+				Op:  OpChange,
+				Val: 5,
+				Change: Change{
+					Dir: ChangeDown,
+				},
+			},
+			prev:    10,
+			val:     4,
+			changed: true,
+		},
+		"down but up": {
+			cond: Condition{
+				Op:  OpChange,
+				Val: 5,
+				Change: Change{
+					Dir: ChangeDown,
+				},
+			},
+			prev: 10,
+			val:  16,
+		},
+		"rel down": {
+			cond: Condition{
+				Op:  OpChange,
+				Val: 0.1,
+				Change: Change{
+					Dir: ChangeDown,
+					Rel: true,
+				},
+			},
+			prev:    100,
+			val:     89,
+			changed: true,
+		},
+		"rel down not more than": {
+			cond: Condition{
+				Op:  OpChange,
+				Val: 0.1,
+				Change: Change{
+					Dir: ChangeDown,
+					Rel: true,
+				},
+			},
+			prev: 100,
+			val:  90,
+		},
+		"rel up from negative": {
+			cond: Condition{
+				Op:  OpChange,
+				Val: 0.5,
+				Change: Change{
+					Dir: ChangeUp,
+					Rel: true,
+				},
+			},
+			prev:    -10,
+			val:     -4,
+			changed: true,
+		},
+		"rel from zero": {
+			cond: Condition{
+				Op:  OpChange,
+				Val: 0.1,
+				Change: Change{
+					Dir: ChangeUp,
+					Rel: true,
+				},
+			},
+			prev:    0,
+			val:     1,
+			changed: true,
+		},
+		"rel zero to zero": {
+			cond: Condition{
+				Op: OpChange,
+				Change: Change{
+					Rel: true,
+				},
+			},
+			prev: 0,
+			val:  0,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.changed, c.cond.Changed(c.prev, c.val))
+		})
+	}
+}
+
+func TestCondition_MatchesAttrs(t *testing.T) {
+	attrs := map[string]float64{
+		"sale_price": 90,
+		"list_price": 100,
+		"used":       70,
+		"reserved":   40,
+		"quota":      100,
+	}
+	cases := map[string]struct {
+		cond    Condition
+		matches bool
+	}{
+		"no terms": {
+			cond: Condition{
+				Key: "sale_price",
+				Op:  OpGt,
+			},
+		},
+		"sale price below list price": {
+			cond: Condition{
+				Terms: []Term{
+					{
+						Key:  "sale_price",
+						Coef: 1,
+					},
+					{
+						Key:  "list_price",
+						Coef: -1,
+					},
+				},
+				Op: OpLt,
+			},
+			matches: true,
+		},
+		"over quota": {
+			cond: Condition{
+				Terms: []Term{
+					{
+						Key:  "used",
+						Coef: 1,
+					},
+					{
+						Key:  "reserved",
+						Coef: 1,
+					},
+					{
+						Key:  "quota",
+						Coef: -1,
+					},
+				},
+				Op: OpGt,
+			},
+			matches: true,
+		},
+		"equal with tolerance": {
+			cond: Condition{
+				Terms: []Term{
+					{
+						Key:  "sale_price",
+						Coef: 1,
+					},
+					{
+						Key:  "list_price",
+						Coef: -0.9,
+					},
+				},
+				Op: OpEq,
+				Tolerance: Tolerance{
+					Abs: 1e-9,
+				},
+			},
+			matches: true,
+		},
+		"missing attribute": {
+			cond: Condition{
+				Terms: []Term{
+					{
+						Key:  "used",
+						Coef: 1,
+					},
+					{
+						Key:  "missing",
+						Coef: -1,
+					},
+				},
+				Op: OpGt,
+			},
+		},
+		"unsupported op": {
+			cond: Condition{
+				Terms: []Term{
+					{
+						Key:  "used",
+						Coef: 1,
+					},
+				},
+				Op:   OpIn,
+				Vals: []float64{70},
+			},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.matches, c.cond.MatchesAttrs(attrs))
+			assert.False(t, c.cond.Matches("used", 70) && len(c.cond.Terms) > 0)
+		})
+	}
+}
+
+func TestCondition_ValBounds(t *testing.T) {
+	cases := map[string]struct {
+		cond Condition
+		min  *float64
+		max  *float64
+	}{
+		"gt": {
+			cond: Condition{
+				Op:  OpGt,
+				Val: 1,
+			},
+			min: ptr(1.0),
+		},
+		"lte int": {
+			cond: Condition{
+				Op:  OpLte,
+				Int: ptr(int64(3)),
+			},
+			max: ptr(3.0),
+		},
+		"eq tolerance": {
+			cond: Condition{
+				Op:        OpEq,
+				Dec:       "10",
+				Tolerance: Tolerance{Abs: 1},
+			},
+			min: ptr(9.0),
+			max: ptr(11.0),
+		},
+		"range": {
+			cond: Condition{
+				Op:    OpRange,
+				Range: Range{Min: 1, Max: 2},
+			},
+			min: ptr(1.0),
+			max: ptr(2.0),
+		},
+		"negated": {
+			cond: Condition{
+				Op:  OpGt,
+				Val: 1,
+				Not: true,
+			},
+		},
+		"relative": {
+			cond: Condition{
+				Op:       OpGt,
+				Val:      1,
+				Relative: true,
+			},
+		},
+		"in": {
+			cond: Condition{
+				Op:   OpIn,
+				Vals: []float64{1},
+			},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			min, max := c.cond.ValBounds()
+			assert.Equal(t, c.min, min)
+			assert.Equal(t, c.max, max)
+		})
+	}
+}
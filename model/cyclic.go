@@ -0,0 +1,83 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrInvalidPeriod = errors.New("cyclic range period should be a positive finite number")
+
+// CyclicRange returns the range of the cyclic range condition having the bounds taken modulo the period.
+// The range spanning more than the whole period or exactly the whole period having both bounds inclusive is returned
+// as [0, period] matching any value. The range spanning exactly the whole period having an exclusive bound matches any
+// value except the bound, it's returned as (0, period) or as the range wrapping around the bound otherwise.
+func (c Condition) CyclicRange() (r Range, err error) {
+	span := c.Range.Max - c.Range.Min
+	switch {
+	case !(c.Period > 0) || math.IsInf(c.Period, 1):
+		err = fmt.Errorf("%w: %s", ErrInvalidPeriod, formatNum(c.Period))
+	case math.IsInf(c.Range.Min, 0), math.IsInf(c.Range.Max, 0), math.IsNaN(c.Range.Min), math.IsNaN(c.Range.Max):
+		err = fmt.Errorf("%w: range bounds should be finite", ErrInvalidPeriod)
+	case span > c.Period, span == c.Period && c.Range.MinInclusive && c.Range.MaxInclusive:
+		r = Range{
+			Min:          0,
+			MinInclusive: true,
+			Max:          c.Period,
+			MaxInclusive: true,
+		}
+	case span == c.Period:
+		r.Min = cyclic(c.Range.Min, c.Period)
+		switch r.Min {
+		case 0:
+			r.Max = c.Period
+		default:
+			// (min, min - ulp] wraps around the period and excludes the min only
+			r.Max = math.Nextafter(r.Min, math.Inf(-1))
+			r.MaxInclusive = true
+		}
+	default:
+		r = c.Range
+		r.Min = cyclic(r.Min, c.Period)
+		r.Max = cyclic(r.Max, c.Period)
+	}
+	return
+}
+
+// ContainsCyclic reports whether the value is within the range when both are taken modulo the period.
+// The range wraps around the end of the period when Min is greater than Max, e.g. the hours [22, 6).
+// The range spanning the whole period or more contains any value, e.g. the angles [0, 360], except the exclusive bound
+// of the range spanning exactly the whole period, e.g. the hours [0, 24) don't contain 24 being the same as 0.
+func (r Range) ContainsCyclic(val, period float64) (contains bool) {
+	switch {
+	case !(period > 0):
+	case r.Max-r.Min > period:
+		contains = true
+	case r.Max-r.Min == period:
+		contains = r.MinInclusive && r.MaxInclusive || cyclic(val, period) != cyclic(r.Min, period)
+	default:
+		val, min, max := cyclic(val, period), cyclic(r.Min, period), cyclic(r.Max, period)
+		aboveMin := val > min || r.MinInclusive && val == min
+		belowMax := val < max || r.MaxInclusive && val == max
+		switch {
+		case min <= max:
+			contains = aboveMin && belowMax
+		default:
+			contains = aboveMin || belowMax
+		}
+	}
+	return
+}
+
+// cyclic returns the value taken modulo the period, the result is within [0, period).
+func cyclic(v, period float64) (c float64) {
+	c = math.Mod(v, period)
+	if c < 0 {
+		c += period
+	}
+	if c >= period {
+		// the tiny negative value rounded up to the period
+		c = 0
+	}
+	return
+}
@@ -0,0 +1,311 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestCondition_CyclicRange(t *testing.T) {
+	cases := map[string]struct {
+		cond Condition
+		rng  Range
+		err  error
+	}{
+		"ok": {
+			cond: Condition{
+				Op: OpCyclicRange,
+				Range: Range{
+					Min:          22,
+					MinInclusive: true,
+					Max:          6,
+				},
+				Period: 24,
+			},
+			rng: Range{
+				Min:          22,
+				MinInclusive: true,
+				Max:          6,
+			},
+		},
+		"normalized": {
+			cond: Condition{
+				Op: OpCyclicRange,
+				Range: Range{
+					Min: -10,
+					Max: 20,
+				},
+				Period: 360,
+			},
+			rng: Range{
+				Min: 350,
+				Max: 20,
+			},
+		},
+		"full cycle": {
+			cond: Condition{
+				Op: OpCyclicRange,
+				Range: Range{
+					Min: 0,
+					Max: 24,
+				},
+				Period: 24,
+			},
+			rng: Range{
+				Min: 0,
+				Max: 24,
+			},
+		},
+		"full cycle inclusive": {
+			cond: Condition{
+				Op: OpCyclicRange,
+				Range: Range{
+					Min:          -24,
+					MinInclusive: true,
+					Max:          0,
+					MaxInclusive: true,
+				},
+				Period: 24,
+			},
+			rng: Range{
+				Min:          0,
+				MinInclusive: true,
+				Max:          24,
+				MaxInclusive: true,
+			},
+		},
+		"full cycle exclusive end": {
+			cond: Condition{
+				Op: OpCyclicRange,
+				Range: Range{
+					Min:          6,
+					MinInclusive: true,
+					Max:          30,
+				},
+				Period: 24,
+			},
+			rng: Range{
+				Min:          6,
+				Max:          math.Nextafter(6, 0),
+				MaxInclusive: true,
+			},
+		},
+		"more than full cycle": {
+			cond: Condition{
+				Op: OpCyclicRange,
+				Range: Range{
+					Min: -10,
+					Max: 380,
+				},
+				Period: 360,
+			},
+			rng: Range{
+				Min:          0,
+				MinInclusive: true,
+				Max:          360,
+				MaxInclusive: true,
+			},
+		},
+		"zero period": {
+			cond: Condition{
+				Op: OpCyclicRange,
+				Range: Range{
+					Max: 1,
+				},
+			},
+			err: ErrInvalidPeriod,
+		},
+		"infinite period": {
+			cond: Condition{
+				Op:     OpCyclicRange,
+				Period: math.Inf(1),
+			},
+			err: ErrInvalidPeriod,
+		},
+		"infinite bound": {
+			cond: Condition{
+				Op: OpCyclicRange,
+				Range: Range{
+					Max: math.Inf(1),
+				},
+				Period: 7,
+			},
+			err: ErrInvalidPeriod,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			rng, err := c.cond.CyclicRange()
+			assert.ErrorIs(t, err, c.err)
+			assert.Equal(t, c.rng, rng)
+		})
+	}
+}
+
+func TestRange_ContainsCyclic(t *testing.T) {
+	night := Range{
+		Min:          22,
+		MinInclusive: true,
+		Max:          6,
+	}
+	day := Range{
+		Min:          6,
+		MinInclusive: true,
+		Max:          22,
+	}
+	cases := map[string]struct {
+		rng      Range
+		period   float64
+		val      float64
+		contains bool
+	}{
+		"night start": {
+			rng:      night,
+			period:   24,
+			val:      22,
+			contains: true,
+		},
+		"night midnight": {
+			rng:      night,
+			period:   24,
+			val:      0,
+			contains: true,
+		},
+		"night end excluded": {
+			rng:    night,
+			period: 24,
+			val:    6,
+		},
+		"night next day": {
+			rng:      night,
+			period:   24,
+			val:      47,
+			contains: true,
+		},
+		"night negative": {
+			rng:      night,
+			period:   24,
+			val:      -1,
+			contains: true,
+		},
+		"day": {
+			rng:      day,
+			period:   24,
+			val:      12,
+			contains: true,
+		},
+		"day excludes night": {
+			rng:    day,
+			period: 24,
+			val:    23,
+		},
+		"wind direction": {
+			rng: Range{
+				Min:          350,
+				MinInclusive: true,
+				Max:          20,
+				MaxInclusive: true,
+			},
+			period:   360,
+			val:      365,
+			contains: true,
+		},
+		"full day": {
+			rng: Range{
+				Min:          0,
+				MinInclusive: true,
+				Max:          24,
+			},
+			period:   24,
+			val:      23.5,
+			contains: true,
+		},
+		"full day end excluded": {
+			rng: Range{
+				Min:          0,
+				MinInclusive: true,
+				Max:          24,
+			},
+			period: 24,
+			val:    24,
+		},
+		"full day shifted": {
+			rng: Range{
+				Min:          6,
+				MinInclusive: true,
+				Max:          30,
+			},
+			period:   24,
+			val:      5.5,
+			contains: true,
+		},
+		"full day shifted end excluded": {
+			rng: Range{
+				Min:          6,
+				MinInclusive: true,
+				Max:          30,
+			},
+			period: 24,
+			val:    6,
+		},
+		"full circle": {
+			rng: Range{
+				Min:          0,
+				MinInclusive: true,
+				Max:          360,
+				MaxInclusive: true,
+			},
+			period:   360,
+			val:      0,
+			contains: true,
+		},
+		"more than full circle": {
+			rng: Range{
+				Min: 90,
+				Max: 540,
+			},
+			period:   360,
+			val:      45,
+			contains: true,
+		},
+		"zero period": {
+			rng:    day,
+			period: 0,
+			val:    12,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.contains, c.rng.ContainsCyclic(c.val, c.period))
+		})
+	}
+}
+
+func TestCondition_CyclicRange_Contains(t *testing.T) {
+	conds := []Condition{
+		{
+			Range:  Range{Min: 0, MinInclusive: true, Max: 24},
+			Period: 24,
+		},
+		{
+			Range:  Range{Min: 6, MinInclusive: true, Max: 30},
+			Period: 24,
+		},
+		{
+			Range:  Range{Min: -6, Max: 18, MaxInclusive: true},
+			Period: 24,
+		},
+		{
+			Range:  Range{Min: 0, MinInclusive: true, Max: 24, MaxInclusive: true},
+			Period: 24,
+		},
+	}
+	for _, c := range conds {
+		c.Op = OpCyclicRange
+		r, err := c.CyclicRange()
+		assert.Nil(t, err)
+		for _, val := range []float64{-1, 0, 5.5, 6, 12, 18, 23.5, 24, 30} {
+			assert.Equal(t, c.Range.ContainsCyclic(val, c.Period), r.ContainsCyclic(val, c.Period), "%+v %g", c.Range, val)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+)
+
+// Decimal is the exact decimal number in the canonical text form, e.g. "19.99". The empty Decimal means no value.
+type Decimal string
+
+var ErrInvalidDecimal = errors.New("invalid decimal")
+
+// the limits of IEEE 754 decimal128
+const decimalDigitsMax = 34
+const decimalExpMin = -6176
+const decimalExpMax = 6111
+
+var decimalSyntax = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d{1,4})?$`)
+
+var bigTen = big.NewInt(10)
+
+// ParseDecimal parses the decimal number like "19.99" or "-1.5e-3", see NewDecimal for the limits.
+func ParseDecimal(s string) (d Decimal, err error) {
+	r, ok := new(big.Rat).SetString(s)
+	switch {
+	case !ok || !decimalSyntax.MatchString(s):
+		err = fmt.Errorf("%w: %q", ErrInvalidDecimal, s)
+	default:
+		d, err = NewDecimal(r)
+	}
+	return
+}
+
+// NewDecimal returns the exact decimal representation of the number. The number should be representable as
+// IEEE 754 decimal128: up to 34 significant digits.
+func NewDecimal(src *big.Rat) (d Decimal, err error) {
+	r := new(big.Rat).Set(src)
+	ten := new(big.Rat).SetInt(bigTen)
+	// the count of the fraction digits
+	var scale int
+	for ; !r.IsInt() && scale <= -decimalExpMin; scale++ {
+		r.Mul(r, ten)
+	}
+	// the numerator without the trailing zeros is the significand
+	coef := new(big.Int).Set(r.Num())
+	exp := -scale
+	for coef.Sign() != 0 {
+		var q, mod big.Int
+		q.QuoRem(coef, bigTen, &mod)
+		if mod.Sign() != 0 {
+			break
+		}
+		coef.Set(&q)
+		exp++
+	}
+	switch {
+	case !r.IsInt():
+		err = fmt.Errorf("%w: %s is not a finite decimal fraction", ErrInvalidDecimal, src.RatString())
+	case len(new(big.Int).Abs(coef).String()) > decimalDigitsMax:
+		err = fmt.Errorf("%w: more than %d significant digits", ErrInvalidDecimal, decimalDigitsMax)
+	case coef.Sign() != 0 && (exp < decimalExpMin || exp > decimalExpMax):
+		err = fmt.Errorf("%w: exponent is out of range", ErrInvalidDecimal)
+	default:
+		d = Decimal(src.FloatString(scale))
+	}
+	return
+}
+
+// Rat returns the exact value, nil for the empty Decimal.
+func (d Decimal) Rat() (r *big.Rat) {
+	if d != "" {
+		r, _ = new(big.Rat).SetString(string(d))
+	}
+	return
+}
+
+// Float64 returns the nearest float64 value.
+func (d Decimal) Float64() (f float64) {
+	if r := d.Rat(); r != nil {
+		f, _ = r.Float64()
+	}
+	return
+}
+
+// cmpExact compares the exact value with the float one. NaN is less than any value.
+func cmpExact(v *big.Rat, f float64) (c int) {
+	switch {
+	case math.IsNaN(f):
+		c = 1
+	case math.IsInf(f, 1):
+		c = -1
+	case math.IsInf(f, -1):
+		c = 1
+	default:
+		c = v.Cmp(new(big.Rat).SetFloat64(f))
+	}
+	return
+}
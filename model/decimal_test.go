@@ -0,0 +1,82 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	cases := map[string]struct {
+		src string
+		dec Decimal
+		err error
+	}{
+		"fraction": {
+			src: "19.99",
+			dec: "19.99",
+		},
+		"trailing zeros": {
+			src: "+19.990",
+			dec: "19.99",
+		},
+		"negative": {
+			src: "-0.5",
+			dec: "-0.5",
+		},
+		"exponent": {
+			src: "1.5e3",
+			dec: "1500",
+		},
+		"negative exponent": {
+			src: "25E-4",
+			dec: "0.0025",
+		},
+		"leading dot": {
+			src: ".5",
+			dec: "0.5",
+		},
+		"negative zero": {
+			src: "-0.00",
+			dec: "0",
+		},
+		"max digits": {
+			src: "1234567890123456789012345678901234",
+			dec: "1234567890123456789012345678901234",
+		},
+		"too many digits": {
+			src: "0.12345678901234567890123456789012345",
+			err: ErrInvalidDecimal,
+		},
+		"out of range": {
+			src: "1e6112",
+			err: ErrInvalidDecimal,
+		},
+		"fraction syntax": {
+			src: "1/3",
+			err: ErrInvalidDecimal,
+		},
+		"hex": {
+			src: "0x10",
+			err: ErrInvalidDecimal,
+		},
+		"empty": {
+			err: ErrInvalidDecimal,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			dec, err := ParseDecimal(c.src)
+			assert.Equal(t, c.dec, dec)
+			assert.ErrorIs(t, err, c.err)
+		})
+	}
+}
+
+func TestNewDecimal(t *testing.T) {
+	d, err := NewDecimal(big.NewRat(3, 8))
+	assert.Nil(t, err)
+	assert.Equal(t, Decimal("0.375"), d)
+	_, err = NewDecimal(big.NewRat(1, 3))
+	assert.ErrorIs(t, err, ErrInvalidDecimal)
+}
@@ -0,0 +1,1045 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParseError describes the position of the invalid input in the condition expression.
+type ParseError struct {
+	// Pos is the 0-based byte offset in the expression.
+	Pos int
+	Msg string
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("invalid condition expression at position %d: %s", e.Pos, e.Msg)
+}
+
+const exprSpecialChars = "<>=!~%{}[](),\""
+const exprKeywordIn = "in"
+const exprKeywordNot = "not"
+const exprKeywordNow = "now"
+const exprKeywordDec = "dec"
+const exprKeywordInt = "int"
+const exprKeywordCrosses = "crosses"
+const exprKeywordAbove = "above"
+const exprKeywordBelow = "below"
+const exprKeywordHysteresis = "hysteresis"
+const exprKeywordChanges = "changes"
+const exprKeywordUp = "up"
+const exprKeywordDown = "down"
+const exprKeywordBy = "by"
+const exprKeywordOver = "over"
+const exprKeywordDeviates = "deviates"
+const exprKeywordSigma = "sigma"
+const exprKeywordHas = "has"
+const exprKeywordAll = "all"
+const exprKeywordAny = "any"
+const exprKeywordNo = "no"
+const exprKeywordBits = "bits"
+const exprKeywordTumbling = "tumbling"
+const exprKeywordCycle = "cycle"
+const exprKeyPrefixSuffix = "**"
+const exprPlus = "+"
+const exprMinus = "-"
+const exprMul = "*"
+
+// ParseCondition parses the condition expression, examples:
+//
+//	price >= 10.5
+//	> -3
+//	ratio = 0.3 ~ 1e-9
+//	price = 100 ~ 1%
+//	temperature in [10, 20)
+//	status_code in {500, 502, 503, 504}
+//	status_code not in {200, 204}
+//	"key with spaces" != 0
+//	sensor.*.temperature > 50
+//	sensor.** > 50
+//	sale_price - list_price < 0
+//	used + reserved - 0.9 * quota > 0
+//	distance < 5 km
+//	published >= now - 86400
+//	expires in (now, now + 604800]
+//	hour in [22, 6) cycle 24
+//	price <= dec 19.99
+//	id = int 9007199254740993
+//	cpu.load crosses above 90 hysteresis 5
+//	price changes down by 10%
+//	temperature changes by 5 °C
+//	latency deviates by 3 sigma
+//	flags has all bits 0x5
+//	permissions has no bits 0b1000
+//	block % 1000 == 0
+//	not status_code in [200, 300)
+//	avg(latency) over 5m > 300 ms
+//	count(amount > 0) over tumbling 1h > 100
+//
+// The key may be omitted to match any attribute key. The unquoted key containing "*" or "?" is the glob pattern
+// (see KeyMatchGlob). The key followed by "**" is the key prefix (see KeyMatchPrefix). The sum of the terms defines
+// the cross-attribute condition (see Condition.Terms), the "+", "-" and "*" should be separated by spaces there.
+// The optional unit follows the values. The values relative to the current time (see Condition.Relative) start with
+// "now" followed by the optional offset, all the values should be either relative or absolute. The exact decimal
+// value (see Condition.Dec) follows "dec" and the exact integer one (see Condition.Int) follows "int", those are
+// supported by the comparison operators only. The windowed aggregate (see Condition.Window) of the key values is
+// compared by the comparison operators only, the aggregate function is one of "count", "sum", "avg", "min" and "max",
+// the optional filter follows the key. The leading "not" negates the stateless condition (see Condition.Not).
+func ParseCondition(src string) (cond Condition, err error) {
+	p := exprParser{
+		src: src,
+	}
+	cond, err = p.parse()
+	return
+}
+
+// String returns the condition expression that is parsed back by ParseCondition.
+func (c Condition) String() string {
+	var sb strings.Builder
+	if c.Not {
+		sb.WriteString(exprKeywordNot + " ")
+	}
+	switch {
+	case len(c.Terms) > 0:
+		for i, t := range c.Terms {
+			switch {
+			case t.Coef < 0 && i == 0:
+				sb.WriteString("- ")
+			case t.Coef < 0:
+				sb.WriteString(" - ")
+			case i > 0:
+				sb.WriteString(" + ")
+			}
+			if coef := math.Abs(t.Coef); coef != 1 {
+				sb.WriteString(formatNum(coef))
+				sb.WriteString(" * ")
+			}
+			sb.WriteString(formatKey(t.Key))
+		}
+		sb.WriteByte(' ')
+	case !c.Window.IsZero():
+		sb.WriteString(c.Window.Agg.String())
+		sb.WriteByte('(')
+		sb.WriteString(c.formatKeyMatch())
+		if f := c.Window.Filter; f.Op != OpUndefined {
+			if c.Key != "" {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(Condition{Op: f.Op, Val: f.Val}.String())
+		}
+		sb.WriteString(") " + exprKeywordOver + " ")
+		if c.Window.Tumbling {
+			sb.WriteString(exprKeywordTumbling + " ")
+		}
+		sb.WriteString(formatDuration(c.Window.Dur))
+		sb.WriteByte(' ')
+	case c.Key != "":
+		sb.WriteString(c.formatKeyMatch())
+		sb.WriteByte(' ')
+	}
+	switch c.Op {
+	case OpGt:
+		sb.WriteString("> ")
+		sb.WriteString(c.formatScalar())
+	case OpGte:
+		sb.WriteString(">= ")
+		sb.WriteString(c.formatScalar())
+	case OpEq:
+		sb.WriteString("= ")
+		sb.WriteString(c.formatScalar())
+		if c.Tolerance.Abs > 0 {
+			sb.WriteString(" ~ ")
+			sb.WriteString(formatNum(c.Tolerance.Abs))
+		}
+		if c.Tolerance.Rel > 0 {
+			sb.WriteString(" ~ ")
+			sb.WriteString(formatNum(c.Tolerance.Rel * 100))
+			sb.WriteByte('%')
+		}
+	case OpLte:
+		sb.WriteString("<= ")
+		sb.WriteString(c.formatScalar())
+	case OpLt:
+		sb.WriteString("< ")
+		sb.WriteString(c.formatScalar())
+	case OpNe:
+		sb.WriteString("!= ")
+		sb.WriteString(c.formatScalar())
+	case OpRange, OpCyclicRange:
+		sb.WriteString("in ")
+		switch c.Range.MinInclusive {
+		case true:
+			sb.WriteByte('[')
+		default:
+			sb.WriteByte('(')
+		}
+		sb.WriteString(c.formatVal(c.Range.Min))
+		sb.WriteString(", ")
+		sb.WriteString(c.formatVal(c.Range.Max))
+		switch c.Range.MaxInclusive {
+		case true:
+			sb.WriteByte(']')
+		default:
+			sb.WriteByte(')')
+		}
+		if c.Op == OpCyclicRange {
+			sb.WriteString(" " + exprKeywordCycle + " ")
+			sb.WriteString(formatNum(c.Period))
+		}
+	case OpIn, OpNotIn:
+		if c.Op == OpNotIn {
+			sb.WriteString("not ")
+		}
+		sb.WriteString("in {")
+		for i, v := range c.Vals {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(c.formatVal(v))
+		}
+		sb.WriteByte('}')
+	case OpCrossAbove, OpCrossBelow:
+		sb.WriteString(exprKeywordCrosses)
+		switch c.Op {
+		case OpCrossAbove:
+			sb.WriteString(" " + exprKeywordAbove + " ")
+		default:
+			sb.WriteString(" " + exprKeywordBelow + " ")
+		}
+		sb.WriteString(formatNum(c.Val))
+		if c.Hysteresis != 0 {
+			sb.WriteString(" " + exprKeywordHysteresis + " ")
+			sb.WriteString(formatNum(c.Hysteresis))
+		}
+	case OpChange:
+		sb.WriteString(exprKeywordChanges)
+		switch c.Change.Dir {
+		case ChangeUp:
+			sb.WriteString(" " + exprKeywordUp)
+		case ChangeDown:
+			sb.WriteString(" " + exprKeywordDown)
+		}
+		sb.WriteString(" " + exprKeywordBy + " ")
+		switch c.Change.Rel {
+		case true:
+			sb.WriteString(formatNum(c.Val * 100))
+			sb.WriteByte('%')
+		default:
+			sb.WriteString(formatNum(c.Val))
+		}
+	case OpMod:
+		sb.WriteString("% " + strconv.FormatInt(c.Mod.Div, 10) + " == " + strconv.FormatInt(c.Mod.Rem, 10))
+	case OpBitsAllSet, OpBitsAnySet, OpBitsNoneSet:
+		sb.WriteString(exprKeywordHas + " ")
+		switch c.Op {
+		case OpBitsAllSet:
+			sb.WriteString(exprKeywordAll)
+		case OpBitsAnySet:
+			sb.WriteString(exprKeywordAny)
+		default:
+			sb.WriteString(exprKeywordNo)
+		}
+		sb.WriteString(" " + exprKeywordBits + " ")
+		mask, _ := c.BitMask()
+		sb.WriteString("0x" + strconv.FormatInt(mask, 16))
+	case OpAnomaly:
+		sb.WriteString(exprKeywordDeviates + " " + exprKeywordBy + " ")
+		sb.WriteString(formatNum(c.Val))
+		sb.WriteString(" " + exprKeywordSigma)
+	default:
+		sb.WriteString(c.Op.String())
+		sb.WriteByte(' ')
+		sb.WriteString(c.formatVal(c.Val))
+	}
+	if c.Unit != "" {
+		sb.WriteByte(' ')
+		sb.WriteString(formatKey(c.Unit))
+	}
+	return sb.String()
+}
+
+func (c Condition) formatKeyMatch() (s string) {
+	switch c.KeyMatch {
+	case KeyMatchPrefix:
+		s = formatKey(c.Key) + exprKeyPrefixSuffix
+	case KeyMatchGlob:
+		s = c.Key
+	default:
+		s = formatKey(c.Key)
+	}
+	return
+}
+
+// formatDuration returns the duration without the trailing zero units, e.g. "1h" instead of "1h0m0s".
+func formatDuration(d time.Duration) (s string) {
+	s = d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return
+}
+
+func (c Condition) formatScalar() (s string) {
+	switch {
+	case c.Dec != "":
+		s = exprKeywordDec + " " + string(c.Dec)
+	case c.Int != nil:
+		s = exprKeywordInt + " " + strconv.FormatInt(*c.Int, 10)
+	default:
+		s = c.formatVal(c.Val)
+	}
+	return
+}
+
+func (c Condition) formatVal(v float64) (s string) {
+	switch {
+	case !c.Relative:
+		s = formatNum(v)
+	case v > 0:
+		s = exprKeywordNow + " " + exprPlus + " " + formatNum(v)
+	case v < 0:
+		s = exprKeywordNow + " " + exprMinus + " " + formatNum(-v)
+	default:
+		s = exprKeywordNow
+	}
+	return
+}
+
+func formatNum(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func formatKey(k string) (s string) {
+	s = k
+	switch {
+	case k == exprKeywordIn, k == exprKeywordNot, k == exprKeywordCrosses, k == exprKeywordChanges, k == exprKeywordDeviates, k == exprKeywordHas, k == exprPlus, k == exprMinus, strings.ContainsAny(k, exprSpecialChars+globWildcards):
+		s = strconv.Quote(k)
+	default:
+		for _, r := range k {
+			if unicode.IsSpace(r) || !unicode.IsPrint(r) {
+				s = strconv.Quote(k)
+				break
+			}
+		}
+	}
+	return
+}
+
+type exprParser struct {
+	src string
+	pos int
+	// valCount is the count of the condition values parsed so far
+	valCount int
+}
+
+func (p *exprParser) parse() (cond Condition, err error) {
+	p.skipSpace()
+	notStart := p.pos
+	start := p.pos
+	w := p.word()
+	if w == exprKeywordNot {
+		// either the negation or the key-less "not in"
+		p.skipSpace()
+		start = p.pos
+		w = p.word()
+		switch w {
+		case exprKeywordIn:
+			p.pos = notStart
+			start = notStart
+			w = exprKeywordNot
+		default:
+			cond.Not = true
+		}
+	}
+	agg := parseAgg(w)
+	switch {
+	case agg != AggUndefined && p.consume("("):
+		err = p.window(&cond, agg)
+	case w == "", w == exprKeywordIn, w == exprKeywordNot, w == exprKeywordCrosses, w == exprKeywordChanges, w == exprKeywordDeviates, w == exprKeywordHas:
+		p.pos = start // key-less form
+		if p.pos < len(p.src) && p.src[p.pos] == '"' {
+			err = p.lhs(&cond)
+		}
+	default:
+		p.pos = start
+		err = p.lhs(&cond)
+	}
+	if err == nil {
+		start = p.pos
+		err = p.predicate(&cond)
+	}
+	if err == nil && !cond.Window.IsZero() {
+		switch {
+		case !cond.Op.IsComparison():
+			p.pos = start
+			err = p.errorf("windowed aggregate is supported by the comparison operators only")
+		case cond.isExact(), cond.Relative:
+			p.pos = start
+			err = p.errorf("windowed aggregate value should be absolute and not exact")
+		}
+	}
+	if err == nil {
+		if errNot := cond.ValidateNot(); errNot != nil {
+			p.pos = notStart
+			err = p.errorf("%s", errNot)
+		}
+	}
+	if err == nil {
+		cond.Unit, err = p.unit()
+	}
+	if err == nil {
+		p.skipSpace()
+		if p.pos < len(p.src) {
+			err = p.errorf("unexpected %q", p.src[p.pos:])
+		}
+	}
+	return
+}
+
+func (p *exprParser) unit() (u string, err error) {
+	p.skipSpace()
+	switch {
+	case p.pos < len(p.src) && p.src[p.pos] == '"':
+		u, err = p.quoted()
+	default:
+		u = p.word()
+	}
+	return
+}
+
+// lhs parses either the single key or the sum of the terms like "2 * a - b".
+func (p *exprParser) lhs(cond *Condition) (err error) {
+	var terms []Term
+	var keyMatches []KeyMatch
+	sign := 1.0
+	p.skipSpace()
+	lhsStart := p.pos
+	start := p.pos
+	switch p.word() {
+	case exprMinus:
+		sign = -1
+	case exprPlus:
+	default:
+		p.pos = start
+	}
+	for more := true; more && err == nil; {
+		t := Term{
+			Coef: sign,
+		}
+		// optional coefficient
+		p.skipSpace()
+		start = p.pos
+		w := p.word()
+		if coef, errCoef := strconv.ParseFloat(w, 64); errCoef == nil {
+			p.skipSpace()
+			switch p.word() {
+			case exprMul:
+				t.Coef *= coef
+				if !isFinite(coef) {
+					p.pos = start
+					err = p.errorf("invalid coefficient %q", w)
+				}
+			default:
+				p.pos = start
+			}
+		} else {
+			p.pos = start
+		}
+		var km KeyMatch
+		if err == nil {
+			t.Key, km, err = p.key()
+		}
+		if err == nil {
+			terms = append(terms, t)
+			keyMatches = append(keyMatches, km)
+			p.skipSpace()
+			start = p.pos
+			switch p.word() {
+			case exprPlus:
+				sign = 1
+			case exprMinus:
+				sign = -1
+			default:
+				p.pos = start
+				more = false
+			}
+		}
+	}
+	switch {
+	case err != nil:
+	case len(terms) == 1 && terms[0].Coef == 1:
+		cond.Key = terms[0].Key
+		cond.KeyMatch = keyMatches[0]
+	case slices.ContainsFunc(keyMatches, func(km KeyMatch) bool { return km != KeyMatchExact }):
+		p.pos = lhsStart
+		err = p.errorf("key pattern is not allowed in the sum of terms")
+	default:
+		cond.Terms = terms
+	}
+	return
+}
+
+func (p *exprParser) key() (key string, km KeyMatch, err error) {
+	p.skipSpace()
+	switch {
+	case p.pos < len(p.src) && p.src[p.pos] == '"':
+		key, err = p.quoted()
+		if err == nil && p.consume(exprKeyPrefixSuffix) {
+			km = KeyMatchPrefix
+		}
+	default:
+		w := p.word()
+		switch {
+		case w == "":
+			err = p.errorf("expected key")
+		case strings.HasSuffix(w, exprKeyPrefixSuffix) && !strings.ContainsAny(strings.TrimSuffix(w, exprKeyPrefixSuffix), globWildcards):
+			key = strings.TrimSuffix(w, exprKeyPrefixSuffix)
+			km = KeyMatchPrefix
+		case strings.ContainsAny(w, globWildcards):
+			key = w
+			km = KeyMatchGlob
+		default:
+			key = w
+		}
+	}
+	return
+}
+
+func (p *exprParser) predicate(cond *Condition) (err error) {
+	p.skipSpace()
+	start := p.pos
+	if p.consume("%") {
+		cond.Op = OpMod
+		err = p.mod(&cond.Mod)
+		return
+	}
+	cond.Op = p.comparison()
+	if cond.Op != OpUndefined {
+		p.skipSpace()
+		valStart := p.pos
+		switch p.word() {
+		case exprKeywordDec:
+			cond.Dec, err = p.dec()
+		case exprKeywordInt:
+			cond.Int, err = p.int()
+		default:
+			p.pos = valStart
+			cond.Val, err = p.val(cond)
+		}
+		if err == nil && cond.Op == OpEq {
+			err = p.tolerance(&cond.Tolerance)
+		}
+		return
+	}
+	switch p.word() {
+	case exprKeywordIn:
+		p.skipSpace()
+		switch {
+		case p.consume("{"):
+			cond.Op = OpIn
+			cond.Vals, err = p.set(cond)
+		case p.consume("["):
+			cond.Op = OpRange
+			cond.Range.MinInclusive = true
+			err = p.interval(cond)
+		case p.consume("("):
+			cond.Op = OpRange
+			err = p.interval(cond)
+		default:
+			err = p.errorf("expected \"{\", \"[\" or \"(\"")
+		}
+		if err == nil && cond.Op == OpRange {
+			err = p.cycle(cond)
+		}
+	case exprKeywordCrosses:
+		p.skipSpace()
+		switch p.word() {
+		case exprKeywordAbove:
+			cond.Op = OpCrossAbove
+		case exprKeywordBelow:
+			cond.Op = OpCrossBelow
+		default:
+			err = p.errorf("expected \"above\" or \"below\"")
+		}
+		if err == nil {
+			cond.Val, err = p.num()
+		}
+		if err == nil {
+			p.skipSpace()
+			start = p.pos
+			switch p.word() {
+			case exprKeywordHysteresis:
+				cond.Hysteresis, err = p.num()
+			default:
+				p.pos = start
+			}
+		}
+	case exprKeywordChanges:
+		cond.Op = OpChange
+		p.skipSpace()
+		switch p.word() {
+		case exprKeywordUp:
+			cond.Change.Dir = ChangeUp
+			p.skipSpace()
+			if p.word() != exprKeywordBy {
+				err = p.errorf("expected \"by\"")
+			}
+		case exprKeywordDown:
+			cond.Change.Dir = ChangeDown
+			p.skipSpace()
+			if p.word() != exprKeywordBy {
+				err = p.errorf("expected \"by\"")
+			}
+		case exprKeywordBy:
+		default:
+			err = p.errorf("expected \"up\", \"down\" or \"by\"")
+		}
+		if err == nil {
+			cond.Val, err = p.num()
+		}
+		if err == nil {
+			p.skipSpace()
+			if p.consume("%") {
+				cond.Val /= 100
+				cond.Change.Rel = true
+			}
+		}
+	case exprKeywordDeviates:
+		cond.Op = OpAnomaly
+		p.skipSpace()
+		if p.word() != exprKeywordBy {
+			err = p.errorf("expected \"by\"")
+		}
+		if err == nil {
+			cond.Val, err = p.num()
+		}
+		if err == nil {
+			p.skipSpace()
+			if p.word() != exprKeywordSigma {
+				err = p.errorf("expected \"sigma\"")
+			}
+		}
+	case exprKeywordHas:
+		p.skipSpace()
+		switch p.word() {
+		case exprKeywordAll:
+			cond.Op = OpBitsAllSet
+		case exprKeywordAny:
+			cond.Op = OpBitsAnySet
+		case exprKeywordNo:
+			cond.Op = OpBitsNoneSet
+		default:
+			err = p.errorf("expected \"all\", \"any\" or \"no\"")
+		}
+		if err == nil {
+			p.skipSpace()
+			if p.word() != exprKeywordBits {
+				err = p.errorf("expected \"bits\"")
+			}
+		}
+		if err == nil {
+			cond.Int, err = p.mask()
+		}
+	case exprKeywordNot:
+		p.skipSpace()
+		if p.word() != exprKeywordIn {
+			err = p.errorf("expected \"in\"")
+		}
+		if err == nil {
+			p.skipSpace()
+			if !p.consume("{") {
+				err = p.errorf("expected \"{\"")
+			}
+		}
+		if err == nil {
+			cond.Op = OpNotIn
+			cond.Vals, err = p.set(cond)
+		}
+	default:
+		p.pos = start
+		err = p.errorf("expected operator")
+	}
+	return
+}
+
+// cycle parses the optional period following the range like "cycle 24", it makes the range cyclic.
+func (p *exprParser) cycle(cond *Condition) (err error) {
+	p.skipSpace()
+	start := p.pos
+	if p.word() != exprKeywordCycle {
+		p.pos = start
+		return
+	}
+	cond.Op = OpCyclicRange
+	p.skipSpace()
+	periodStart := p.pos
+	cond.Period, err = p.num()
+	if err == nil {
+		_, err = cond.CyclicRange()
+		switch {
+		case err != nil:
+			p.pos = periodStart
+			err = p.errorf("%s", err)
+		case cond.Relative:
+			p.pos = start
+			err = p.errorf("cyclic range values should be absolute")
+		}
+	}
+	return
+}
+
+// mod parses the rest of the modulo condition like "1000 == 0" following the "%".
+func (p *exprParser) mod(m *Mod) (err error) {
+	p.skipSpace()
+	start := p.pos
+	var div, rem *int64
+	div, err = p.int()
+	if err == nil {
+		p.skipSpace()
+		if !p.consume("==") && !p.consume("=") {
+			err = p.errorf("expected \"==\"")
+		}
+	}
+	if err == nil {
+		rem, err = p.int()
+	}
+	if err == nil {
+		m.Div, m.Rem = *div, *rem
+		if errMod := m.Validate(); errMod != nil {
+			p.pos = start
+			err = p.errorf("%s", errMod)
+		}
+	}
+	return
+}
+
+// comparison consumes the comparison operator if any.
+func (p *exprParser) comparison() (op Op) {
+	switch {
+	case p.consume(">="):
+		op = OpGte
+	case p.consume("<="):
+		op = OpLte
+	case p.consume("!="):
+		op = OpNe
+	case p.consume("=="), p.consume("="):
+		op = OpEq
+	case p.consume(">"):
+		op = OpGt
+	case p.consume("<"):
+		op = OpLt
+	}
+	return
+}
+
+// window parses the rest of the windowed aggregate like "amount > 0) over tumbling 1h" following the "(".
+func (p *exprParser) window(cond *Condition, agg Agg) (err error) {
+	cond.Window.Agg = agg
+	p.skipSpace()
+	if p.pos < len(p.src) && !strings.ContainsRune("<>=!)", rune(p.src[p.pos])) {
+		cond.Key, cond.KeyMatch, err = p.key()
+	}
+	if err == nil {
+		p.skipSpace()
+		f := &cond.Window.Filter
+		if f.Op = p.comparison(); f.Op != OpUndefined {
+			f.Val, err = p.num()
+		}
+	}
+	if err == nil {
+		p.skipSpace()
+		if !p.consume(")") {
+			err = p.errorf("expected \")\"")
+		}
+	}
+	if err == nil {
+		p.skipSpace()
+		if p.word() != exprKeywordOver {
+			err = p.errorf("expected \"over\"")
+		}
+	}
+	if err == nil {
+		p.skipSpace()
+		start := p.pos
+		w := p.word()
+		if w == exprKeywordTumbling {
+			cond.Window.Tumbling = true
+			p.skipSpace()
+			start = p.pos
+			w = p.word()
+		}
+		cond.Window.Dur, err = time.ParseDuration(w)
+		if err != nil || cond.Window.Dur <= 0 {
+			p.pos = start
+			err = p.errorf("invalid duration %q", w)
+		}
+	}
+	return
+}
+
+func parseAgg(s string) (agg Agg) {
+	for a := AggCount; a <= AggMax; a++ {
+		if a.String() == s {
+			agg = a
+			break
+		}
+	}
+	return
+}
+
+func (p *exprParser) tolerance(t *Tolerance) (err error) {
+	for err == nil {
+		p.skipSpace()
+		if !p.consume("~") {
+			break
+		}
+		var v float64
+		v, err = p.num()
+		if err == nil {
+			p.skipSpace()
+			switch p.consume("%") {
+			case true:
+				t.Rel = v / 100
+			default:
+				t.Abs = v
+			}
+		}
+	}
+	return
+}
+
+func (p *exprParser) interval(cond *Condition) (err error) {
+	r := &cond.Range
+	r.Min, err = p.val(cond)
+	if err == nil {
+		p.skipSpace()
+		if !p.consume(",") {
+			err = p.errorf("expected \",\"")
+		}
+	}
+	if err == nil {
+		r.Max, err = p.val(cond)
+	}
+	if err == nil {
+		p.skipSpace()
+		switch {
+		case p.consume("]"):
+			r.MaxInclusive = true
+		case p.consume(")"):
+		default:
+			err = p.errorf("expected \"]\" or \")\"")
+		}
+	}
+	return
+}
+
+func (p *exprParser) set(cond *Condition) (vals []float64, err error) {
+	p.skipSpace()
+	if p.consume("}") {
+		return
+	}
+	for err == nil {
+		var v float64
+		v, err = p.val(cond)
+		if err == nil {
+			vals = append(vals, v)
+			p.skipSpace()
+			switch {
+			case p.consume(","):
+			case p.consume("}"):
+				return
+			default:
+				err = p.errorf("expected \",\" or \"}\"")
+			}
+		}
+	}
+	return
+}
+
+// val parses either the number or the offset from the current time like "now - 3600".
+func (p *exprParser) val(cond *Condition) (v float64, err error) {
+	p.skipSpace()
+	start := p.pos
+	relative := p.word() == exprKeywordNow
+	switch relative {
+	case true:
+		p.skipSpace()
+		signStart := p.pos
+		switch p.word() {
+		case exprPlus:
+			v, err = p.num()
+		case exprMinus:
+			v, err = p.num()
+			v = -v
+		default:
+			p.pos = signStart
+		}
+	default:
+		p.pos = start
+		v, err = p.num()
+	}
+	switch {
+	case err != nil:
+	case relative && len(cond.Terms) > 0:
+		p.pos = start
+		err = p.errorf("relative value is not allowed for the sum of terms")
+	case p.valCount == 0:
+		cond.Relative = relative
+	case cond.Relative != relative:
+		p.pos = start
+		err = p.errorf("relative and absolute values are mixed")
+	}
+	if err == nil {
+		p.valCount++
+	}
+	return
+}
+
+func (p *exprParser) dec() (d Decimal, err error) {
+	p.skipSpace()
+	start := p.pos
+	w := p.word()
+	switch w {
+	case "":
+		err = p.errorf("expected decimal")
+	default:
+		d, err = ParseDecimal(w)
+		if err != nil {
+			p.pos = start
+			err = p.errorf("invalid decimal %q", w)
+		}
+	}
+	return
+}
+
+func (p *exprParser) int() (i *int64, err error) {
+	p.skipSpace()
+	start := p.pos
+	w := p.word()
+	switch w {
+	case "":
+		err = p.errorf("expected integer")
+	default:
+		var v int64
+		v, err = strconv.ParseInt(w, 10, 64)
+		switch err {
+		case nil:
+			i = &v
+		default:
+			p.pos = start
+			err = p.errorf("invalid integer %q", w)
+		}
+	}
+	return
+}
+
+// mask parses the non-negative integer bit mask like "0x1f", "0b101" or "12".
+func (p *exprParser) mask() (m *int64, err error) {
+	p.skipSpace()
+	start := p.pos
+	w := p.word()
+	i, errParse := strconv.ParseInt(w, 0, 64)
+	switch {
+	case w == "":
+		err = p.errorf("expected bit mask")
+	case errParse != nil, i < 0:
+		p.pos = start
+		err = p.errorf("invalid bit mask %q", w)
+	default:
+		m = &i
+	}
+	return
+}
+
+func (p *exprParser) num() (v float64, err error) {
+	p.skipSpace()
+	start := p.pos
+	w := p.word()
+	switch w {
+	case "":
+		err = p.errorf("expected number")
+	default:
+		v, err = strconv.ParseFloat(w, 64)
+		// the NaN and the infinities are not numbers of the expression
+		if err != nil || !isFinite(v) {
+			p.pos = start
+			err = p.errorf("invalid number %q", w)
+		}
+	}
+	return
+}
+
+func (p *exprParser) quoted() (s string, err error) {
+	start := p.pos
+	end := p.pos + 1
+	for end < len(p.src) && p.src[end] != '"' {
+		if p.src[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	switch {
+	case end >= len(p.src):
+		err = p.errorf("unterminated quoted key")
+	default:
+		s, err = strconv.Unquote(p.src[start : end+1])
+		if err != nil {
+			err = p.errorf("invalid quoted key")
+		}
+	}
+	if err == nil {
+		p.pos = end + 1
+	}
+	return
+}
+
+// word consumes the longest run of characters that are neither spaces nor special characters.
+func (p *exprParser) word() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		if unicode.IsSpace(r) || strings.ContainsRune(exprSpecialChars, r) {
+			break
+		}
+		p.pos += size
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *exprParser) consume(s string) (ok bool) {
+	ok = strings.HasPrefix(p.src[p.pos:], s)
+	if ok {
+		p.pos += len(s)
+	}
+	return
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		p.pos += size
+	}
+}
+
+func (p *exprParser) errorf(format string, args ...any) error {
+	return ParseError{
+		Pos: p.pos,
+		Msg: fmt.Sprintf(format, args...),
+	}
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
@@ -0,0 +1,1084 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseCondition(t *testing.T) {
+	cases := map[string]struct {
+		src  string
+		cond Condition
+		err  error
+	}{
+		"gte": {
+			src: "price >= 10.5",
+			cond: Condition{
+				Key: "price",
+				Op:  OpGte,
+				Val: 10.5,
+			},
+		},
+		"lt negative without spaces": {
+			src: "temperature<-3",
+			cond: Condition{
+				Key: "temperature",
+				Op:  OpLt,
+				Val: -3,
+			},
+		},
+		"gt without key": {
+			src: " > 1e3 ",
+			cond: Condition{
+				Op:  OpGt,
+				Val: 1000,
+			},
+		},
+		"lte": {
+			src: "a.b.c <= 0",
+			cond: Condition{
+				Key: "a.b.c",
+				Op:  OpLte,
+			},
+		},
+		"eq": {
+			src: "x == 42",
+			cond: Condition{
+				Key: "x",
+				Op:  OpEq,
+				Val: 42,
+			},
+		},
+		"eq with tolerance": {
+			src: "ratio = 0.3 ~ 1e-9 ~ 1%",
+			cond: Condition{
+				Key: "ratio",
+				Op:  OpEq,
+				Val: 0.3,
+				Tolerance: Tolerance{
+					Abs: 1e-9,
+					Rel: 0.01,
+				},
+			},
+		},
+		"ne": {
+			src: "rating != 0",
+			cond: Condition{
+				Key: "rating",
+				Op:  OpNe,
+			},
+		},
+		"range": {
+			src: "price in [10, 20)",
+			cond: Condition{
+				Key: "price",
+				Op:  OpRange,
+				Range: Range{
+					Min:          10,
+					MinInclusive: true,
+					Max:          20,
+				},
+			},
+		},
+		"range without key": {
+			src: "in (10,20]",
+			cond: Condition{
+				Op: OpRange,
+				Range: Range{
+					Min:          10,
+					Max:          20,
+					MaxInclusive: true,
+				},
+			},
+		},
+		"in": {
+			src: "status_code in {500, 502}",
+			cond: Condition{
+				Key:  "status_code",
+				Op:   OpIn,
+				Vals: []float64{500, 502},
+			},
+		},
+		"not in without key": {
+			src: "not in {}",
+			cond: Condition{
+				Op: OpNotIn,
+			},
+		},
+		"quoted key": {
+			src: `"in" > 1`,
+			cond: Condition{
+				Key: "in",
+				Op:  OpGt,
+				Val: 1,
+			},
+		},
+		"glob key": {
+			src: "sensor.*.temperature > 50",
+			cond: Condition{
+				Key:      "sensor.*.temperature",
+				KeyMatch: KeyMatchGlob,
+				Op:       OpGt,
+				Val:      50,
+			},
+		},
+		"prefix key": {
+			src: "sensor.** > 50",
+			cond: Condition{
+				Key:      "sensor.",
+				KeyMatch: KeyMatchPrefix,
+				Op:       OpGt,
+				Val:      50,
+			},
+		},
+		"quoted prefix key": {
+			src: `"my sensor"** > 50`,
+			cond: Condition{
+				Key:      "my sensor",
+				KeyMatch: KeyMatchPrefix,
+				Op:       OpGt,
+				Val:      50,
+			},
+		},
+		"difference": {
+			src: "sale_price - list_price < 0",
+			cond: Condition{
+				Terms: []Term{
+					{
+						Key:  "sale_price",
+						Coef: 1,
+					},
+					{
+						Key:  "list_price",
+						Coef: -1,
+					},
+				},
+				Op: OpLt,
+			},
+		},
+		"sum with coefficients": {
+			src: "- used + 2 * reserved - 0.9 * quota > 0",
+			cond: Condition{
+				Terms: []Term{
+					{
+						Key:  "used",
+						Coef: -1,
+					},
+					{
+						Key:  "reserved",
+						Coef: 2,
+					},
+					{
+						Key:  "quota",
+						Coef: -0.9,
+					},
+				},
+				Op: OpGt,
+			},
+		},
+		"single term with coefficient": {
+			src: "2 * x >= 1",
+			cond: Condition{
+				Terms: []Term{
+					{
+						Key:  "x",
+						Coef: 2,
+					},
+				},
+				Op:  OpGte,
+				Val: 1,
+			},
+		},
+		"glob key in sum": {
+			src: "a + b.* > 0",
+			err: ParseError{
+				Msg: "key pattern is not allowed in the sum of terms",
+			},
+		},
+		"missing term key": {
+			src: "a + > 0",
+			err: ParseError{
+				Pos: 4,
+				Msg: "expected key",
+			},
+		},
+		"unit": {
+			src: "distance < 5 km",
+			cond: Condition{
+				Key:  "distance",
+				Op:   OpLt,
+				Val:  5,
+				Unit: "km",
+			},
+		},
+		"tolerance with unit": {
+			src: "t = 20 ~ 0.5 °C",
+			cond: Condition{
+				Key: "t",
+				Op:  OpEq,
+				Val: 20,
+				Tolerance: Tolerance{
+					Abs: 0.5,
+				},
+				Unit: "°C",
+			},
+		},
+		"relative": {
+			src: "published >= now - 86400",
+			cond: Condition{
+				Key:      "published",
+				Op:       OpGte,
+				Val:      -86400,
+				Relative: true,
+			},
+		},
+		"relative range with unit": {
+			src: "expires in (now, now + 7] d",
+			cond: Condition{
+				Key: "expires",
+				Op:  OpRange,
+				Range: Range{
+					Max:          7,
+					MaxInclusive: true,
+				},
+				Unit:     "d",
+				Relative: true,
+			},
+		},
+		"relative set": {
+			src: "t in {now - 1, now}",
+			cond: Condition{
+				Key:      "t",
+				Op:       OpIn,
+				Vals:     []float64{-1, 0},
+				Relative: true,
+			},
+		},
+		"key now": {
+			src: "now < now",
+			cond: Condition{
+				Key:      "now",
+				Op:       OpLt,
+				Relative: true,
+			},
+		},
+		"relative and absolute mixed": {
+			src: "t in [0, now]",
+			err: ParseError{
+				Pos: 9,
+				Msg: "relative and absolute values are mixed",
+			},
+		},
+		"relative sum": {
+			src: "a - b > now",
+			err: ParseError{
+				Pos: 8,
+				Msg: "relative value is not allowed for the sum of terms",
+			},
+		},
+		"relative missing offset": {
+			src: "t > now -",
+			err: ParseError{
+				Pos: 9,
+				Msg: "expected number",
+			},
+		},
+		"decimal": {
+			src: "price <= dec 19.990 USD",
+			cond: Condition{
+				Key:  "price",
+				Op:   OpLte,
+				Dec:  "19.99",
+				Unit: "USD",
+			},
+		},
+		"int": {
+			src: "id = int 9007199254740993",
+			cond: Condition{
+				Key: "id",
+				Op:  OpEq,
+				Int: ptr(int64(9007199254740993)),
+			},
+		},
+		"invalid int": {
+			src: "id = int 1.5",
+			err: ParseError{
+				Pos: 9,
+				Msg: `invalid integer "1.5"`,
+			},
+		},
+		"crosses above": {
+			src: `cpu.load crosses above 90 hysteresis 5 "%"`,
+			cond: Condition{
+				Key:        "cpu.load",
+				Op:         OpCrossAbove,
+				Val:        90,
+				Hysteresis: 5,
+				Unit:       "%",
+			},
+		},
+		"crosses below without key": {
+			src: "crosses below 10",
+			cond: Condition{
+				Op:  OpCrossBelow,
+				Val: 10,
+			},
+		},
+		"crosses sideways": {
+			src: "x crosses 10",
+			err: ParseError{
+				Pos: 12,
+				Msg: `expected "above" or "below"`,
+			},
+		},
+		"changes down by percent": {
+			src: "price changes down by 10%",
+			cond: Condition{
+				Key: "price",
+				Op:  OpChange,
+				Val: 0.1,
+				Change: Change{
+					Dir: ChangeDown,
+					Rel: true,
+				},
+			},
+		},
+		"changes by delta in unit": {
+			src: "temperature changes by 5 °C",
+			cond: Condition{
+				Key:  "temperature",
+				Op:   OpChange,
+				Val:  5,
+				Unit: "°C",
+			},
+		},
+		"changes up without key": {
+			src: "changes up by 1",
+			cond: Condition{
+				Op:  OpChange,
+				Val: 1,
+				Change: Change{
+					Dir: ChangeUp,
+				},
+			},
+		},
+		"changes up missing by": {
+			src: "x changes up 1",
+			err: ParseError{
+				Pos: 14,
+				Msg: `expected "by"`,
+			},
+		},
+		"avg over sliding window": {
+			src: "avg(latency) over 5m > 300 ms",
+			cond: Condition{
+				Key:  "latency",
+				Op:   OpGt,
+				Val:  300,
+				Unit: "ms",
+				Window: Window{
+					Agg: AggAvg,
+					Dur: 5 * time.Minute,
+				},
+			},
+		},
+		"count filtered over tumbling window": {
+			src: "count(amount > 0) over tumbling 1h > 100",
+			cond: Condition{
+				Key: "amount",
+				Op:  OpGt,
+				Val: 100,
+				Window: Window{
+					Agg:      AggCount,
+					Dur:      time.Hour,
+					Tumbling: true,
+					Filter: WindowFilter{
+						Op: OpGt,
+					},
+				},
+			},
+		},
+		"count without key": {
+			src: "count() over 1s >= 10",
+			cond: Condition{
+				Op:  OpGte,
+				Val: 10,
+				Window: Window{
+					Agg: AggCount,
+					Dur: time.Second,
+				},
+			},
+		},
+		"aggregate name as key": {
+			src: "count > 10",
+			cond: Condition{
+				Key: "count",
+				Op:  OpGt,
+				Val: 10,
+			},
+		},
+		"window invalid duration": {
+			src: "sum(x) over 1 > 0",
+			err: ParseError{
+				Pos: 12,
+				Msg: `invalid duration "1"`,
+			},
+		},
+		"window missing over": {
+			src: "sum(x) > 0",
+			err: ParseError{
+				Pos: 7,
+				Msg: `expected "over"`,
+			},
+		},
+		"window not comparison": {
+			src: "max(x) over 1m in [1, 2]",
+			err: ParseError{
+				Pos: 14,
+				Msg: "windowed aggregate is supported by the comparison operators only",
+			},
+		},
+		"window exact": {
+			src: "max(x) over 1m > int 1",
+			err: ParseError{
+				Pos: 14,
+				Msg: "windowed aggregate value should be absolute and not exact",
+			},
+		},
+		"deviates": {
+			src: "latency deviates by 3 sigma ms",
+			cond: Condition{
+				Key:  "latency",
+				Op:   OpAnomaly,
+				Val:  3,
+				Unit: "ms",
+			},
+		},
+		"deviates missing sigma": {
+			src: "latency deviates by 3",
+			err: ParseError{
+				Pos: 21,
+				Msg: `expected "sigma"`,
+			},
+		},
+		"not": {
+			src: "not x > 5",
+			cond: Condition{
+				Key: "x",
+				Op:  OpGt,
+				Val: 5,
+				Not: true,
+			},
+		},
+		"not without key": {
+			src: "not > 5",
+			cond: Condition{
+				Op:  OpGt,
+				Val: 5,
+				Not: true,
+			},
+		},
+		"not not in": {
+			src: "not status not in {200}",
+			cond: Condition{
+				Key:  "status",
+				Op:   OpNotIn,
+				Vals: []float64{200},
+				Not:  true,
+			},
+		},
+		"not terms": {
+			src: "not a - b < 0",
+			cond: Condition{
+				Terms: []Term{
+					{
+						Key:  "a",
+						Coef: 1,
+					},
+					{
+						Key:  "b",
+						Coef: -1,
+					},
+				},
+				Op:  OpLt,
+				Not: true,
+			},
+		},
+		"not stateful": {
+			src: "not cpu crosses above 90",
+			err: ParseError{
+				Msg: "negation is supported by the stateless conditions only: CrossAbove",
+			},
+		},
+		"not windowed": {
+			src: " not avg(x) over 1m > 1",
+			err: ParseError{
+				Pos: 1,
+				Msg: "negation is supported by the stateless conditions only: Gt",
+			},
+		},
+		"cyclic range": {
+			src: "hour in [22, 6) cycle 24",
+			cond: Condition{
+				Key: "hour",
+				Op:  OpCyclicRange,
+				Range: Range{
+					Min:          22,
+					MinInclusive: true,
+					Max:          6,
+				},
+				Period: 24,
+			},
+		},
+		"cyclic range with unit": {
+			src: "wind_direction in [350, 20] cycle 360 deg",
+			cond: Condition{
+				Key: "wind_direction",
+				Op:  OpCyclicRange,
+				Range: Range{
+					Min:          350,
+					MinInclusive: true,
+					Max:          20,
+					MaxInclusive: true,
+				},
+				Period: 360,
+				Unit:   "deg",
+			},
+		},
+		"cyclic range zero period": {
+			src: "hour in [22, 6) cycle 0",
+			err: ParseError{
+				Pos: 22,
+				Msg: "cyclic range period should be a positive finite number: 0",
+			},
+		},
+		"cyclic range relative": {
+			src: "t in [now, now + 10] cycle 60",
+			err: ParseError{
+				Pos: 21,
+				Msg: "cyclic range values should be absolute",
+			},
+		},
+		"mod": {
+			src: "block % 1000 == 0",
+			cond: Condition{
+				Key: "block",
+				Op:  OpMod,
+				Mod: Mod{
+					Div: 1000,
+				},
+			},
+		},
+		"mod without key": {
+			src: "% 2 = 1",
+			cond: Condition{
+				Op: OpMod,
+				Mod: Mod{
+					Div: 2,
+					Rem: 1,
+				},
+			},
+		},
+		"mod negative remainder": {
+			src: "x % 3 == -1",
+			cond: Condition{
+				Key: "x",
+				Op:  OpMod,
+				Mod: Mod{
+					Div: 3,
+					Rem: -1,
+				},
+			},
+		},
+		"mod zero divisor": {
+			src: "x % 0 == 0",
+			err: ParseError{
+				Pos: 4,
+				Msg: "invalid modulo: zero divisor",
+			},
+		},
+		"mod fraction divisor": {
+			src: "x % 2.5 == 0",
+			err: ParseError{
+				Pos: 4,
+				Msg: `invalid integer "2.5"`,
+			},
+		},
+		"mod remainder too big": {
+			src: "minute % 15 == 15",
+			err: ParseError{
+				Pos: 9,
+				Msg: "invalid modulo: remainder 15 should be less than the divisor 15 by the absolute value",
+			},
+		},
+		"mod without remainder": {
+			src: "x % 2",
+			err: ParseError{
+				Pos: 5,
+				Msg: `expected "=="`,
+			},
+		},
+		"has all bits": {
+			src: "flags has all bits 0x5",
+			cond: Condition{
+				Key: "flags",
+				Op:  OpBitsAllSet,
+				Int: ptr(int64(5)),
+			},
+		},
+		"has any bits without key": {
+			src: "has any bits 0b110",
+			cond: Condition{
+				Op:  OpBitsAnySet,
+				Int: ptr(int64(6)),
+			},
+		},
+		"has no bits": {
+			src: "permissions has no bits 8",
+			cond: Condition{
+				Key: "permissions",
+				Op:  OpBitsNoneSet,
+				Int: ptr(int64(8)),
+			},
+		},
+		"negative bit mask": {
+			src: "flags has all bits -1",
+			err: ParseError{
+				Pos: 19,
+				Msg: `invalid bit mask "-1"`,
+			},
+		},
+		"has some bits": {
+			src: "flags has some bits 1",
+			err: ParseError{
+				Pos: 14,
+				Msg: `expected "all", "any" or "no"`,
+			},
+		},
+		"invalid decimal": {
+			src: "price <= dec 0x10",
+			err: ParseError{
+				Pos: 13,
+				Msg: `invalid decimal "0x10"`,
+			},
+		},
+		"missing operator": {
+			src: "price 10",
+			err: ParseError{
+				Pos: 6,
+				Msg: "expected operator",
+			},
+		},
+		"invalid number": {
+			src: "price > ten",
+			err: ParseError{
+				Pos: 8,
+				Msg: `invalid number "ten"`,
+			},
+		},
+		"not a number": {
+			src: "price > NaN",
+			err: ParseError{
+				Pos: 8,
+				Msg: `invalid number "NaN"`,
+			},
+		},
+		"infinite number": {
+			src: "price < +Inf",
+			err: ParseError{
+				Pos: 8,
+				Msg: `invalid number "+Inf"`,
+			},
+		},
+		"infinite coefficient": {
+			src: "a + Inf * b > 0",
+			err: ParseError{
+				Pos: 4,
+				Msg: `invalid coefficient "Inf"`,
+			},
+		},
+		"missing number": {
+			src: "price >",
+			err: ParseError{
+				Pos: 7,
+				Msg: "expected number",
+			},
+		},
+		"unexpected tail": {
+			src: "price > 1 USD 2",
+			err: ParseError{
+				Pos: 14,
+				Msg: `unexpected "2"`,
+			},
+		},
+		"unclosed set": {
+			src: "x in {1, 2",
+			err: ParseError{
+				Pos: 10,
+				Msg: `expected "," or "}"`,
+			},
+		},
+		"unterminated quoted key": {
+			src: `"x > 1`,
+			err: ParseError{
+				Msg: "unterminated quoted key",
+			},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			cond, err := ParseCondition(c.src)
+			assert.Equal(t, c.err, err)
+			if c.err == nil {
+				assert.Equal(t, c.cond, cond)
+			}
+		})
+	}
+}
+
+func TestCondition_String(t *testing.T) {
+	cases := map[string]struct {
+		cond Condition
+		str  string
+	}{
+		"gt": {
+			cond: Condition{
+				Key: "price",
+				Op:  OpGt,
+				Val: 10.5,
+			},
+			str: "price > 10.5",
+		},
+		"gte without key": {
+			cond: Condition{
+				Op:  OpGte,
+				Val: -3,
+			},
+			str: ">= -3",
+		},
+		"eq with tolerance": {
+			cond: Condition{
+				Key: "ratio",
+				Op:  OpEq,
+				Val: 0.3,
+				Tolerance: Tolerance{
+					Rel: 0.05,
+				},
+			},
+			str: "ratio = 0.3 ~ 5%",
+		},
+		"lte": {
+			cond: Condition{
+				Key: "k",
+				Op:  OpLte,
+				Val: 1e21,
+			},
+			str: "k <= 1e+21",
+		},
+		"lt": {
+			cond: Condition{
+				Key: "k",
+				Op:  OpLt,
+			},
+			str: "k < 0",
+		},
+		"ne": {
+			cond: Condition{
+				Key: "k",
+				Op:  OpNe,
+			},
+			str: "k != 0",
+		},
+		"range": {
+			cond: Condition{
+				Key: "k",
+				Op:  OpRange,
+				Range: Range{
+					Min:          -1,
+					Max:          1,
+					MaxInclusive: true,
+				},
+			},
+			str: "k in (-1, 1]",
+		},
+		"in": {
+			cond: Condition{
+				Key:  "k",
+				Op:   OpIn,
+				Vals: []float64{1, 2},
+			},
+			str: "k in {1, 2}",
+		},
+		"not in": {
+			cond: Condition{
+				Key:  "k",
+				Op:   OpNotIn,
+				Vals: []float64{1},
+			},
+			str: "k not in {1}",
+		},
+		"quoted key": {
+			cond: Condition{
+				Key: "key with spaces",
+				Op:  OpGt,
+			},
+			str: `"key with spaces" > 0`,
+		},
+		"glob key": {
+			cond: Condition{
+				Key:      "cpu?.load",
+				KeyMatch: KeyMatchGlob,
+				Op:       OpGt,
+			},
+			str: "cpu?.load > 0",
+		},
+		"prefix key": {
+			cond: Condition{
+				Key:      "cpu",
+				KeyMatch: KeyMatchPrefix,
+				Op:       OpGt,
+			},
+			str: "cpu** > 0",
+		},
+		"exact key with wildcard": {
+			cond: Condition{
+				Key: "cpu*",
+				Op:  OpGt,
+			},
+			str: `"cpu*" > 0`,
+		},
+		"sum": {
+			cond: Condition{
+				Terms: []Term{
+					{
+						Key:  "used",
+						Coef: -1,
+					},
+					{
+						Key:  "reserved",
+						Coef: 1,
+					},
+					{
+						Key:  "-",
+						Coef: -2.5,
+					},
+				},
+				Op:  OpLte,
+				Val: 3,
+			},
+			str: `- used + reserved - 2.5 * "-" <= 3`,
+		},
+		"range with unit": {
+			cond: Condition{
+				Key: "size",
+				Op:  OpRange,
+				Range: Range{
+					Min: 1,
+					Max: 2,
+				},
+				Unit: "MiB",
+			},
+			str: "size in (1, 2) MiB",
+		},
+		"relative": {
+			cond: Condition{
+				Key:      "published",
+				Op:       OpGte,
+				Val:      -86400,
+				Relative: true,
+			},
+			str: "published >= now - 86400",
+		},
+		"relative range": {
+			cond: Condition{
+				Key: "expires",
+				Op:  OpRange,
+				Range: Range{
+					MinInclusive: true,
+					Max:          604800,
+				},
+				Relative: true,
+			},
+			str: "expires in [now, now + 604800)",
+		},
+		"decimal": {
+			cond: Condition{
+				Key: "price",
+				Op:  OpEq,
+				Dec: "19.99",
+				Tolerance: Tolerance{
+					Abs: 0.01,
+				},
+			},
+			str: "price = dec 19.99 ~ 0.01",
+		},
+		"int": {
+			cond: Condition{
+				Key: "bytes",
+				Op:  OpGt,
+				Int: ptr(int64(-9223372036854775808)),
+			},
+			str: "bytes > int -9223372036854775808",
+		},
+		"crosses above": {
+			cond: Condition{
+				Key:        "cpu",
+				Op:         OpCrossAbove,
+				Val:        90,
+				Hysteresis: 5,
+			},
+			str: "cpu crosses above 90 hysteresis 5",
+		},
+		"crosses below": {
+			cond: Condition{
+				Key: "crosses",
+				Op:  OpCrossBelow,
+				Val: 10,
+			},
+			str: `"crosses" crosses below 10`,
+		},
+		"changes down by percent": {
+			cond: Condition{
+				Key: "changes",
+				Op:  OpChange,
+				Val: 0.1,
+				Change: Change{
+					Dir: ChangeDown,
+					Rel: true,
+				},
+			},
+			str: `"changes" changes down by 10%`,
+		},
+		"window": {
+			cond: Condition{
+				Key: "amount",
+				Op:  OpGte,
+				Val: 1000,
+				Window: Window{
+					Agg:      AggSum,
+					Dur:      90 * time.Minute,
+					Tumbling: true,
+					Filter: WindowFilter{
+						Op:  OpLt,
+						Val: -1,
+					},
+				},
+			},
+			str: "sum(amount < -1) over tumbling 1h30m >= 1000",
+		},
+		"window without key": {
+			cond: Condition{
+				Op:  OpLt,
+				Val: 1,
+				Window: Window{
+					Agg: AggMin,
+					Dur: time.Hour,
+					Filter: WindowFilter{
+						Op: OpNe,
+					},
+				},
+			},
+			str: "min(!= 0) over 1h < 1",
+		},
+		"not": {
+			cond: Condition{
+				Key: "status_code",
+				Op:  OpRange,
+				Range: Range{
+					Min:          200,
+					MinInclusive: true,
+					Max:          300,
+				},
+				Not: true,
+			},
+			str: "not status_code in [200, 300)",
+		},
+		"not key": {
+			cond: Condition{
+				Key: "not",
+				Op:  OpGt,
+				Val: 1,
+				Not: true,
+			},
+			str: `not "not" > 1`,
+		},
+		"cyclic range": {
+			cond: Condition{
+				Key: "weekday",
+				Op:  OpCyclicRange,
+				Range: Range{
+					Min:          5,
+					MinInclusive: true,
+					Max:          0,
+					MaxInclusive: true,
+				},
+				Period: 7,
+			},
+			str: "weekday in [5, 0] cycle 7",
+		},
+		"mod": {
+			cond: Condition{
+				Key: "minute",
+				Op:  OpMod,
+				Mod: Mod{
+					Div: 15,
+				},
+			},
+			str: "minute % 15 == 0",
+		},
+		"has all bits": {
+			cond: Condition{
+				Key: "has",
+				Op:  OpBitsAllSet,
+				Int: ptr(int64(0x1f)),
+			},
+			str: `"has" has all bits 0x1f`,
+		},
+		"has no bits": {
+			cond: Condition{
+				Key: "flags",
+				Op:  OpBitsNoneSet,
+				Int: ptr(int64(0)),
+			},
+			str: "flags has no bits 0x0",
+		},
+		"deviates": {
+			cond: Condition{
+				Key: "deviates",
+				Op:  OpAnomaly,
+				Val: 2.5,
+			},
+			str: `"deviates" deviates by 2.5 sigma`,
+		},
+		"changes by delta": {
+			cond: Condition{
+				Key:  "price",
+				Op:   OpChange,
+				Val:  5,
+				Unit: "USD",
+			},
+			str: "price changes by 5 USD",
+		},
+		"keyword key": {
+			cond: Condition{
+				Key: "not",
+				Op:  OpGt,
+			},
+			str: `"not" > 0`,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			str := c.cond.String()
+			assert.Equal(t, c.str, str)
+			cond, err := ParseCondition(str)
+			assert.Nil(t, err)
+			assert.Equal(t, c.cond, cond)
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
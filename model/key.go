@@ -0,0 +1,129 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// KeyMatch defines how the condition key is matched against the attribute key.
+type KeyMatch int
+
+const (
+	KeyMatchExact KeyMatch = iota
+	// KeyMatchPrefix matches any attribute key starting with the condition key.
+	KeyMatchPrefix
+	// KeyMatchGlob matches the attribute key against the condition key pattern: "*" matches any run of characters
+	// and "?" matches any single character, both within a single "." separated key segment.
+	KeyMatchGlob
+)
+
+const keySep = '.'
+const globAny = '*'
+const globOne = '?'
+const globWildcards = "*?"
+
+func (km KeyMatch) String() string {
+	return [...]string{
+		"Exact",
+		"Prefix",
+		"Glob",
+	}[km]
+}
+
+// MatchesKey reports whether the condition key matches the attribute key. The empty condition key matches any key.
+func (c Condition) MatchesKey(key string) (matches bool) {
+	switch {
+	case c.Key == "":
+		matches = true
+	case c.KeyMatch == KeyMatchPrefix:
+		matches = strings.HasPrefix(key, c.Key)
+	case c.KeyMatch == KeyMatchGlob:
+		matches = globMatch(c.Key, key)
+	default:
+		matches = c.Key == key
+	}
+	return
+}
+
+// KeyLiteralPrefix returns the part of the condition key preceding any wildcard.
+// Any attribute key matching the condition starts with this prefix.
+func (c Condition) KeyLiteralPrefix() (prefix string) {
+	prefix = c.Key
+	if c.KeyMatch == KeyMatchGlob {
+		if i := strings.IndexAny(c.Key, globWildcards); i >= 0 {
+			prefix = c.Key[:i]
+		}
+	}
+	return
+}
+
+// GlobRegexp returns the anchored regular expression equivalent to the glob key pattern.
+func GlobRegexp(pattern string) string {
+	var sb strings.Builder
+	sb.WriteByte('^')
+	for _, r := range pattern {
+		switch r {
+		case globAny:
+			sb.WriteString(`[^.]*`)
+		case globOne:
+			sb.WriteString(`[^.]`)
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteByte('$')
+	return sb.String()
+}
+
+// KeyPrefixes returns all prefixes of the key including the empty one and the key itself.
+func KeyPrefixes(key string) (prefixes []string) {
+	prefixes = append(prefixes, "")
+	for i := range key {
+		if i > 0 {
+			prefixes = append(prefixes, key[:i])
+		}
+	}
+	if key != "" {
+		prefixes = append(prefixes, key)
+	}
+	return
+}
+
+func globMatch(pattern, key string) bool {
+	for len(pattern) > 0 {
+		r, size := utf8.DecodeRuneInString(pattern)
+		switch r {
+		case globAny:
+			// try every possible length of the run within the current segment
+			rest := pattern[size:]
+			for i := 0; ; {
+				if globMatch(rest, key[i:]) {
+					return true
+				}
+				if i >= len(key) {
+					return false
+				}
+				kr, kSize := utf8.DecodeRuneInString(key[i:])
+				if kr == keySep {
+					return false
+				}
+				i += kSize
+			}
+		case globOne:
+			kr, kSize := utf8.DecodeRuneInString(key)
+			if kSize == 0 || kr == keySep {
+				return false
+			}
+			key = key[kSize:]
+		default:
+			kr, kSize := utf8.DecodeRuneInString(key)
+			if kSize == 0 || kr != r {
+				return false
+			}
+			key = key[kSize:]
+		}
+		pattern = pattern[size:]
+	}
+	return key == ""
+}
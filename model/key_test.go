@@ -0,0 +1,119 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+)
+
+func TestKeyMatch_String(t *testing.T) {
+	assert.Equal(t, "Exact", KeyMatchExact.String())
+	assert.Equal(t, "Prefix", KeyMatchPrefix.String())
+	assert.Equal(t, "Glob", KeyMatchGlob.String())
+}
+
+func TestCondition_MatchesKey(t *testing.T) {
+	cases := map[string]struct {
+		key      string
+		keyMatch KeyMatch
+		attrKey  string
+		matches  bool
+	}{
+		"empty matches any": {
+			attrKey: "price",
+			matches: true,
+		},
+		"exact": {
+			key:     "price",
+			attrKey: "price",
+			matches: true,
+		},
+		"exact mismatch": {
+			key:     "price",
+			attrKey: "price.usd",
+		},
+		"prefix": {
+			key:      "sensor.",
+			keyMatch: KeyMatchPrefix,
+			attrKey:  "sensor.a.temperature",
+			matches:  true,
+		},
+		"prefix mismatch": {
+			key:      "sensor.",
+			keyMatch: KeyMatchPrefix,
+			attrKey:  "sensor",
+		},
+		"glob segment": {
+			key:      "sensor.*.temperature",
+			keyMatch: KeyMatchGlob,
+			attrKey:  "sensor.kitchen.temperature",
+			matches:  true,
+		},
+		"glob empty segment": {
+			key:      "sensor.*.temperature",
+			keyMatch: KeyMatchGlob,
+			attrKey:  "sensor..temperature",
+			matches:  true,
+		},
+		"glob does not cross segments": {
+			key:      "sensor.*.temperature",
+			keyMatch: KeyMatchGlob,
+			attrKey:  "sensor.kitchen.a.temperature",
+		},
+		"glob single char": {
+			key:      "cpu?.load",
+			keyMatch: KeyMatchGlob,
+			attrKey:  "cpu7.load",
+			matches:  true,
+		},
+		"glob single char mismatch": {
+			key:      "cpu?.load",
+			keyMatch: KeyMatchGlob,
+			attrKey:  "cpu17.load",
+		},
+		"glob unicode": {
+			key:      "t?",
+			keyMatch: KeyMatchGlob,
+			attrKey:  "té",
+			matches:  true,
+		},
+		"glob trailing": {
+			key:      "price*",
+			keyMatch: KeyMatchGlob,
+			attrKey:  "price_usd",
+			matches:  true,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			cond := Condition{
+				Key:      c.key,
+				KeyMatch: c.keyMatch,
+			}
+			assert.Equal(t, c.matches, cond.MatchesKey(c.attrKey))
+			if c.keyMatch == KeyMatchGlob {
+				assert.Equal(t, c.matches, regexp.MustCompile(GlobRegexp(c.key)).MatchString(c.attrKey))
+			}
+			if c.matches && c.key != "" {
+				assert.Contains(t, KeyPrefixes(c.attrKey), cond.KeyLiteralPrefix())
+			}
+		})
+	}
+}
+
+func TestCondition_KeyLiteralPrefix(t *testing.T) {
+	assert.Equal(t, "price", Condition{Key: "price"}.KeyLiteralPrefix())
+	assert.Equal(t, "price*", Condition{Key: "price*", KeyMatch: KeyMatchPrefix}.KeyLiteralPrefix())
+	assert.Equal(t, "sensor.", Condition{Key: "sensor.*.t?", KeyMatch: KeyMatchGlob}.KeyLiteralPrefix())
+	assert.Equal(t, "", Condition{Key: "?", KeyMatch: KeyMatchGlob}.KeyLiteralPrefix())
+}
+
+func TestGlobRegexp(t *testing.T) {
+	assert.Equal(t, `^a\.[^.]*\.b[^.]$`, GlobRegexp("a.*.b?"))
+}
+
+func TestKeyPrefixes(t *testing.T) {
+	assert.Equal(t, []string{""}, KeyPrefixes(""))
+	assert.Equal(t, []string{"", "a", "a.", "a.b"}, KeyPrefixes("a.b"))
+	assert.Equal(t, []string{"", "é", "éa"}, KeyPrefixes("éa"))
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Mod defines the modulo condition: the integer value matches when the remainder of its division by Div is Rem.
+// The remainder has the sign of the value like the Go "%" operator, e.g. -7 % 3 == -1.
+type Mod struct {
+	Div int64
+	Rem int64
+}
+
+var ErrInvalidMod = errors.New("invalid modulo")
+
+// Validate returns ErrInvalidMod when the divisor is zero or the remainder is not less than the divisor by the
+// absolute value, the condition would never match then.
+func (m Mod) Validate() (err error) {
+	switch {
+	case m.Div == 0:
+		err = fmt.Errorf("%w: zero divisor", ErrInvalidMod)
+	case absInt(m.Rem) >= absInt(m.Div):
+		err = fmt.Errorf("%w: remainder %d should be less than the divisor %d by the absolute value", ErrInvalidMod, m.Rem, m.Div)
+	}
+	return
+}
+
+func (m Mod) Matches(i int64) (matches bool) {
+	if m.Div != 0 {
+		matches = i%m.Div == m.Rem
+	}
+	return
+}
+
+func absInt(i int64) (a uint64) {
+	switch {
+	case i < 0:
+		a = uint64(-(i + 1)) + 1
+	default:
+		a = uint64(i)
+	}
+	return
+}
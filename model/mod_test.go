@@ -0,0 +1,116 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestMod_Validate(t *testing.T) {
+	cases := map[string]struct {
+		mod Mod
+		err error
+	}{
+		"ok": {
+			mod: Mod{
+				Div: 2,
+				Rem: 1,
+			},
+		},
+		"negative": {
+			mod: Mod{
+				Div: -3,
+				Rem: -2,
+			},
+		},
+		"zero divisor": {
+			err: ErrInvalidMod,
+		},
+		"remainder equals divisor": {
+			mod: Mod{
+				Div: 2,
+				Rem: 2,
+			},
+			err: ErrInvalidMod,
+		},
+		"remainder of min int": {
+			mod: Mod{
+				Div: math.MaxInt64,
+				Rem: math.MinInt64,
+			},
+			err: ErrInvalidMod,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.ErrorIs(t, c.mod.Validate(), c.err)
+		})
+	}
+}
+
+func TestCondition_MatchesAttr_Mod(t *testing.T) {
+	cases := map[string]struct {
+		mod     Mod
+		attr    Attr
+		matches bool
+	}{
+		"even": {
+			mod: Mod{
+				Div: 2,
+			},
+			attr: Attr{
+				Val: 42,
+			},
+			matches: true,
+		},
+		"odd": {
+			mod: Mod{
+				Div: 2,
+			},
+			attr: Attr{
+				Val: 43,
+			},
+		},
+		"every 1000th": {
+			mod: Mod{
+				Div: 1000,
+			},
+			attr: Attr{
+				Int: ptr(int64(9007199254741000)),
+			},
+			matches: true,
+		},
+		"negative": {
+			mod: Mod{
+				Div: 3,
+				Rem: -1,
+			},
+			attr: Attr{
+				Dec: "-7",
+			},
+			matches: true,
+		},
+		"fraction": {
+			mod: Mod{
+				Div: 1,
+			},
+			attr: Attr{
+				Val: 1.5,
+			},
+		},
+		"zero divisor": {
+			attr: Attr{
+				Val: 1,
+			},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			cond := Condition{
+				Op:  OpMod,
+				Mod: c.mod,
+			}
+			assert.Equal(t, c.matches, cond.MatchesAttr(c.attr))
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+)
+
+// KeyNorm defines the attribute key normalization applied to both the condition and the attribute keys, e.g. to
+// match "Price " with "price". The zero KeyNorm keeps the keys as is.
+type KeyNorm struct {
+	// Trim removes the leading and the trailing whitespace.
+	Trim bool
+	// Fold applies the Unicode case folding, e.g. "Straße" becomes "strasse".
+	Fold bool
+	// Nfc converts the key to the Unicode normalization form C.
+	Nfc bool
+	// Sep replaces every run of the whitespace, "-" and "_" characters within the key when not empty.
+	// The "." is kept as it separates the key segments, see KeyMatchGlob.
+	Sep string
+}
+
+func (kn KeyNorm) IsZero() bool {
+	return !kn.Trim && !kn.Fold && !kn.Nfc && kn.Sep == ""
+}
+
+// Normalize returns the normalized key.
+func (kn KeyNorm) Normalize(k string) string {
+	if kn.Nfc {
+		k = norm.NFC.String(k)
+	}
+	if kn.Trim {
+		k = strings.TrimSpace(k)
+	}
+	if kn.Fold {
+		// the caser is stateful, so it's not shared
+		k = cases.Fold().String(k)
+	}
+	if kn.Sep != "" {
+		k = kn.unifySep(k)
+	}
+	return k
+}
+
+// NormalizeCondition returns the condition having the key and the terms keys normalized.
+func (kn KeyNorm) NormalizeCondition(src Condition) (dst Condition) {
+	dst = src
+	dst.Key = kn.Normalize(src.Key)
+	if len(src.Terms) > 0 {
+		dst.Terms = make([]Term, len(src.Terms))
+		for i, t := range src.Terms {
+			dst.Terms[i] = Term{
+				Key:  kn.Normalize(t.Key),
+				Coef: t.Coef,
+			}
+		}
+	}
+	return
+}
+
+func (kn KeyNorm) unifySep(k string) string {
+	var sb strings.Builder
+	var inSep bool
+	for _, r := range k {
+		switch {
+		case unicode.IsSpace(r), r == '-', r == '_':
+			if !inSep {
+				sb.WriteString(kn.Sep)
+			}
+			inSep = true
+		default:
+			sb.WriteRune(r)
+			inSep = false
+		}
+	}
+	return sb.String()
+}
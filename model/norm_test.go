@@ -0,0 +1,86 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestKeyNorm_Normalize(t *testing.T) {
+	cases := map[string]struct {
+		kn  KeyNorm
+		src string
+		dst string
+	}{
+		"zero": {
+			src: " Price ",
+			dst: " Price ",
+		},
+		"trim": {
+			kn: KeyNorm{
+				Trim: true,
+			},
+			src: " Price\t",
+			dst: "Price",
+		},
+		"fold": {
+			kn: KeyNorm{
+				Fold: true,
+			},
+			src: "Straße.PRICE",
+			dst: "strasse.price",
+		},
+		"nfc": {
+			kn: KeyNorm{
+				Nfc: true,
+			},
+			src: "café",
+			dst: "café",
+		},
+		"separator": {
+			kn: KeyNorm{
+				Sep: "_",
+			},
+			src: "list - price.unit_cost",
+			dst: "list_price.unit_cost",
+		},
+		"all": {
+			kn: KeyNorm{
+				Trim: true,
+				Fold: true,
+				Nfc:  true,
+				Sep:  "_",
+			},
+			src: " List Price ",
+			dst: "list_price",
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.dst, c.kn.Normalize(c.src))
+		})
+	}
+}
+
+func TestKeyNorm_NormalizeCondition(t *testing.T) {
+	kn := KeyNorm{
+		Trim: true,
+		Fold: true,
+	}
+	src := Condition{
+		Terms: []Term{
+			{
+				Key:  "Sale_Price ",
+				Coef: 1,
+			},
+			{
+				Key:  "LIST_PRICE",
+				Coef: -1,
+			},
+		},
+		Op: OpLt,
+	}
+	dst := kn.NormalizeCondition(src)
+	assert.Equal(t, []Term{{Key: "sale_price", Coef: 1}, {Key: "list_price", Coef: -1}}, dst.Terms)
+	assert.Equal(t, "Sale_Price ", src.Terms[0].Key)
+	assert.Equal(t, "", dst.Key)
+}
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidNot = errors.New("negation is supported by the stateless conditions only")
+
+// IsStateful reports whether the condition depends on the previously observed values, see Op.IsStateful.
+func (c Condition) IsStateful() bool {
+	return c.Op.IsStateful() || !c.Window.IsZero()
+}
+
+// ValidateNot returns ErrInvalidNot when the condition is negated but stateful: the state is updated by the values
+// selected by the condition, so the inverted selection would break it.
+func (c Condition) ValidateNot() (err error) {
+	if c.Not && c.IsStateful() {
+		err = fmt.Errorf("%w: %s", ErrInvalidNot, c.Op)
+	}
+	return
+}
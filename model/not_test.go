@@ -0,0 +1,138 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCondition_MatchesAttr_Not(t *testing.T) {
+	cases := map[string]struct {
+		cond    Condition
+		attr    Attr
+		matches bool
+	}{
+		"not gt": {
+			cond: Condition{
+				Key: "x",
+				Op:  OpGt,
+				Val: 5,
+				Not: true,
+			},
+			attr: Attr{
+				Key: "x",
+				Val: 5,
+			},
+			matches: true,
+		},
+		"not gt fails": {
+			cond: Condition{
+				Key: "x",
+				Op:  OpGt,
+				Val: 5,
+				Not: true,
+			},
+			attr: Attr{
+				Key: "x",
+				Val: 6,
+			},
+		},
+		"other key": {
+			cond: Condition{
+				Key: "x",
+				Op:  OpGt,
+				Val: 5,
+				Not: true,
+			},
+			attr: Attr{
+				Key: "y",
+				Val: 1,
+			},
+		},
+		"other unit": {
+			cond: Condition{
+				Key:  "x",
+				Op:   OpGt,
+				Val:  5,
+				Unit: "m",
+				Not:  true,
+			},
+			attr: Attr{
+				Key: "x",
+				Val: 1,
+			},
+		},
+		"any key": {
+			cond: Condition{
+				Op:  OpEq,
+				Val: 0,
+				Not: true,
+			},
+			attr: Attr{
+				Key: "y",
+				Val: 1,
+			},
+			matches: true,
+		},
+		"not bits of fraction": {
+			cond: Condition{
+				Op:  OpBitsAnySet,
+				Int: ptr(int64(1)),
+				Not: true,
+			},
+			attr: Attr{
+				Val: 1.5,
+			},
+			matches: true,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.matches, c.cond.MatchesAttrAt(c.attr, time.Now()))
+		})
+	}
+}
+
+func TestCondition_MatchesAttrs_Not(t *testing.T) {
+	cond := Condition{
+		Terms: []Term{
+			{
+				Key:  "a",
+				Coef: 1,
+			},
+			{
+				Key:  "b",
+				Coef: -1,
+			},
+		},
+		Op:  OpLt,
+		Not: true,
+	}
+	assert.True(t, cond.MatchesAttrs(map[string]float64{"a": 2, "b": 1}))
+	assert.False(t, cond.MatchesAttrs(map[string]float64{"a": 1, "b": 2}))
+	assert.True(t, cond.MatchesAttrs(map[string]float64{"a": 1}))
+}
+
+func TestCondition_MatchesAttrs_NotAbsent(t *testing.T) {
+	cond := Condition{
+		Key: "x",
+		Op:  OpGt,
+		Val: 5,
+		Not: true,
+	}
+	assert.True(t, cond.MatchesAttrs(map[string]float64{"y": 1}))
+	assert.False(t, cond.MatchesAttrs(map[string]float64{"x": 1}))
+	cond.Not = false
+	assert.False(t, cond.MatchesAttrs(map[string]float64{"y": 1}))
+	cond.Not = true
+	cond.KeyMatch = KeyMatchGlob
+	cond.Key = "x*"
+	assert.False(t, cond.MatchesAttrs(map[string]float64{"y": 1}))
+}
+
+func TestCondition_ValidateNot(t *testing.T) {
+	assert.Nil(t, Condition{Op: OpGt, Not: true}.ValidateNot())
+	assert.Nil(t, Condition{Op: OpChange}.ValidateNot())
+	assert.ErrorIs(t, Condition{Op: OpChange, Not: true}.ValidateNot(), ErrInvalidNot)
+	assert.ErrorIs(t, Condition{Op: OpGt, Window: Window{Agg: AggCount, Dur: time.Minute}, Not: true}.ValidateNot(), ErrInvalidNot)
+}
@@ -1,5 +1,7 @@
 package model
 
+import "strconv"
+
 type Op int
 
 const (
@@ -9,15 +11,99 @@ const (
 	OpEq
 	OpLte
 	OpLt
+	OpNe
+	OpRange
+	OpIn
+	OpNotIn
+	// OpCrossAbove is the stateful condition firing once the value goes above Val, see Condition.Crossing.
+	OpCrossAbove
+	// OpCrossBelow is the stateful condition firing once the value goes below Val, see Condition.Crossing.
+	OpCrossBelow
+	// OpChange is the stateful condition comparing the value with the previous one, see Condition.Changed.
+	OpChange
+	// OpAnomaly is the stateful condition matching the value deviating from the running mean, see Condition.Deviates.
+	OpAnomaly
+	// OpBitsAllSet matches the integer value having all the bits of the mask set, see Condition.BitMask.
+	OpBitsAllSet
+	// OpBitsAnySet matches the integer value having any bit of the mask set.
+	OpBitsAnySet
+	// OpBitsNoneSet matches the integer value having no bits of the mask set.
+	OpBitsNoneSet
+	// OpMod matches the integer value having the remainder of the division by the divisor, see Condition.Mod.
+	OpMod
+	// OpCyclicRange matches the value within the range wrapping around the period, see Range.ContainsCyclic.
+	OpCyclicRange
 )
 
-func (op Op) String() string {
-	return [...]string{
-		"Undefined",
-		"Gt",
-		"Gte",
-		"Eq",
-		"Lte",
-		"Lt",
-	}[op]
+var opStrings = [...]string{
+	"Undefined",
+	"Gt",
+	"Gte",
+	"Eq",
+	"Lte",
+	"Lt",
+	"Ne",
+	"Range",
+	"In",
+	"NotIn",
+	"CrossAbove",
+	"CrossBelow",
+	"Change",
+	"Anomaly",
+	"BitsAllSet",
+	"BitsAnySet",
+	"BitsNoneSet",
+	"Mod",
+	"CyclicRange",
+}
+
+func (op Op) String() (s string) {
+	switch {
+	case op < OpUndefined, int(op) >= len(opStrings):
+		s = "Op(" + strconv.Itoa(int(op)) + ")"
+	default:
+		s = opStrings[op]
+	}
+	return
+}
+
+// IsDefined reports whether the operation is the known one except OpUndefined.
+func (op Op) IsDefined() bool {
+	return op > OpUndefined && int(op) < len(opStrings)
+}
+
+// IsComparison reports whether the operation compares the value with the single condition value.
+func (op Op) IsComparison() (ok bool) {
+	switch op {
+	case OpGt, OpGte, OpEq, OpLte, OpLt, OpNe:
+		ok = true
+	}
+	return
+}
+
+// IsCrossing reports whether the operation is the stateful threshold crossing.
+func (op Op) IsCrossing() (ok bool) {
+	switch op {
+	case OpCrossAbove, OpCrossBelow:
+		ok = true
+	}
+	return
+}
+
+// IsStateful reports whether the operation depends on the previously observed values.
+func (op Op) IsStateful() (ok bool) {
+	switch op {
+	case OpCrossAbove, OpCrossBelow, OpChange, OpAnomaly:
+		ok = true
+	}
+	return
+}
+
+// IsBitwise reports whether the operation matches the bits of the integer value against the bit mask.
+func (op Op) IsBitwise() (ok bool) {
+	switch op {
+	case OpBitsAllSet, OpBitsAnySet, OpBitsNoneSet:
+		ok = true
+	}
+	return
 }
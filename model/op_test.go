@@ -12,6 +12,20 @@ func TestOp_String(t *testing.T) {
 	assert.Equal(t, "Lt", OpLt.String())
 	assert.Equal(t, "Lte", OpLte.String())
 	assert.Equal(t, "Eq", OpEq.String())
+	assert.Equal(t, "Ne", OpNe.String())
+	assert.Equal(t, "Range", OpRange.String())
+	assert.Equal(t, "In", OpIn.String())
+	assert.Equal(t, "NotIn", OpNotIn.String())
+	assert.Equal(t, "CrossAbove", OpCrossAbove.String())
+	assert.Equal(t, "CrossBelow", OpCrossBelow.String())
+	assert.Equal(t, "Change", OpChange.String())
+	assert.Equal(t, "Anomaly", OpAnomaly.String())
+	assert.Equal(t, "BitsAllSet", OpBitsAllSet.String())
+	assert.Equal(t, "BitsAnySet", OpBitsAnySet.String())
+	assert.Equal(t, "BitsNoneSet", OpBitsNoneSet.String())
+	assert.Equal(t, "Mod", OpMod.String())
+	assert.Equal(t, "CyclicRange", OpCyclicRange.String())
+	assert.Equal(t, "Op(99)", Op(99).String())
 }
 
 func TestOp_Int(t *testing.T) {
@@ -21,4 +35,55 @@ func TestOp_Int(t *testing.T) {
 	assert.Equal(t, 3, int(OpEq))
 	assert.Equal(t, 4, int(OpLte))
 	assert.Equal(t, 5, int(OpLt))
+	assert.Equal(t, 6, int(OpNe))
+	assert.Equal(t, 7, int(OpRange))
+	assert.Equal(t, 8, int(OpIn))
+	assert.Equal(t, 9, int(OpNotIn))
+	assert.Equal(t, 10, int(OpCrossAbove))
+	assert.Equal(t, 11, int(OpCrossBelow))
+	assert.Equal(t, 12, int(OpChange))
+	assert.Equal(t, 13, int(OpAnomaly))
+	assert.Equal(t, 14, int(OpBitsAllSet))
+	assert.Equal(t, 15, int(OpBitsAnySet))
+	assert.Equal(t, 16, int(OpBitsNoneSet))
+	assert.Equal(t, 17, int(OpMod))
+	assert.Equal(t, 18, int(OpCyclicRange))
+}
+
+func TestOp_IsComparison(t *testing.T) {
+	assert.False(t, OpUndefined.IsComparison())
+	assert.True(t, OpGt.IsComparison())
+	assert.True(t, OpNe.IsComparison())
+	assert.False(t, OpRange.IsComparison())
+	assert.False(t, OpNotIn.IsComparison())
+}
+
+func TestOp_IsCrossing(t *testing.T) {
+	assert.False(t, OpGt.IsCrossing())
+	assert.True(t, OpCrossAbove.IsCrossing())
+	assert.True(t, OpCrossBelow.IsCrossing())
+}
+
+func TestOp_IsBitwise(t *testing.T) {
+	assert.False(t, OpEq.IsBitwise())
+	assert.True(t, OpBitsAllSet.IsBitwise())
+	assert.True(t, OpBitsAnySet.IsBitwise())
+	assert.True(t, OpBitsNoneSet.IsBitwise())
+}
+
+func TestOp_IsStateful(t *testing.T) {
+	assert.False(t, OpGt.IsStateful())
+	assert.False(t, OpBitsAnySet.IsStateful())
+	assert.True(t, OpCrossAbove.IsStateful())
+	assert.True(t, OpCrossBelow.IsStateful())
+	assert.True(t, OpChange.IsStateful())
+	assert.True(t, OpAnomaly.IsStateful())
+}
+
+func TestOp_IsDefined(t *testing.T) {
+	assert.False(t, OpUndefined.IsDefined())
+	assert.True(t, OpGt.IsDefined())
+	assert.True(t, OpCyclicRange.IsDefined())
+	assert.False(t, Op(-1).IsDefined())
+	assert.False(t, Op(99).IsDefined())
 }
@@ -0,0 +1,57 @@
+package model
+
+import "math"
+
+// Stats is the running count, mean and variance of the attribute values, see the Welford's online algorithm.
+type Stats struct {
+	Count int64
+	Mean  float64
+	// M2 is the sum of the squared deviations from the mean.
+	M2 float64
+}
+
+// StatsMinCount is the count of the values required to have the z-score.
+const StatsMinCount = 2
+
+// Add returns the statistics having the value added.
+func (s Stats) Add(val float64) (dst Stats) {
+	dst.Count = s.Count + 1
+	d := val - s.Mean
+	dst.Mean = s.Mean + d/float64(dst.Count)
+	dst.M2 = s.M2 + d*(val-dst.Mean)
+	return
+}
+
+// StdDev returns the sample standard deviation.
+func (s Stats) StdDev() (sd float64) {
+	if s.Count > 1 {
+		sd = math.Sqrt(s.M2 / float64(s.Count-1))
+	}
+	return
+}
+
+// ZScore returns the count of the standard deviations the value deviates from the mean by. The value deviating from
+// the constant values has the infinite z-score. There's no z-score until the count reaches StatsMinCount.
+func (s Stats) ZScore(val float64) (z float64, ok bool) {
+	ok = s.Count >= StatsMinCount
+	if ok {
+		d := val - s.Mean
+		switch sd := s.StdDev(); {
+		case sd > 0:
+			z = d / sd
+		case d > 0:
+			z = math.Inf(1)
+		case d < 0:
+			z = math.Inf(-1)
+		}
+	}
+	return
+}
+
+// Deviates evaluates the anomaly condition (OpAnomaly) for the value following the values having the statistics:
+// the condition holds when the value deviates from the mean by more than Val standard deviations.
+func (c Condition) Deviates(s Stats, val float64) (deviates bool) {
+	z, ok := s.ZScore(val)
+	deviates = ok && math.Abs(z) > c.Val
+	return
+}
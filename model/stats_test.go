@@ -0,0 +1,99 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestStats_Add(t *testing.T) {
+	var s Stats
+	for _, v := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		s = s.Add(v)
+	}
+	assert.Equal(t, int64(8), s.Count)
+	assert.Equal(t, float64(5), s.Mean)
+	assert.InDelta(t, math.Sqrt(32.0/7), s.StdDev(), 1e-12)
+}
+
+func TestStats_ZScore(t *testing.T) {
+	cases := map[string]struct {
+		vals []float64
+		val  float64
+		z    float64
+		ok   bool
+	}{
+		"empty": {
+			val: 1,
+		},
+		"single": {
+			vals: []float64{
+				1,
+			},
+			val: 2,
+		},
+		"above": {
+			vals: []float64{
+				1, 3,
+			},
+			val: 2 + 3*math.Sqrt2,
+			z:   3,
+			ok:  true,
+		},
+		"below": {
+			vals: []float64{
+				1, 3,
+			},
+			val: 2 - math.Sqrt2,
+			z:   -1,
+			ok:  true,
+		},
+		"constant": {
+			vals: []float64{
+				1, 1,
+			},
+			val: 1,
+			ok:  true,
+		},
+		"deviates from constant": {
+			vals: []float64{
+				1, 1,
+			},
+			val: 0,
+			z:   math.Inf(-1),
+			ok:  true,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			var s Stats
+			for _, v := range c.vals {
+				s = s.Add(v)
+			}
+			z, ok := s.ZScore(c.val)
+			assert.Equal(t, c.ok, ok)
+			switch {
+			case math.IsInf(c.z, 0):
+				assert.Equal(t, c.z, z)
+			default:
+				assert.InDelta(t, c.z, z, 1e-12)
+			}
+		})
+	}
+}
+
+func TestCondition_Deviates(t *testing.T) {
+	var s Stats
+	for _, v := range []float64{1, 3} {
+		s = s.Add(v)
+	}
+	c := Condition{
+		Key: "latency",
+		Op:  OpAnomaly,
+		Val: 3,
+	}
+	assert.False(t, c.Deviates(s, 2+3*math.Sqrt2))
+	assert.True(t, c.Deviates(s, 2+3.1*math.Sqrt2))
+	assert.True(t, c.Deviates(s, 2-3.1*math.Sqrt2))
+	assert.False(t, c.Deviates(Stats{}, 100))
+}
@@ -0,0 +1,177 @@
+package model
+
+import (
+	"math"
+	"time"
+)
+
+// Window defines the windowed aggregate condition: the condition compares the aggregate of the attribute values
+// observed within the time window with Val using Op, e.g. "avg(latency) over 5m > 300".
+type Window struct {
+	Agg Agg
+	Dur time.Duration
+	// Tumbling means the consecutive windows don't overlap and start at the multiples of Dur since the Unix epoch,
+	// otherwise the window slides ending at the current time.
+	Tumbling bool
+	// Filter is optional, only the values satisfying it are aggregated, e.g. "amount > 0". The comparison operations
+	// are supported only.
+	Filter WindowFilter
+}
+
+type WindowFilter struct {
+	Op  Op
+	Val float64
+}
+
+// Agg is the aggregate function of the window values.
+type Agg int
+
+const (
+	AggUndefined Agg = iota
+	AggCount
+	AggSum
+	AggAvg
+	AggMin
+	AggMax
+)
+
+// WindowBucket accumulates the values observed within the time slot starting at Start Unix nanoseconds.
+type WindowBucket struct {
+	Start int64
+	Count int64
+	Sum   float64
+	Min   float64
+	Max   float64
+}
+
+// WindowState is the window values state bounded by the count of buckets, it's sorted by the bucket start.
+type WindowState []WindowBucket
+
+// windowBucketCount is the count of the sliding window buckets, the sliding window moves by 1/windowBucketCount of
+// its duration.
+const windowBucketCount = 60
+
+func (a Agg) String() string {
+	return [...]string{
+		"undefined",
+		"count",
+		"sum",
+		"avg",
+		"min",
+		"max",
+	}[a]
+}
+
+func (w Window) IsZero() bool {
+	return w.Agg == AggUndefined
+}
+
+// Accepts reports whether the value passes the window filter.
+func (w Window) Accepts(val float64) (ok bool) {
+	switch w.Filter.Op {
+	case OpUndefined:
+		ok = true
+	default:
+		ok = w.Filter.Op.IsComparison() && Condition{Op: w.Filter.Op, Val: w.Filter.Val}.matchesVal(val)
+	}
+	return
+}
+
+// Add returns the state having the value observed at the specified time added and the expired buckets removed.
+func (w Window) Add(src WindowState, t time.Time, val float64) (dst WindowState) {
+	dst = append(WindowState(nil), w.expire(src, t)...)
+	start := w.bucketStart(t)
+	n := len(dst)
+	switch {
+	// the value observed before the latest bucket start is late, it's added to the latest bucket
+	case n > 0 && dst[n-1].Start >= start:
+		b := &dst[n-1]
+		b.Count++
+		b.Sum += val
+		b.Min = math.Min(b.Min, val)
+		b.Max = math.Max(b.Max, val)
+	default:
+		dst = append(dst, WindowBucket{
+			Start: start,
+			Count: 1,
+			Sum:   val,
+			Min:   val,
+			Max:   val,
+		})
+	}
+	return
+}
+
+// Aggregate returns the aggregate of the values within the window at the specified time. The sliding window is
+// precise to the bucket duration, the older bucket is included while any of its time slot is within the window.
+// There's no aggregate value for the empty window except the count and the sum.
+func (w Window) Aggregate(s WindowState, t time.Time) (agg float64, ok bool) {
+	var count int64
+	var sum float64
+	minVal, maxVal := math.Inf(1), math.Inf(-1)
+	for _, b := range w.expire(s, t) {
+		count += b.Count
+		sum += b.Sum
+		minVal = math.Min(minVal, b.Min)
+		maxVal = math.Max(maxVal, b.Max)
+	}
+	ok = count > 0
+	switch w.Agg {
+	case AggCount:
+		agg, ok = float64(count), true
+	case AggSum:
+		agg, ok = sum, true
+	case AggAvg:
+		if ok {
+			agg = sum / float64(count)
+		}
+	case AggMin:
+		agg = minVal
+	case AggMax:
+		agg = maxVal
+	default:
+		ok = false
+	}
+	return
+}
+
+// MatchesAggregate reports whether the windowed aggregate condition holds for the aggregate of the window values.
+func (c Condition) MatchesAggregate(agg float64) bool {
+	return c.Op.IsComparison() && c.matchesVal(agg)
+}
+
+func (w Window) expire(src WindowState, t time.Time) (dst WindowState) {
+	var minStart int64
+	switch w.Tumbling {
+	case true:
+		minStart = w.bucketStart(t)
+	default:
+		minStart = t.UnixNano() - int64(w.Dur)
+	}
+	dst = src
+	for len(dst) > 0 && dst[0].Start+w.bucketDur() <= minStart {
+		dst = dst[1:]
+	}
+	return
+}
+
+func (w Window) bucketStart(t time.Time) (start int64) {
+	d := w.bucketDur()
+	start = t.UnixNano()
+	start -= start % d
+	if start > t.UnixNano() {
+		start -= d
+	}
+	return
+}
+
+func (w Window) bucketDur() (d int64) {
+	d = int64(w.Dur)
+	if !w.Tumbling {
+		d /= windowBucketCount
+	}
+	if d < 1 {
+		d = 1
+	}
+	return
+}
@@ -0,0 +1,224 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWindow_Aggregate(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	type obs struct {
+		t   time.Duration
+		val float64
+	}
+	cases := map[string]struct {
+		w   Window
+		obs []obs
+		at  time.Duration
+		agg float64
+		ok  bool
+	}{
+		"count sliding": {
+			w: Window{
+				Agg: AggCount,
+				Dur: time.Minute,
+			},
+			obs: []obs{
+				{
+					t: 0,
+				},
+				{
+					t: 30 * time.Second,
+				},
+				{
+					t: 70 * time.Second,
+				},
+			},
+			at:  80 * time.Second,
+			agg: 2,
+			ok:  true,
+		},
+		"count empty": {
+			w: Window{
+				Agg: AggCount,
+				Dur: time.Minute,
+			},
+			obs: []obs{
+				{
+					t: 0,
+				},
+			},
+			at: 2 * time.Minute,
+			ok: true,
+		},
+		"avg sliding": {
+			w: Window{
+				Agg: AggAvg,
+				Dur: 5 * time.Minute,
+			},
+			obs: []obs{
+				{
+					t:   0,
+					val: 1000,
+				},
+				{
+					t:   5 * time.Minute,
+					val: 200,
+				},
+				{
+					t:   6 * time.Minute,
+					val: 400,
+				},
+			},
+			at:  6 * time.Minute,
+			agg: 300,
+			ok:  true,
+		},
+		"avg empty": {
+			w: Window{
+				Agg: AggAvg,
+				Dur: time.Minute,
+			},
+		},
+		"sum tumbling": {
+			w: Window{
+				Agg:      AggSum,
+				Dur:      time.Hour,
+				Tumbling: true,
+			},
+			obs: []obs{
+				{
+					t:   50 * time.Minute,
+					val: 1,
+				},
+				{
+					t:   70 * time.Minute,
+					val: 2,
+				},
+				{
+					t:   80 * time.Minute,
+					val: 3,
+				},
+			},
+			at:  90 * time.Minute,
+			agg: 5,
+			ok:  true,
+		},
+		"min": {
+			w: Window{
+				Agg: AggMin,
+				Dur: time.Hour,
+			},
+			obs: []obs{
+				{
+					val: 3,
+				},
+				{
+					t:   time.Minute,
+					val: -1,
+				},
+				{
+					t:   2 * time.Minute,
+					val: 2,
+				},
+			},
+			at:  2 * time.Minute,
+			agg: -1,
+			ok:  true,
+		},
+		"max late": {
+			w: Window{
+				Agg: AggMax,
+				Dur: time.Hour,
+			},
+			obs: []obs{
+				{
+					t:   2 * time.Minute,
+					val: 2,
+				},
+				{
+					t:   time.Minute,
+					val: 5,
+				},
+			},
+			at:  2 * time.Minute,
+			agg: 5,
+			ok:  true,
+		},
+		"filtered": {
+			w: Window{
+				Agg: AggCount,
+				Dur: time.Hour,
+				Filter: WindowFilter{
+					Op: OpGt,
+				},
+			},
+			obs: []obs{
+				{
+					val: 1,
+				},
+				{
+					val: 0,
+				},
+				{
+					val: -1,
+				},
+				{
+					val: 2,
+				},
+			},
+			agg: 2,
+			ok:  true,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			var s WindowState
+			for _, o := range c.obs {
+				if c.w.Accepts(o.val) {
+					s = c.w.Add(s, t0.Add(o.t), o.val)
+				}
+			}
+			agg, ok := c.w.Aggregate(s, t0.Add(c.at))
+			assert.Equal(t, c.ok, ok)
+			if c.ok {
+				assert.Equal(t, c.agg, agg)
+			}
+		})
+	}
+}
+
+func TestWindow_Add_Bounded(t *testing.T) {
+	w := Window{
+		Agg: AggSum,
+		Dur: time.Minute,
+	}
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var s WindowState
+	for i := 0; i < 10_000; i++ {
+		s = w.Add(s, t0.Add(time.Duration(i)*time.Second), 1)
+	}
+	assert.LessOrEqual(t, len(s), windowBucketCount+1)
+	agg, ok := w.Aggregate(s, t0.Add(9_999*time.Second))
+	assert.True(t, ok)
+	// both the window ends are included
+	assert.Equal(t, float64(61), agg)
+}
+
+func TestCondition_MatchesAggregate(t *testing.T) {
+	c := Condition{
+		Key: "latency",
+		Op:  OpGt,
+		Val: 300,
+		Window: Window{
+			Agg: AggAvg,
+			Dur: time.Minute,
+		},
+	}
+	assert.True(t, c.MatchesAggregate(301))
+	assert.False(t, c.MatchesAggregate(300))
+	assert.False(t, c.MatchesAggregate(math.NaN()))
+	assert.False(t, c.Matches("latency", 301))
+}
@@ -7,11 +7,13 @@ import (
 )
 
 type Service interface {
-	Create(ctx context.Context, interestId, k string, o model.Op, v float64) (id string, err error)
+	Create(ctx context.Context, interestId string, cond model.Condition) (id string, err error)
 	LockCreate(ctx context.Context, id string) (err error)
 	UnlockCreate(ctx context.Context, id string) (err error)
 	Delete(ctx context.Context, interestId, id string) (err error)
-	SearchPage(ctx context.Context, key string, val float64, limit uint32, cursor string) (ids []string, err error)
+	// SearchPage returns the conditions matching the attribute and the attribute values statistics preceding the value.
+	SearchPage(ctx context.Context, attr model.Attr, limit uint32, cursor string) (ids []string, stats model.Stats, err error)
+	SearchMultiPage(ctx context.Context, attrs map[string]float64, limit uint32, cursor string) (ids []string, err error)
 }
 
 type service struct {
@@ -24,8 +26,8 @@ func NewService(stor storage.Storage) Service {
 	}
 }
 
-func (svc service) Create(ctx context.Context, interestId, k string, o model.Op, v float64) (id string, err error) {
-	id, err = svc.stor.Create(ctx, interestId, k, o, v)
+func (svc service) Create(ctx context.Context, interestId string, cond model.Condition) (id string, err error) {
+	id, err = svc.stor.Create(ctx, interestId, cond)
 	return
 }
 
@@ -41,7 +43,12 @@ func (svc service) Delete(ctx context.Context, interestId, id string) (err error
 	return svc.stor.Delete(ctx, interestId, id)
 }
 
-func (svc service) SearchPage(ctx context.Context, key string, val float64, limit uint32, cursor string) (ids []string, err error) {
-	ids, err = svc.stor.SearchPage(ctx, key, val, limit, cursor)
+func (svc service) SearchPage(ctx context.Context, attr model.Attr, limit uint32, cursor string) (ids []string, stats model.Stats, err error) {
+	ids, stats, err = svc.stor.SearchPage(ctx, attr, limit, cursor)
+	return
+}
+
+func (svc service) SearchMultiPage(ctx context.Context, attrs map[string]float64, limit uint32, cursor string) (ids []string, err error) {
+	ids, err = svc.stor.SearchMultiPage(ctx, attrs, limit, cursor)
 	return
 }
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"github.com/awakari/conditions-number/model"
+)
+
+type serviceKeys struct {
+	svc  Service
+	norm model.KeyNorm
+}
+
+// NewServiceKeys normalizes the condition and the attribute keys the same way before passing those to the underlying
+// service, so the condition matches the attribute key regardless of e.g. the case or the surrounding whitespace.
+func NewServiceKeys(svc Service, norm model.KeyNorm) Service {
+	return serviceKeys{
+		svc:  svc,
+		norm: norm,
+	}
+}
+
+func (sk serviceKeys) Create(ctx context.Context, interestId string, cond model.Condition) (id string, err error) {
+	dst := sk.norm.NormalizeCondition(cond)
+	err = validateNormKey("key", cond.Key, dst.Key)
+	for i := 0; err == nil && i < len(dst.Terms); i++ {
+		err = validateNormKey("terms", cond.Terms[i].Key, dst.Terms[i].Key)
+	}
+	if err == nil {
+		id, err = sk.svc.Create(ctx, interestId, dst)
+	}
+	return
+}
+
+func (sk serviceKeys) LockCreate(ctx context.Context, id string) (err error) {
+	return sk.svc.LockCreate(ctx, id)
+}
+
+func (sk serviceKeys) UnlockCreate(ctx context.Context, id string) (err error) {
+	return sk.svc.UnlockCreate(ctx, id)
+}
+
+func (sk serviceKeys) Delete(ctx context.Context, interestId, id string) (err error) {
+	return sk.svc.Delete(ctx, interestId, id)
+}
+
+func (sk serviceKeys) SearchPage(ctx context.Context, attr model.Attr, limit uint32, cursor string) (ids []string, stats model.Stats, err error) {
+	attr.Key = sk.norm.Normalize(attr.Key)
+	return sk.svc.SearchPage(ctx, attr, limit, cursor)
+}
+
+// SearchMultiPage rejects the attributes having the same normalized key since it's not clear which value to use.
+func (sk serviceKeys) SearchMultiPage(ctx context.Context, attrs map[string]float64, limit uint32, cursor string) (ids []string, err error) {
+	dst := make(map[string]float64, len(attrs))
+	srcKeys := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		kNorm := sk.norm.Normalize(k)
+		err = validateNormKey("attrs", k, kNorm)
+		if err == nil {
+			if kPrev, dup := srcKeys[kNorm]; dup {
+				err = invalidf("attrs", "keys %q and %q are the same after the normalization", kPrev, k)
+			}
+		}
+		if err != nil {
+			break
+		}
+		srcKeys[kNorm] = k
+		dst[kNorm] = v
+	}
+	if err == nil {
+		ids, err = sk.svc.SearchMultiPage(ctx, dst, limit, cursor)
+	}
+	return
+}
+
+func validateNormKey(field, src, dst string) (err error) {
+	if src != "" && dst == "" {
+		err = invalidf(field, "key %q %w after the normalization", src, errEmpty)
+	}
+	return
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"github.com/awakari/conditions-number/model"
+	"github.com/awakari/conditions-number/storage"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestServiceKeys_Create(t *testing.T) {
+	norm := model.KeyNorm{
+		Trim: true,
+		Fold: true,
+		Sep:  "_",
+	}
+	cases := map[string]struct {
+		src model.Condition
+		dst model.Condition
+		err error
+	}{
+		"key": {
+			src: model.Condition{
+				Key: " List Price",
+				Op:  model.OpGt,
+				Val: 1,
+			},
+			dst: model.Condition{
+				Key: "list_price",
+				Op:  model.OpGt,
+				Val: 1,
+			},
+		},
+		"terms": {
+			src: model.Condition{
+				Terms: []model.Term{
+					{
+						Key:  "Sale-Price",
+						Coef: 1,
+					},
+					{
+						Key:  "LIST PRICE",
+						Coef: -1,
+					},
+				},
+				Op: model.OpLt,
+			},
+			dst: model.Condition{
+				Terms: []model.Term{
+					{
+						Key:  "sale_price",
+						Coef: 1,
+					},
+					{
+						Key:  "list_price",
+						Coef: -1,
+					},
+				},
+				Op: model.OpLt,
+			},
+		},
+		"key-less": {
+			src: model.Condition{
+				Op:  model.OpGt,
+				Val: 1,
+			},
+			dst: model.Condition{
+				Op:  model.OpGt,
+				Val: 1,
+			},
+		},
+		"empty after normalization": {
+			src: model.Condition{
+				Key: "  ",
+				Op:  model.OpGt,
+				Val: 1,
+			},
+			err: storage.ErrInvalid,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			spy := &storageSpy{
+				Storage: storage.NewStorageMock(),
+			}
+			svc := NewServiceKeys(NewService(spy), norm)
+			_, err := svc.Create(context.TODO(), "interest0", c.src)
+			assert.ErrorIs(t, err, c.err)
+			if c.err == nil {
+				assert.Equal(t, c.dst, spy.cond)
+			}
+		})
+	}
+}
+
+func TestServiceKeys_SearchPage(t *testing.T) {
+	spy := &storageSpy{
+		Storage: storage.NewStorageMock(),
+	}
+	svc := NewServiceKeys(NewService(spy), model.KeyNorm{Trim: true, Fold: true})
+	_, _, err := svc.SearchPage(context.TODO(), model.Attr{Key: "Price ", Val: 1}, 1, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "price", spy.attr.Key)
+}
+
+func TestServiceKeys_SearchMultiPage(t *testing.T) {
+	svc := NewServiceKeys(NewService(storage.NewStorageMock()), model.KeyNorm{Trim: true, Fold: true})
+	cases := map[string]struct {
+		attrs map[string]float64
+		err   error
+	}{
+		"ok": {
+			attrs: map[string]float64{
+				"Price":     1,
+				"Sale Cost": 2,
+			},
+		},
+		"same after normalization": {
+			attrs: map[string]float64{
+				"Price":  1,
+				"price ": 2,
+			},
+			err: storage.ErrInvalid,
+		},
+		"empty after normalization": {
+			attrs: map[string]float64{
+				" ": 1,
+			},
+			err: storage.ErrInvalid,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			_, err := svc.SearchMultiPage(context.TODO(), c.attrs, 1, "")
+			assert.ErrorIs(t, err, c.err)
+		})
+	}
+}
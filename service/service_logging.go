@@ -19,10 +19,10 @@ func NewServiceLogging(svc Service, log *slog.Logger) Service {
 	}
 }
 
-func (sl serviceLogging) Create(ctx context.Context, interestId, k string, o model.Op, v float64) (id string, err error) {
-	id, err = sl.svc.Create(ctx, interestId, k, o, v)
+func (sl serviceLogging) Create(ctx context.Context, interestId string, cond model.Condition) (id string, err error) {
+	id, err = sl.svc.Create(ctx, interestId, cond)
 	ll := sl.logLevel(err)
-	sl.log.Log(ctx, ll, fmt.Sprintf("Create(interest=%s, k=%s, o=%s, v=%f): id=%s, err=%s", interestId, k, o, v, id, err))
+	sl.log.Log(ctx, ll, fmt.Sprintf("Create(interest=%s, cond=%s): id=%s, err=%s", interestId, cond, id, err))
 	return
 }
 
@@ -47,10 +47,17 @@ func (sl serviceLogging) Delete(ctx context.Context, interestId, id string) (err
 	return
 }
 
-func (sl serviceLogging) SearchPage(ctx context.Context, k string, v float64, limit uint32, cursor string) (ids []string, err error) {
-	ids, err = sl.svc.SearchPage(ctx, k, v, limit, cursor)
+func (sl serviceLogging) SearchPage(ctx context.Context, attr model.Attr, limit uint32, cursor string) (ids []string, stats model.Stats, err error) {
+	ids, stats, err = sl.svc.SearchPage(ctx, attr, limit, cursor)
 	ll := sl.logLevel(err)
-	sl.log.Log(ctx, ll, fmt.Sprintf("SearchPage(k=%s, v=%f, limit=%d, cursor=%s): n=%d, err=%s", k, v, limit, cursor, len(ids), err))
+	sl.log.Log(ctx, ll, fmt.Sprintf("SearchPage(attr=%s, entity=%s, limit=%d, cursor=%s): n=%d, err=%s", attr, attr.Entity, limit, cursor, len(ids), err))
+	return
+}
+
+func (sl serviceLogging) SearchMultiPage(ctx context.Context, attrs map[string]float64, limit uint32, cursor string) (ids []string, err error) {
+	ids, err = sl.svc.SearchMultiPage(ctx, attrs, limit, cursor)
+	ll := sl.logLevel(err)
+	sl.log.Log(ctx, ll, fmt.Sprintf("SearchMultiPage(attrs=%v, limit=%d, cursor=%s): n=%d, err=%s", attrs, limit, cursor, len(ids), err))
 	return
 }
 
@@ -34,7 +34,7 @@ func TestService_Create(t *testing.T) {
 	//
 	for k, c := range cases {
 		t.Run(k, func(t *testing.T) {
-			id, err := svc.Create(context.TODO(), "interest1", c.key, model.OpEq, c.val)
+			id, err := svc.Create(context.TODO(), "interest1", model.Condition{Key: c.key, Op: model.OpEq, Val: c.val})
 			if c.err == nil {
 				assert.Equal(t, "cond0", id)
 			}
@@ -116,6 +116,17 @@ func TestService_SearchPage(t *testing.T) {
 			limit: 3,
 			n:     3,
 		},
+		"tolerant eq": {
+			key:   "tolerance",
+			val:   0.1 + 0.2,
+			limit: 10,
+			n:     1,
+		},
+		"tolerance exceeded": {
+			key:   "tolerance",
+			val:   0.31,
+			limit: 10,
+		},
 		"fail": {
 			key: "fail",
 			val: 0,
@@ -126,7 +137,42 @@ func TestService_SearchPage(t *testing.T) {
 	for k, c := range cases {
 		t.Run(k, func(t *testing.T) {
 			var ids []string
-			ids, err := svc.SearchPage(context.TODO(), c.key, c.val, c.limit, "")
+			ids, _, err := svc.SearchPage(context.TODO(), model.Attr{Key: c.key, Val: c.val}, c.limit, "")
+			assert.Equal(t, c.n, len(ids))
+			assert.ErrorIs(t, err, c.err)
+		})
+	}
+}
+
+func TestService_SearchMultiPage(t *testing.T) {
+	//
+	svc := NewService(storage.NewStorageMock())
+	svc = NewServiceLogging(svc, slog.Default())
+	cases := map[string]struct {
+		attrs map[string]float64
+		limit uint32
+		n     int
+		err   error
+	}{
+		"ok": {
+			attrs: map[string]float64{
+				"used":  1,
+				"quota": 2,
+			},
+			limit: 10,
+			n:     10,
+		},
+		"fail": {
+			attrs: map[string]float64{
+				"fail": 0,
+			},
+			err: storage.ErrInternal,
+		},
+	}
+	//
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			ids, err := svc.SearchMultiPage(context.TODO(), c.attrs, c.limit, "")
 			assert.Equal(t, c.n, len(ids))
 			assert.ErrorIs(t, err, c.err)
 		})
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/awakari/conditions-number/model"
+	"github.com/awakari/conditions-number/unit"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+)
+
+type serviceUnits struct {
+	svc   Service
+	units unit.Registry
+}
+
+// NewServiceUnits converts the condition and attribute values to the base unit of the dimension,
+// so the conditions match the values specified in any unit of the same dimension.
+func NewServiceUnits(svc Service, units unit.Registry) Service {
+	return serviceUnits{
+		svc:   svc,
+		units: units,
+	}
+}
+
+func (su serviceUnits) Create(ctx context.Context, interestId string, cond model.Condition) (id string, err error) {
+	cond, err = su.normalizeCondition(cond)
+	if err == nil {
+		id, err = su.svc.Create(ctx, interestId, cond)
+	}
+	return
+}
+
+func (su serviceUnits) LockCreate(ctx context.Context, id string) (err error) {
+	return su.svc.LockCreate(ctx, id)
+}
+
+func (su serviceUnits) UnlockCreate(ctx context.Context, id string) (err error) {
+	return su.svc.UnlockCreate(ctx, id)
+}
+
+func (su serviceUnits) Delete(ctx context.Context, interestId, id string) (err error) {
+	return su.svc.Delete(ctx, interestId, id)
+}
+
+// SearchPage returns the statistics in the attribute unit.
+func (su serviceUnits) SearchPage(ctx context.Context, attr model.Attr, limit uint32, cursor string) (ids []string, stats model.Stats, err error) {
+	var u unit.Unit
+	if attr.Unit != "" {
+		u, err = su.units.Lookup(attr.Unit)
+		if err == nil {
+			attr.Dec, attr.Int, err = exactToBase(u, attr.Dec, attr.Int)
+		}
+		if err == nil {
+			attr.Val, attr.Unit, err = su.units.Normalize(attr.Val, attr.Unit)
+		}
+	}
+	if err == nil {
+		ids, stats, err = su.svc.SearchPage(ctx, attr, limit, cursor)
+	}
+	if err == nil && u.Scale != 0 && stats.Count > 0 {
+		stats.Mean = u.FromBase(stats.Mean)
+		stats.M2 /= u.Scale * u.Scale
+	}
+	return
+}
+
+func (su serviceUnits) SearchMultiPage(ctx context.Context, attrs map[string]float64, limit uint32, cursor string) (ids []string, err error) {
+	return su.svc.SearchMultiPage(ctx, attrs, limit, cursor)
+}
+
+func (su serviceUnits) normalizeCondition(src model.Condition) (dst model.Condition, err error) {
+	dst = src
+	if src.Unit == "" {
+		return
+	}
+	if len(src.Terms) > 0 {
+		err = fmt.Errorf("%w: cross-attribute condition can not have a unit", unit.ErrIncompatible)
+		return
+	}
+	switch {
+	case src.Op.IsBitwise():
+		err = fmt.Errorf("%w: bitwise condition can not have a unit", unit.ErrIncompatible)
+		return
+	case src.Op == model.OpMod:
+		err = fmt.Errorf("%w: modulo condition can not have a unit", unit.ErrIncompatible)
+		return
+	}
+	var u unit.Unit
+	u, err = su.units.Lookup(src.Unit)
+	if err == nil && src.Relative && u.Dimension != unit.DimTime {
+		err = fmt.Errorf("%w: relative-time condition unit should be of %s dimension", unit.ErrIncompatible, unit.DimTime)
+	}
+	if err == nil {
+		dst.Dec, dst.Int, err = exactToBase(u, src.Dec, src.Int)
+	}
+	if err == nil {
+		dst.Val, dst.Unit, err = su.units.Normalize(src.Val, src.Unit)
+	}
+	if err == nil && !src.Window.IsZero() {
+		// the count is not affected by the unit and the sum is not preserved by the offset
+		dst.Window.Filter.Val = u.ToBase(src.Window.Filter.Val)
+		switch {
+		case src.Window.Agg == model.AggCount:
+			dst.Val = src.Val
+		case src.Window.Agg == model.AggSum && u.Offset != 0:
+			err = fmt.Errorf("%w: windowed sum condition unit should have no offset", unit.ErrIncompatible)
+		case src.Window.Agg == model.AggSum:
+			dst.Val = src.Val * u.Scale
+		}
+	}
+	if err == nil {
+		switch src.Op {
+		case model.OpAnomaly:
+			// the count of the standard deviations is not affected by the unit
+			dst.Val = src.Val
+		case model.OpChange:
+			// the delta is not affected by the offset and the relative change is not preserved by it
+			switch {
+			case !src.Change.Rel:
+				dst.Val = src.Val * u.Scale
+			case u.Offset != 0:
+				err = fmt.Errorf("%w: relative change condition unit should have no offset", unit.ErrIncompatible)
+			default:
+				dst.Val = src.Val
+			}
+		case model.OpRange:
+			dst.Range.Min = u.ToBase(src.Range.Min)
+			dst.Range.Max = u.ToBase(src.Range.Max)
+		case model.OpCyclicRange:
+			// the period is not preserved by the offset
+			switch u.Offset {
+			case 0:
+				dst.Range.Min = u.ToBase(src.Range.Min)
+				dst.Range.Max = u.ToBase(src.Range.Max)
+				dst.Period = src.Period * u.Scale
+			default:
+				err = fmt.Errorf("%w: cyclic range condition unit should have no offset", unit.ErrIncompatible)
+			}
+		case model.OpIn, model.OpNotIn:
+			dst.Vals = slices.Clone(src.Vals)
+			for i, v := range dst.Vals {
+				dst.Vals[i] = u.ToBase(v)
+			}
+		}
+		// the relative tolerance is not preserved by the offset, convert it to the absolute one
+		if u.Offset != 0 && src.Tolerance.Rel > 0 {
+			v := src.Val
+			switch {
+			case src.Dec != "":
+				v = src.Dec.Float64()
+			case src.Int != nil:
+				v = float64(*src.Int)
+			}
+			dst.Tolerance.Abs = math.Max(src.Tolerance.Abs, src.Tolerance.Rel*math.Abs(v))
+			dst.Tolerance.Rel = 0
+		}
+		dst.Tolerance.Abs *= u.Scale
+		dst.Hysteresis *= u.Scale
+	}
+	return
+}
+
+// exactToBase converts the exact value treating the unit scale and offset as the decimals in their shortest
+// representation, e.g. 0.001 for "ms". The integer value becomes the decimal one when the result is not an integer.
+func exactToBase(u unit.Unit, srcDec model.Decimal, srcInt *int64) (dstDec model.Decimal, dstInt *int64, err error) {
+	var v *big.Rat
+	switch {
+	case srcDec != "":
+		v = srcDec.Rat()
+	case srcInt != nil:
+		v = new(big.Rat).SetInt64(*srcInt)
+	default:
+		return
+	}
+	scale, _ := new(big.Rat).SetString(strconv.FormatFloat(u.Scale, 'g', -1, 64))
+	offset, _ := new(big.Rat).SetString(strconv.FormatFloat(u.Offset, 'g', -1, 64))
+	if v == nil || scale == nil || offset == nil {
+		err = fmt.Errorf("%w: %s", model.ErrInvalidDecimal, srcDec)
+		return
+	}
+	v.Mul(v, scale)
+	v.Add(v, offset)
+	switch {
+	case srcInt != nil && v.IsInt() && v.Num().IsInt64():
+		i := v.Num().Int64()
+		dstInt = &i
+	default:
+		dstDec, err = model.NewDecimal(v)
+	}
+	return
+}
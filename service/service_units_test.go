@@ -0,0 +1,554 @@
+package service
+
+import (
+	"context"
+	"github.com/awakari/conditions-number/model"
+	"github.com/awakari/conditions-number/storage"
+	"github.com/awakari/conditions-number/unit"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type storageSpy struct {
+	storage.Storage
+	cond model.Condition
+	attr model.Attr
+}
+
+func (ss *storageSpy) Create(ctx context.Context, interestId string, cond model.Condition) (id string, err error) {
+	ss.cond = cond
+	return ss.Storage.Create(ctx, interestId, cond)
+}
+
+func (ss *storageSpy) SearchPage(ctx context.Context, attr model.Attr, limit uint32, cursor string) (ids []string, stats model.Stats, err error) {
+	ss.attr = attr
+	return ss.Storage.SearchPage(ctx, attr, limit, cursor)
+}
+
+func TestServiceUnits_Create(t *testing.T) {
+	cases := map[string]struct {
+		src model.Condition
+		dst model.Condition
+		err error
+	}{
+		"no unit": {
+			src: model.Condition{
+				Key: "k",
+				Op:  model.OpGt,
+				Val: 1,
+			},
+			dst: model.Condition{
+				Key: "k",
+				Op:  model.OpGt,
+				Val: 1,
+			},
+		},
+		"km": {
+			src: model.Condition{
+				Key:  "distance",
+				Op:   model.OpLt,
+				Val:  5,
+				Unit: "km",
+			},
+			dst: model.Condition{
+				Key:  "distance",
+				Op:   model.OpLt,
+				Val:  5000,
+				Unit: "m",
+			},
+		},
+		"range and tolerance": {
+			src: model.Condition{
+				Key: "t",
+				Op:  model.OpRange,
+				Range: model.Range{
+					Min: -40,
+					Max: 212,
+				},
+				Tolerance: model.Tolerance{
+					Abs: 9,
+				},
+				Unit: "°F",
+			},
+			dst: model.Condition{
+				Key: "t",
+				Op:  model.OpRange,
+				Val: 255.3722222222222,
+				Range: model.Range{
+					Min: 233.15,
+					Max: 373.15,
+				},
+				Tolerance: model.Tolerance{
+					Abs: 5,
+				},
+				Unit: "K",
+			},
+		},
+		"cyclic range": {
+			src: model.Condition{
+				Key: "time_of_day",
+				Op:  model.OpCyclicRange,
+				Range: model.Range{
+					Min: 22,
+					Max: 6,
+				},
+				Period: 24,
+				Unit:   "h",
+			},
+			dst: model.Condition{
+				Key: "time_of_day",
+				Op:  model.OpCyclicRange,
+				Range: model.Range{
+					Min: 79200,
+					Max: 21600,
+				},
+				Period: 86400,
+				Unit:   "s",
+			},
+		},
+		"cyclic range with offset": {
+			src: model.Condition{
+				Key: "t",
+				Op:  model.OpCyclicRange,
+				Range: model.Range{
+					Min: 10,
+					Max: 20,
+				},
+				Period: 100,
+				Unit:   "°C",
+			},
+			err: unit.ErrIncompatible,
+		},
+		"relative tolerance with offset": {
+			src: model.Condition{
+				Key: "t",
+				Op:  model.OpEq,
+				Val: 20,
+				Tolerance: model.Tolerance{
+					Rel: 0.1,
+				},
+				Unit: "°C",
+			},
+			dst: model.Condition{
+				Key: "t",
+				Op:  model.OpEq,
+				Val: 293.15,
+				Tolerance: model.Tolerance{
+					Abs: 2,
+				},
+				Unit: "K",
+			},
+		},
+		"set": {
+			src: model.Condition{
+				Key:  "size",
+				Op:   model.OpIn,
+				Vals: []float64{1, 2},
+				Unit: "KiB",
+			},
+			dst: model.Condition{
+				Key:  "size",
+				Op:   model.OpIn,
+				Vals: []float64{1024, 2048},
+				Unit: "B",
+			},
+		},
+		"relative": {
+			src: model.Condition{
+				Key:      "published",
+				Op:       model.OpGte,
+				Val:      -24,
+				Unit:     "h",
+				Relative: true,
+			},
+			dst: model.Condition{
+				Key:      "published",
+				Op:       model.OpGte,
+				Val:      -86400,
+				Unit:     "s",
+				Relative: true,
+			},
+		},
+		"relative not time": {
+			src: model.Condition{
+				Key:      "published",
+				Op:       model.OpGte,
+				Val:      -24,
+				Unit:     "km",
+				Relative: true,
+			},
+			err: unit.ErrIncompatible,
+		},
+		"decimal": {
+			src: model.Condition{
+				Key:  "t",
+				Op:   model.OpEq,
+				Dec:  "20.05",
+				Unit: "°C",
+			},
+			dst: model.Condition{
+				Key:  "t",
+				Op:   model.OpEq,
+				Val:  273.15,
+				Dec:  "293.2",
+				Unit: "K",
+			},
+		},
+		"int": {
+			src: model.Condition{
+				Key:  "size",
+				Op:   model.OpGt,
+				Int:  ptr(int64(9007199254740993)),
+				Unit: "kB",
+			},
+			dst: model.Condition{
+				Key:  "size",
+				Op:   model.OpGt,
+				Int:  ptr(int64(9007199254740993000)),
+				Unit: "B",
+			},
+		},
+		"int overflow to decimal": {
+			src: model.Condition{
+				Key:  "size",
+				Op:   model.OpGt,
+				Int:  ptr(int64(9007199254740993)),
+				Unit: "KiB",
+			},
+			dst: model.Condition{
+				Key:  "size",
+				Op:   model.OpGt,
+				Dec:  "9223372036854776832",
+				Unit: "B",
+			},
+		},
+		"int to decimal": {
+			src: model.Condition{
+				Key:  "t",
+				Op:   model.OpLt,
+				Int:  ptr(int64(1767323045123456789)),
+				Unit: "ns",
+			},
+			dst: model.Condition{
+				Key:  "t",
+				Op:   model.OpLt,
+				Dec:  "1767323045.123456789",
+				Unit: "s",
+			},
+		},
+		"crossing": {
+			src: model.Condition{
+				Key:        "t",
+				Op:         model.OpCrossAbove,
+				Val:        30,
+				Hysteresis: 2,
+				Unit:       "°C",
+			},
+			dst: model.Condition{
+				Key:        "t",
+				Op:         model.OpCrossAbove,
+				Val:        303.15,
+				Hysteresis: 2,
+				Unit:       "K",
+			},
+		},
+		"change delta": {
+			src: model.Condition{
+				Key:  "t",
+				Op:   model.OpChange,
+				Val:  5,
+				Unit: "°C",
+			},
+			dst: model.Condition{
+				Key:  "t",
+				Op:   model.OpChange,
+				Val:  5,
+				Unit: "K",
+			},
+		},
+		"change rel": {
+			src: model.Condition{
+				Key: "d",
+				Op:  model.OpChange,
+				Val: 0.1,
+				Change: model.Change{
+					Dir: model.ChangeDown,
+					Rel: true,
+				},
+				Unit: "km",
+			},
+			dst: model.Condition{
+				Key: "d",
+				Op:  model.OpChange,
+				Val: 0.1,
+				Change: model.Change{
+					Dir: model.ChangeDown,
+					Rel: true,
+				},
+				Unit: "m",
+			},
+		},
+		"change rel with offset": {
+			src: model.Condition{
+				Key: "t",
+				Op:  model.OpChange,
+				Val: 0.1,
+				Change: model.Change{
+					Rel: true,
+				},
+				Unit: "°C",
+			},
+			err: unit.ErrIncompatible,
+		},
+		"bits": {
+			src: model.Condition{
+				Key:  "flags",
+				Op:   model.OpBitsAllSet,
+				Val:  5,
+				Unit: "km",
+			},
+			err: unit.ErrIncompatible,
+		},
+		"mod": {
+			src: model.Condition{
+				Key: "minute",
+				Op:  model.OpMod,
+				Mod: model.Mod{
+					Div: 15,
+				},
+				Unit: "min",
+			},
+			err: unit.ErrIncompatible,
+		},
+		"anomaly": {
+			src: model.Condition{
+				Key:  "t",
+				Op:   model.OpAnomaly,
+				Val:  3,
+				Unit: "°C",
+			},
+			dst: model.Condition{
+				Key:  "t",
+				Op:   model.OpAnomaly,
+				Val:  3,
+				Unit: "K",
+			},
+		},
+		"window avg": {
+			src: model.Condition{
+				Key:  "t",
+				Op:   model.OpGt,
+				Val:  30,
+				Unit: "°C",
+				Window: model.Window{
+					Agg: model.AggAvg,
+					Dur: time.Minute,
+					Filter: model.WindowFilter{
+						Op:  model.OpGt,
+						Val: 20,
+					},
+				},
+			},
+			dst: model.Condition{
+				Key:  "t",
+				Op:   model.OpGt,
+				Val:  303.15,
+				Unit: "K",
+				Window: model.Window{
+					Agg: model.AggAvg,
+					Dur: time.Minute,
+					Filter: model.WindowFilter{
+						Op:  model.OpGt,
+						Val: 293.15,
+					},
+				},
+			},
+		},
+		"window count": {
+			src: model.Condition{
+				Key:  "d",
+				Op:   model.OpGt,
+				Val:  100,
+				Unit: "km",
+				Window: model.Window{
+					Agg: model.AggCount,
+					Dur: time.Hour,
+					Filter: model.WindowFilter{
+						Op:  model.OpGt,
+						Val: 1,
+					},
+				},
+			},
+			dst: model.Condition{
+				Key:  "d",
+				Op:   model.OpGt,
+				Val:  100,
+				Unit: "m",
+				Window: model.Window{
+					Agg: model.AggCount,
+					Dur: time.Hour,
+					Filter: model.WindowFilter{
+						Op:  model.OpGt,
+						Val: 1000,
+					},
+				},
+			},
+		},
+		"window sum": {
+			src: model.Condition{
+				Key:  "d",
+				Op:   model.OpGt,
+				Val:  2,
+				Unit: "km",
+				Window: model.Window{
+					Agg: model.AggSum,
+					Dur: time.Hour,
+				},
+			},
+			dst: model.Condition{
+				Key:  "d",
+				Op:   model.OpGt,
+				Val:  2000,
+				Unit: "m",
+				Window: model.Window{
+					Agg: model.AggSum,
+					Dur: time.Hour,
+				},
+			},
+		},
+		"window sum with offset": {
+			src: model.Condition{
+				Key:  "t",
+				Op:   model.OpGt,
+				Val:  2,
+				Unit: "°C",
+				Window: model.Window{
+					Agg: model.AggSum,
+					Dur: time.Hour,
+				},
+			},
+			err: unit.ErrIncompatible,
+		},
+		"unknown unit": {
+			src: model.Condition{
+				Key:  "k",
+				Op:   model.OpGt,
+				Unit: "parsec",
+			},
+			err: unit.ErrUnknown,
+		},
+		"cross-attribute": {
+			src: model.Condition{
+				Terms: []model.Term{
+					{
+						Key:  "k",
+						Coef: 1,
+					},
+				},
+				Op:   model.OpGt,
+				Unit: "km",
+			},
+			err: unit.ErrIncompatible,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			spy := &storageSpy{
+				Storage: storage.NewStorageMock(),
+			}
+			svc := NewServiceUnits(NewService(spy), unit.NewDefaultRegistry())
+			_, err := svc.Create(context.TODO(), "interest1", c.src)
+			assert.ErrorIs(t, err, c.err)
+			if c.err == nil {
+				assert.Equal(t, c.dst.Unit, spy.cond.Unit)
+				assert.InDelta(t, c.dst.Val, spy.cond.Val, 1e-9)
+				assert.InDelta(t, c.dst.Range.Min, spy.cond.Range.Min, 1e-9)
+				assert.InDelta(t, c.dst.Range.Max, spy.cond.Range.Max, 1e-9)
+				assert.InDelta(t, c.dst.Tolerance.Abs, spy.cond.Tolerance.Abs, 1e-9)
+				assert.InDelta(t, c.dst.Hysteresis, spy.cond.Hysteresis, 1e-9)
+				assert.Equal(t, c.dst.Tolerance.Rel, spy.cond.Tolerance.Rel)
+				assert.Equal(t, c.dst.Vals, spy.cond.Vals)
+				assert.Equal(t, c.dst.Relative, spy.cond.Relative)
+				assert.Equal(t, c.dst.Dec, spy.cond.Dec)
+				assert.Equal(t, c.dst.Int, spy.cond.Int)
+			}
+		})
+	}
+}
+
+func TestServiceUnits_SearchPage(t *testing.T) {
+	cases := map[string]struct {
+		src model.Attr
+		dst model.Attr
+		err error
+	}{
+		"no unit": {
+			src: model.Attr{
+				Key: "k",
+				Val: 1,
+			},
+			dst: model.Attr{
+				Key: "k",
+				Val: 1,
+			},
+		},
+		"MB": {
+			src: model.Attr{
+				Key:  "size",
+				Val:  1.5,
+				Unit: "MB",
+			},
+			dst: model.Attr{
+				Key:  "size",
+				Val:  1.5e6,
+				Unit: "B",
+			},
+		},
+		"decimal": {
+			src: model.Attr{
+				Key:  "size",
+				Dec:  "1.5",
+				Unit: "ms",
+			},
+			dst: model.Attr{
+				Key:  "size",
+				Dec:  "0.0015",
+				Unit: "s",
+			},
+		},
+		"unknown unit": {
+			src: model.Attr{
+				Key:  "k",
+				Unit: "parsec",
+			},
+			err: unit.ErrUnknown,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			spy := &storageSpy{
+				Storage: storage.NewStorageMock(),
+			}
+			svc := NewServiceUnits(NewService(spy), unit.NewDefaultRegistry())
+			_, _, err := svc.SearchPage(context.TODO(), c.src, 1, "")
+			assert.ErrorIs(t, err, c.err)
+			if c.err == nil {
+				assert.Equal(t, c.dst, spy.attr)
+			}
+		})
+	}
+}
+
+func TestServiceUnits_SearchPage_Stats(t *testing.T) {
+	svc := NewServiceUnits(NewService(storage.NewStorageMock()), unit.NewDefaultRegistry())
+	_, stats, err := svc.SearchPage(context.TODO(), model.Attr{Key: "latency", Val: 5, Unit: "ms"}, 1, "")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), stats.Count)
+	assert.InDelta(t, 2000, stats.Mean, 1e-9)
+	assert.InDelta(t, 2e6, stats.M2, 1e-3)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
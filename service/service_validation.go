@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/awakari/conditions-number/model"
+	"github.com/awakari/conditions-number/storage"
+	"math"
+)
+
+type serviceValidation struct {
+	svc Service
+}
+
+// keyLenMax is the max length of the attribute key in bytes.
+const keyLenMax = 256
+
+// idLenMax is the max length of the condition, interest and entity ids in bytes.
+const idLenMax = 256
+
+var errEmpty = errors.New("should not be empty")
+
+// NewServiceValidation returns the service rejecting the invalid requests with storage.InvalidError before passing
+// those to the underlying service.
+func NewServiceValidation(svc Service) Service {
+	return serviceValidation{
+		svc: svc,
+	}
+}
+
+func (sv serviceValidation) Create(ctx context.Context, interestId string, cond model.Condition) (id string, err error) {
+	err = validateInterestId(interestId)
+	if err == nil {
+		err = validateCondition(cond)
+	}
+	if err == nil {
+		id, err = sv.svc.Create(ctx, interestId, cond)
+	}
+	return
+}
+
+func (sv serviceValidation) LockCreate(ctx context.Context, id string) (err error) {
+	err = validateId(id)
+	if err == nil {
+		err = sv.svc.LockCreate(ctx, id)
+	}
+	return
+}
+
+func (sv serviceValidation) UnlockCreate(ctx context.Context, id string) (err error) {
+	err = validateId(id)
+	if err == nil {
+		err = sv.svc.UnlockCreate(ctx, id)
+	}
+	return
+}
+
+func (sv serviceValidation) Delete(ctx context.Context, interestId, id string) (err error) {
+	err = validateInterestId(interestId)
+	if err == nil {
+		err = validateId(id)
+	}
+	if err == nil {
+		err = sv.svc.Delete(ctx, interestId, id)
+	}
+	return
+}
+
+func (sv serviceValidation) SearchPage(ctx context.Context, attr model.Attr, limit uint32, cursor string) (ids []string, stats model.Stats, err error) {
+	err = validateKey("key", attr.Key)
+	if err == nil {
+		err = validateLen("entity", attr.Entity, idLenMax)
+	}
+	if err == nil {
+		err = validateFinite("val", attr.Val)
+	}
+	if err == nil {
+		ids, stats, err = sv.svc.SearchPage(ctx, attr, limit, cursor)
+	}
+	return
+}
+
+func (sv serviceValidation) SearchMultiPage(ctx context.Context, attrs map[string]float64, limit uint32, cursor string) (ids []string, err error) {
+	for k, v := range attrs {
+		err = validateKey("attrs", k)
+		if err == nil {
+			err = validateFinite("attrs", v)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		ids, err = sv.svc.SearchMultiPage(ctx, attrs, limit, cursor)
+	}
+	return
+}
+
+func validateCondition(cond model.Condition) (err error) {
+	if !cond.Op.IsDefined() {
+		err = invalidf("op", "undefined operation %d", cond.Op)
+	}
+	if err == nil {
+		err = validateLen("key", cond.Key, keyLenMax)
+	}
+	if err == nil && cond.KeyMatch != model.KeyMatchExact && cond.Key == "" {
+		err = invalidf("key", "key pattern %w", errEmpty)
+	}
+	if err == nil && len(cond.Terms) > 0 && !cond.Op.IsComparison() {
+		err = invalidf("terms", "cross-attribute condition supports the comparison operations only")
+	}
+	for i := 0; err == nil && i < len(cond.Terms); i++ {
+		err = validateKey("terms", cond.Terms[i].Key)
+		if err == nil {
+			err = validateFinite("terms", cond.Terms[i].Coef)
+		}
+	}
+	if err == nil {
+		err = validateFinite("val", cond.Val)
+	}
+	if err == nil {
+		err = validateFinite("vals", cond.Vals...)
+	}
+	if err == nil {
+		err = validateFinite("range", cond.Range.Min, cond.Range.Max)
+	}
+	if err == nil && cond.Op == model.OpRange && cond.Range.Min > cond.Range.Max {
+		err = invalidf("range", "min %g should not be greater than max %g", cond.Range.Min, cond.Range.Max)
+	}
+	if err == nil {
+		err = validateNonNegative("tolerance", cond.Tolerance.Abs, cond.Tolerance.Rel)
+	}
+	if err == nil {
+		err = validateNonNegative("hysteresis", cond.Hysteresis)
+	}
+	if err == nil {
+		err = validateExact(cond)
+	}
+	if err == nil && !cond.Window.IsZero() {
+		err = validateWindow(cond)
+	}
+	if err == nil {
+		err = validateOp(cond)
+	}
+	if err == nil {
+		if errNot := cond.ValidateNot(); errNot != nil {
+			err = storage.InvalidError{Field: "not", Err: errNot}
+		}
+	}
+	return
+}
+
+func validateWindow(cond model.Condition) (err error) {
+	w := cond.Window
+	switch {
+	case w.Agg < model.AggCount || w.Agg > model.AggMax:
+		err = invalidf("window", "undefined aggregate %d", w.Agg)
+	case w.Dur <= 0:
+		err = invalidf("window", "duration %s should be positive", w.Dur)
+	case len(cond.Terms) > 0:
+		err = invalidf("window", "cross-attribute condition can not be windowed")
+	case !cond.Op.IsComparison():
+		err = invalidf("window", "windowed aggregate is supported by the comparison operations only")
+	case cond.Relative, cond.Dec != "", cond.Int != nil:
+		err = invalidf("window", "windowed aggregate value should be absolute and not exact")
+	case w.Filter.Op != model.OpUndefined && !w.Filter.Op.IsComparison():
+		err = invalidf("window", "filter supports the comparison operations only")
+	default:
+		err = validateFinite("window", w.Filter.Val)
+	}
+	return
+}
+
+// validateOp checks the values specific to the operation.
+func validateOp(cond model.Condition) (err error) {
+	var cause error
+	var field string
+	switch {
+	case cond.Op.IsBitwise():
+		_, cause = cond.BitMask()
+		field = "val"
+	case cond.Op == model.OpMod:
+		cause = cond.Mod.Validate()
+		field = "mod"
+	case cond.Op == model.OpCyclicRange:
+		_, cause = cond.CyclicRange()
+		field = "period"
+	case cond.Op == model.OpChange && cond.Val < 0:
+		cause = fmt.Errorf("change %g should not be negative", cond.Val)
+		field = "val"
+	case cond.Op == model.OpAnomaly && cond.Val < 0:
+		cause = fmt.Errorf("deviation %g sigma should not be negative", cond.Val)
+		field = "val"
+	}
+	if cause != nil {
+		err = storage.InvalidError{Field: field, Err: cause}
+	}
+	return
+}
+
+// validateExact checks the exact value is set once and only for the operation comparing it, the rest ignore it.
+func validateExact(cond model.Condition) (err error) {
+	switch {
+	case cond.Dec != "" && cond.Int != nil:
+		err = invalidf("int", "exact integer value should not be set together with the exact decimal one")
+	case cond.Op.IsComparison(), cond.Op.IsBitwise():
+	case cond.Dec != "":
+		err = invalidf("dec", "exact value is not supported by the operation %s", cond.Op)
+	case cond.Int != nil:
+		err = invalidf("int", "exact value is not supported by the operation %s", cond.Op)
+	}
+	return
+}
+
+func validateId(id string) (err error) {
+	switch id {
+	case "":
+		err = storage.InvalidError{Field: "id", Err: errEmpty}
+	default:
+		err = validateLen("id", id, idLenMax)
+	}
+	return
+}
+
+func validateInterestId(interestId string) (err error) {
+	switch interestId {
+	case "":
+		err = storage.InvalidError{Field: "interestId", Err: errEmpty}
+	default:
+		err = validateLen("interestId", interestId, idLenMax)
+	}
+	return
+}
+
+func validateKey(field, k string) (err error) {
+	switch k {
+	case "":
+		err = invalidf(field, "key %w", errEmpty)
+	default:
+		err = validateLen(field, k, keyLenMax)
+	}
+	return
+}
+
+func validateLen(field, s string, max int) (err error) {
+	if len(s) > max {
+		err = invalidf(field, "length %d exceeds the limit %d", len(s), max)
+	}
+	return
+}
+
+func validateFinite(field string, vals ...float64) (err error) {
+	for _, v := range vals {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			err = invalidf(field, "value %g should be a finite number", v)
+			break
+		}
+	}
+	return
+}
+
+func validateNonNegative(field string, vals ...float64) (err error) {
+	err = validateFinite(field, vals...)
+	for _, v := range vals {
+		if err == nil && v < 0 {
+			err = invalidf(field, "value %g should not be negative", v)
+		}
+	}
+	return
+}
+
+func invalidf(field, format string, args ...any) error {
+	return storage.InvalidError{
+		Field: field,
+		Err:   fmt.Errorf(format, args...),
+	}
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"github.com/awakari/conditions-number/model"
+	"github.com/awakari/conditions-number/storage"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServiceValidation_Create(t *testing.T) {
+	svc := NewServiceValidation(NewService(storage.NewStorageMock()))
+	cases := map[string]struct {
+		cond  model.Condition
+		field string
+	}{
+		"ok": {
+			cond: model.Condition{
+				Key: "x",
+				Op:  model.OpGt,
+				Val: 1,
+			},
+		},
+		"ok any key": {
+			cond: model.Condition{
+				Op: model.OpGt,
+			},
+		},
+		"undefined op": {
+			cond: model.Condition{
+				Key: "x",
+			},
+			field: "op",
+		},
+		"unknown op": {
+			cond: model.Condition{
+				Key: "x",
+				Op:  model.Op(100),
+			},
+			field: "op",
+		},
+		"long key": {
+			cond: model.Condition{
+				Key: strings.Repeat("x", keyLenMax+1),
+				Op:  model.OpGt,
+			},
+			field: "key",
+		},
+		"empty key pattern": {
+			cond: model.Condition{
+				KeyMatch: model.KeyMatchPrefix,
+				Op:       model.OpGt,
+			},
+			field: "key",
+		},
+		"inf": {
+			cond: model.Condition{
+				Key: "x",
+				Op:  model.OpGt,
+				Val: math.Inf(1),
+			},
+			field: "val",
+		},
+		"nan range": {
+			cond: model.Condition{
+				Key: "x",
+				Op:  model.OpRange,
+				Range: model.Range{
+					Max: math.NaN(),
+				},
+			},
+			field: "range",
+		},
+		"inverted range": {
+			cond: model.Condition{
+				Key: "x",
+				Op:  model.OpRange,
+				Range: model.Range{
+					Min: 2,
+					Max: 1,
+				},
+			},
+			field: "range",
+		},
+		"negative tolerance": {
+			cond: model.Condition{
+				Key: "x",
+				Op:  model.OpEq,
+				Tolerance: model.Tolerance{
+					Rel: -0.1,
+				},
+			},
+			field: "tolerance",
+		},
+		"negative hysteresis": {
+			cond: model.Condition{
+				Key:        "x",
+				Op:         model.OpCrossAbove,
+				Hysteresis: -1,
+			},
+			field: "hysteresis",
+		},
+		"terms with range": {
+			cond: model.Condition{
+				Op: model.OpRange,
+				Terms: []model.Term{
+					{
+						Key:  "a",
+						Coef: 1,
+					},
+				},
+			},
+			field: "terms",
+		},
+		"empty term key": {
+			cond: model.Condition{
+				Op: model.OpLt,
+				Terms: []model.Term{
+					{
+						Coef: 1,
+					},
+				},
+			},
+			field: "terms",
+		},
+		"window without duration": {
+			cond: model.Condition{
+				Key: "x",
+				Op:  model.OpGt,
+				Window: model.Window{
+					Agg: model.AggAvg,
+				},
+			},
+			field: "window",
+		},
+		"window with terms": {
+			cond: model.Condition{
+				Op: model.OpGt,
+				Terms: []model.Term{
+					{
+						Key:  "a",
+						Coef: 1,
+					},
+				},
+				Window: model.Window{
+					Agg: model.AggSum,
+					Dur: time.Minute,
+				},
+			},
+			field: "window",
+		},
+		"window with range": {
+			cond: model.Condition{
+				Key: "x",
+				Op:  model.OpRange,
+				Window: model.Window{
+					Agg: model.AggMax,
+					Dur: time.Minute,
+				},
+			},
+			field: "window",
+		},
+		"invalid bit mask": {
+			cond: model.Condition{
+				Key: "x",
+				Op:  model.OpBitsAllSet,
+				Val: -1,
+			},
+			field: "val",
+		},
+		"zero divisor": {
+			cond: model.Condition{
+				Key: "x",
+				Op:  model.OpMod,
+			},
+			field: "mod",
+		},
+		"zero period": {
+			cond: model.Condition{
+				Key: "x",
+				Op:  model.OpCyclicRange,
+			},
+			field: "period",
+		},
+		"dec and int": {
+			cond: model.Condition{
+				Key: "x",
+				Op:  model.OpGt,
+				Dec: "5",
+				Int: ptr(int64(5)),
+			},
+			field: "int",
+		},
+		"dec with range": {
+			cond: model.Condition{
+				Key: "x",
+				Op:  model.OpRange,
+				Dec: "5",
+			},
+			field: "dec",
+		},
+		"int with crossing": {
+			cond: model.Condition{
+				Key: "x",
+				Op:  model.OpCrossAbove,
+				Int: ptr(int64(5)),
+			},
+			field: "int",
+		},
+		"negative sigma": {
+			cond: model.Condition{
+				Key: "x",
+				Op:  model.OpAnomaly,
+				Val: -3,
+			},
+			field: "val",
+		},
+		"negative relative change": {
+			cond: model.Condition{
+				Key: "x",
+				Op:  model.OpChange,
+				Val: -0.1,
+				Change: model.Change{
+					Rel: true,
+				},
+			},
+			field: "val",
+		},
+		"not stateful": {
+			cond: model.Condition{
+				Key: "x",
+				Op:  model.OpAnomaly,
+				Val: 3,
+				Not: true,
+			},
+			field: "not",
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			_, err := svc.Create(context.TODO(), "interest1", c.cond)
+			switch c.field {
+			case "":
+				assert.Nil(t, err)
+			default:
+				assert.ErrorIs(t, err, storage.ErrInvalid)
+				var errInvalid storage.InvalidError
+				assert.ErrorAs(t, err, &errInvalid)
+				assert.Equal(t, c.field, errInvalid.Field)
+			}
+		})
+	}
+}
+
+func TestServiceValidation_Create_EmptyInterestId(t *testing.T) {
+	svc := NewServiceValidation(NewService(storage.NewStorageMock()))
+	_, err := svc.Create(context.TODO(), "", model.Condition{Key: "x", Op: model.OpGt})
+	var errInvalid storage.InvalidError
+	assert.ErrorAs(t, err, &errInvalid)
+	assert.Equal(t, "interestId", errInvalid.Field)
+}
+
+func TestServiceValidation_Delete(t *testing.T) {
+	svc := NewServiceValidation(NewService(storage.NewStorageMock()))
+	assert.Nil(t, svc.Delete(context.TODO(), "interest1", "cond0"))
+	assert.ErrorIs(t, svc.Delete(context.TODO(), "", "cond0"), storage.ErrInvalid)
+	assert.ErrorIs(t, svc.Delete(context.TODO(), "interest1", ""), storage.ErrInvalid)
+	assert.ErrorIs(t, svc.Delete(context.TODO(), "interest1", strings.Repeat("0", idLenMax+1)), storage.ErrInvalid)
+	assert.ErrorIs(t, svc.LockCreate(context.TODO(), ""), storage.ErrInvalid)
+	assert.ErrorIs(t, svc.UnlockCreate(context.TODO(), ""), storage.ErrInvalid)
+}
+
+func TestServiceValidation_SearchPage(t *testing.T) {
+	svc := NewServiceValidation(NewService(storage.NewStorageMock()))
+	_, _, err := svc.SearchPage(context.TODO(), model.Attr{Key: "x", Val: 1}, 1, "")
+	assert.Nil(t, err)
+	_, _, err = svc.SearchPage(context.TODO(), model.Attr{Val: 1}, 1, "")
+	assert.ErrorIs(t, err, storage.ErrInvalid)
+	_, _, err = svc.SearchPage(context.TODO(), model.Attr{Key: "x", Val: math.NaN()}, 1, "")
+	assert.ErrorIs(t, err, storage.ErrInvalid)
+	_, _, err = svc.SearchPage(context.TODO(), model.Attr{Key: "x", Val: 1, Entity: strings.Repeat("e", idLenMax+1)}, 1, "")
+	assert.ErrorIs(t, err, storage.ErrInvalid)
+	_, err = svc.SearchMultiPage(context.TODO(), map[string]float64{"a": 1, "": 2}, 1, "")
+	assert.ErrorIs(t, err, storage.ErrInvalid)
+	_, err = svc.SearchMultiPage(context.TODO(), map[string]float64{"a": math.Inf(1)}, 1, "")
+	assert.ErrorIs(t, err, storage.ErrInvalid)
+}
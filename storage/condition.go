@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"github.com/awakari/conditions-number/model"
+	"maps"
+	"slices"
+)
+
+// CanonicalCondition validates the condition and returns it in the form not depending on the request details like the
+// order of the terms or the values set, so the same condition is stored once. It's the same as the database storage
+// encodes the condition: the terms having the same key are merged, the cyclic range bounds are taken modulo the period.
+func CanonicalCondition(src model.Condition) (dst model.Condition, err error) {
+	dst = src
+	switch {
+	case src.Dec != "" && src.Op.IsComparison() && src.Window.IsZero():
+		// the same value has the same text, e.g. "1.0" and "1"
+		dst.Dec, err = model.ParseDecimal(string(src.Dec))
+	case src.Op.IsBitwise():
+		_, err = src.BitMask()
+	}
+	if err == nil {
+		switch src.Op {
+		case model.OpMod:
+			err = src.Mod.Validate()
+		case model.OpCyclicRange:
+			dst.Range, err = src.CyclicRange()
+		case model.OpIn, model.OpNotIn:
+			dst.Vals = slices.Clone(src.Vals)
+			slices.Sort(dst.Vals)
+			dst.Vals = slices.Compact(dst.Vals)
+		}
+	}
+	if err == nil {
+		err = src.ValidateNot()
+	}
+	if err == nil && len(src.Terms) > 0 {
+		dst.Key = ""
+		coefs := map[string]float64{}
+		for _, t := range src.Terms {
+			coefs[t.Key] += t.Coef
+		}
+		dst.Terms = nil
+		for _, k := range slices.Sorted(maps.Keys(coefs)) {
+			dst.Terms = append(dst.Terms, model.Term{
+				Key:  k,
+				Coef: coefs[k],
+			})
+		}
+	}
+	if src.Int != nil {
+		i := *src.Int
+		dst.Int = &i
+	}
+	return
+}
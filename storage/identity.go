@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"github.com/awakari/conditions-number/model"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Identity is the canonical condition fields covered by the database storage unique index, so the same conditions are
+// the same in every storage. The fields not used by the condition operation are left zero. The values are kept exact
+// as the database compares the numbers of the different types by their values, e.g. the decimal "1.0" and the float 1.
+type Identity struct {
+	Key          string
+	KeyMatch     model.KeyMatch
+	Terms        string
+	Op           model.Op
+	Val          string
+	ValInt       int64
+	IsInt        bool
+	Unit         string
+	Relative     bool
+	Not          bool
+	Window       model.Window
+	Hysteresis   float64
+	Change       model.Change
+	Mod          model.Mod
+	Period       float64
+	RangeMax     float64
+	RangeMinIncl bool
+	RangeMaxIncl bool
+	Vals         string
+	Tolerant     bool
+	EqMin        float64
+	EqMax        float64
+}
+
+// ConditionIdentity returns the identity of the canonical condition, see CanonicalCondition.
+func ConditionIdentity(cond model.Condition) (id Identity) {
+	id = Identity{
+		Key:      cond.Key,
+		KeyMatch: cond.KeyMatch,
+		Op:       cond.Op,
+		Val:      exactString(cond.Val),
+		Unit:     cond.Unit,
+		Relative: cond.Relative,
+		Not:      cond.Not,
+		Window:   cond.Window,
+	}
+	approxVal := cond.Val
+	switch {
+	case !cond.Window.IsZero():
+	case cond.Dec != "" && cond.Op.IsComparison():
+		id.Val = cond.Dec.Rat().RatString()
+		approxVal = cond.Dec.Float64()
+	case cond.Op.IsBitwise():
+		id.Val = ""
+		id.ValInt, _ = cond.BitMask()
+		id.IsInt = true
+	case cond.Int != nil && cond.Op.IsComparison():
+		id.Val = ""
+		id.ValInt, id.IsInt = *cond.Int, true
+		approxVal = float64(*cond.Int)
+	}
+	if len(cond.Terms) > 0 {
+		var sb strings.Builder
+		for i, t := range cond.Terms {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(strconv.FormatFloat(t.Coef, 'g', -1, 64))
+			sb.WriteByte('*')
+			sb.WriteString(strconv.Quote(t.Key))
+		}
+		id.Key = ""
+		id.Terms = sb.String()
+	}
+	switch cond.Op {
+	case model.OpEq:
+		if !cond.Tolerance.IsZero() {
+			id.Tolerant = true
+			id.EqMin, id.EqMax = cond.Tolerance.Bounds(approxVal)
+		}
+	case model.OpRange, model.OpCyclicRange:
+		id.Val = exactString(cond.Range.Min)
+		id.RangeMax = cond.Range.Max
+		id.RangeMinIncl = cond.Range.MinInclusive
+		id.RangeMaxIncl = cond.Range.MaxInclusive
+		if cond.Op == model.OpCyclicRange {
+			id.Period = cond.Period
+		}
+	case model.OpCrossAbove, model.OpCrossBelow:
+		id.Hysteresis = cond.Hysteresis
+	case model.OpChange:
+		id.Change = cond.Change
+	case model.OpMod:
+		id.Val = ""
+		id.Mod = cond.Mod
+	case model.OpIn, model.OpNotIn:
+		id.Val = ""
+		var sb strings.Builder
+		for i, v := range cond.Vals {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		id.Vals = sb.String()
+	}
+	return
+}
+
+// exactString returns the exact value of the finite number.
+func exactString(f float64) (s string) {
+	switch r := new(big.Rat).SetFloat64(f); r {
+	case nil:
+		s = strconv.FormatFloat(f, 'g', -1, 64)
+	default:
+		s = r.RatString()
+	}
+	return
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"github.com/awakari/conditions-number/model"
+	"time"
+)
+
+// AttrMatch evaluates the stored conditions one by one against the attribute value, it's used by the storages not
+// able to select the matching conditions by the query alone.
+type AttrMatch struct {
+	attr      model.Attr
+	now       time.Time
+	prev      float64
+	prevFound bool
+	stats     model.Stats
+	state     State
+}
+
+// NewAttrMatch returns the evaluation of the attribute value. The change and the anomaly flags tell whether such
+// conditions exist for the attribute, the value is observed and the statistics are updated only then, the same as the
+// database storage does. The first page (empty cursor) observes the value and updates the statistics, the following
+// pages reuse the same previous value and statistics.
+func NewAttrMatch(
+	ctx context.Context,
+	state State,
+	stats Stats,
+	attr model.Attr,
+	cursor string,
+	now time.Time,
+	change, anomaly bool,
+) (am AttrMatch, err error) {
+	am.attr = attr
+	am.now = now
+	am.state = state
+	if change {
+		switch cursor {
+		case "":
+			am.prev, am.prevFound, err = state.Observe(ctx, attr)
+		default:
+			am.prev, am.prevFound, err = state.Previous(ctx, attr)
+		}
+	}
+	if err == nil && anomaly {
+		switch cursor {
+		case "":
+			am.stats, err = stats.Update(ctx, attr)
+		default:
+			am.stats, err = stats.Get(ctx, attr)
+		}
+	}
+	return
+}
+
+// Stats returns the attribute values statistics preceding the value.
+func (am AttrMatch) Stats() model.Stats {
+	return am.stats
+}
+
+// Matches reports whether the condition holds for the attribute value, the stateful condition updates its state.
+func (am AttrMatch) Matches(ctx context.Context, condId string, cond model.Condition) (ok bool, err error) {
+	v := am.attr.Float64()
+	switch {
+	case cond.Unit != am.attr.Unit || !cond.MatchesKey(am.attr.Key):
+	case cond.Op.IsCrossing():
+		// the state is updated only beyond the threshold or the re-arm level, the same as the database storage does
+		if beyond, rearms := cond.Crossing(v); beyond || rearms {
+			ok, err = am.state.Cross(ctx, condId, cond, am.attr)
+		}
+	case !cond.Window.IsZero():
+		var agg float64
+		agg, ok, err = am.state.Aggregate(ctx, condId, cond, am.attr, am.now)
+		ok = ok && cond.MatchesAggregate(agg)
+	case cond.Op == model.OpChange:
+		ok = am.prevFound && cond.Changed(am.prev, v)
+	case cond.Op == model.OpAnomaly:
+		ok = cond.Deviates(am.stats, v)
+	default:
+		ok = cond.MatchesAttrAt(am.attr, am.now)
+	}
+	return
+}
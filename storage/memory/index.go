@@ -0,0 +1,124 @@
+package memory
+
+import (
+	"github.com/awakari/conditions-number/model"
+	"slices"
+	"sort"
+)
+
+// keyIndex selects the candidate conditions of the same key by the attribute value, see model.Condition.ValBounds.
+// The candidates are a superset of the matching conditions, the caller evaluates each candidate.
+type keyIndex struct {
+	// above is the conditions holding for the values above the lower bound, sorted by it, e.g. "x > 1".
+	above []bound
+	// below is the conditions holding for the values below the upper bound, sorted by it, e.g. "x < 1".
+	below []bound
+	// intervals is the conditions holding for the values within the bounds, sorted by the lower one, e.g. "x = 1 ~ 0.1".
+	intervals []interval
+	// other is the conditions not represented by an interval, e.g. the stateful or negated ones.
+	other map[string]*record
+}
+
+type bound struct {
+	v   float64
+	rec *record
+}
+
+type interval struct {
+	min float64
+	max float64
+	rec *record
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{
+		other: map[string]*record{},
+	}
+}
+
+func (ki *keyIndex) add(rec *record) {
+	min, max := rec.cond.ValBounds()
+	switch {
+	case min == nil && max == nil:
+		ki.other[rec.id] = rec
+	case max == nil:
+		i := sort.Search(len(ki.above), func(i int) bool {
+			return ki.above[i].v > *min
+		})
+		ki.above = slices.Insert(ki.above, i, bound{v: *min, rec: rec})
+	case min == nil:
+		i := sort.Search(len(ki.below), func(i int) bool {
+			return ki.below[i].v > *max
+		})
+		ki.below = slices.Insert(ki.below, i, bound{v: *max, rec: rec})
+	default:
+		i := sort.Search(len(ki.intervals), func(i int) bool {
+			return ki.intervals[i].min > *min
+		})
+		ki.intervals = slices.Insert(ki.intervals, i, interval{min: *min, max: *max, rec: rec})
+	}
+}
+
+func (ki *keyIndex) remove(rec *record) {
+	isRec := func(b bound) bool {
+		return b.rec == rec
+	}
+	ki.above = slices.DeleteFunc(ki.above, isRec)
+	ki.below = slices.DeleteFunc(ki.below, isRec)
+	ki.intervals = slices.DeleteFunc(ki.intervals, func(in interval) bool {
+		return in.rec == rec
+	})
+	delete(ki.other, rec.id)
+}
+
+func (ki *keyIndex) isEmpty() bool {
+	return len(ki.above) == 0 && len(ki.below) == 0 && len(ki.intervals) == 0 && len(ki.other) == 0
+}
+
+// statefulOps reports whether the change and the anomaly conditions exist for the attribute key and unit.
+func (ki *keyIndex) statefulOps(attr model.Attr) (change, anomaly bool) {
+	for _, rec := range ki.other {
+		if rec.cond.Unit == attr.Unit && rec.cond.MatchesKey(attr.Key) {
+			switch rec.cond.Op {
+			case model.OpChange:
+				change = true
+			case model.OpAnomaly:
+				anomaly = true
+			}
+		}
+	}
+	return
+}
+
+// candidates appends the conditions possibly holding for the value and having the id greater than the cursor.
+func (ki *keyIndex) candidates(dst []*record, v float64, cursor string) []*record {
+	appendAfter := func(rec *record) {
+		if rec.id > cursor {
+			dst = append(dst, rec)
+		}
+	}
+	end := sort.Search(len(ki.above), func(i int) bool {
+		return ki.above[i].v > v
+	})
+	for _, b := range ki.above[:end] {
+		appendAfter(b.rec)
+	}
+	start := sort.Search(len(ki.below), func(i int) bool {
+		return ki.below[i].v >= v
+	})
+	for _, b := range ki.below[start:] {
+		appendAfter(b.rec)
+	}
+	end = sort.Search(len(ki.intervals), func(i int) bool {
+		return ki.intervals[i].min > v
+	})
+	for _, in := range ki.intervals[:end] {
+		if in.max >= v {
+			appendAfter(in.rec)
+		}
+	}
+	for _, rec := range ki.other {
+		appendAfter(rec)
+	}
+	return dst
+}
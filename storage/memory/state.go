@@ -0,0 +1,193 @@
+package memory
+
+import (
+	"container/list"
+	"context"
+	"github.com/awakari/conditions-number/model"
+	"github.com/awakari/conditions-number/storage"
+	"sync"
+	"time"
+)
+
+type stateImpl struct {
+	lock    *sync.Mutex
+	limit   int
+	entries map[stateKey]*list.Element
+	// byCond is the entries of the conditions by the condition id, the values observed regardless of the conditions
+	// are not included
+	byCond map[string]map[stateKey]*list.Element
+	// lru is the list of the entries ordered from the most recently used one
+	lru *list.List
+}
+
+type stateKey struct {
+	condId string
+	key    string
+	entity string
+}
+
+type stateEntry struct {
+	k        stateKey
+	disarmed bool
+	last     *float64
+	prev     *float64
+	window   model.WindowState
+	stats    model.Stats
+	// statsPrev is the statistics preceding the last added value
+	statsPrev model.Stats
+}
+
+// stateCondIdNone is the condition id of the values observed regardless of the conditions.
+const stateCondIdNone = ""
+
+// NewState returns the state kept in memory, the least recently used entries are evicted over the limit.
+func NewState(limit int) storage.State {
+	return newStateImpl(limit)
+}
+
+// NewStats returns the statistics kept in memory, the least recently used entries are evicted over the limit.
+func NewStats(limit int) storage.Stats {
+	return newStateImpl(limit)
+}
+
+func newStateImpl(limit int) stateImpl {
+	return stateImpl{
+		lock:    &sync.Mutex{},
+		limit:   limit,
+		entries: map[stateKey]*list.Element{},
+		byCond:  map[string]map[stateKey]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+func (st stateImpl) Cross(ctx context.Context, condId string, cond model.Condition, attr model.Attr) (fires bool, err error) {
+	v := attr.Float64()
+	beyond, rearms := cond.Crossing(v)
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	e := st.entry(condId, attr)
+	fires = beyond && !e.disarmed
+	switch {
+	case beyond:
+		e.disarmed = true
+	case rearms:
+		e.disarmed = false
+	}
+	e.last = &v
+	return
+}
+
+func (st stateImpl) Observe(ctx context.Context, attr model.Attr) (prev float64, found bool, err error) {
+	v := attr.Float64()
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	e := st.entry(stateCondIdNone, attr)
+	e.prev, e.last = e.last, &v
+	if e.prev != nil {
+		prev, found = *e.prev, true
+	}
+	return
+}
+
+func (st stateImpl) Previous(ctx context.Context, attr model.Attr) (prev float64, found bool, err error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	elem, present := st.entries[stateKey{condId: stateCondIdNone, key: attr.Key, entity: attr.Entity}]
+	if present {
+		st.lru.MoveToFront(elem)
+		if e := elem.Value.(*stateEntry); e.prev != nil {
+			prev, found = *e.prev, true
+		}
+	}
+	return
+}
+
+func (st stateImpl) Aggregate(ctx context.Context, condId string, cond model.Condition, attr model.Attr, t time.Time) (agg float64, ok bool, err error) {
+	v := attr.Float64()
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	e := st.entry(condId, attr)
+	if cond.Window.Accepts(v) {
+		e.window = cond.Window.Add(e.window, t, v)
+	}
+	agg, ok = cond.Window.Aggregate(e.window, t)
+	return
+}
+
+func (st stateImpl) Update(ctx context.Context, attr model.Attr) (prev model.Stats, err error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	e := st.entry(stateCondIdNone, attr)
+	e.statsPrev = e.stats
+	e.stats = e.stats.Add(attr.Float64())
+	prev = e.statsPrev
+	return
+}
+
+func (st stateImpl) Get(ctx context.Context, attr model.Attr) (prev model.Stats, err error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	elem, present := st.entries[stateKey{condId: stateCondIdNone, key: attr.Key, entity: attr.Entity}]
+	if present {
+		st.lru.MoveToFront(elem)
+		prev = elem.Value.(*stateEntry).statsPrev
+	}
+	return
+}
+
+func (st stateImpl) Delete(ctx context.Context, condId string) (err error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	for k, elem := range st.byCond[condId] {
+		st.lru.Remove(elem)
+		delete(st.entries, k)
+	}
+	delete(st.byCond, condId)
+	return
+}
+
+// entry returns the existing or the new entry marking it as the most recently used one, the caller should hold the lock.
+func (st stateImpl) entry(condId string, attr model.Attr) (e *stateEntry) {
+	k := stateKey{
+		condId: condId,
+		key:    attr.Key,
+		entity: attr.Entity,
+	}
+	elem, present := st.entries[k]
+	switch present {
+	case true:
+		st.lru.MoveToFront(elem)
+		e = elem.Value.(*stateEntry)
+	default:
+		e = &stateEntry{
+			k: k,
+		}
+		elem = st.lru.PushFront(e)
+		st.entries[k] = elem
+		if condId != stateCondIdNone {
+			byKey, present := st.byCond[condId]
+			if !present {
+				byKey = map[stateKey]*list.Element{}
+				st.byCond[condId] = byKey
+			}
+			byKey[k] = elem
+		}
+		for st.lru.Len() > st.limit && st.lru.Len() > 1 {
+			oldest := st.lru.Back()
+			st.lru.Remove(oldest)
+			st.remove(oldest.Value.(*stateEntry).k)
+		}
+	}
+	return
+}
+
+// remove deletes the evicted entry from the indices, the caller should hold the lock.
+func (st stateImpl) remove(k stateKey) {
+	delete(st.entries, k)
+	if byKey, present := st.byCond[k.condId]; present {
+		delete(byKey, k)
+		if len(byKey) == 0 {
+			delete(st.byCond, k.condId)
+		}
+	}
+}
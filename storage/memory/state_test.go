@@ -0,0 +1,202 @@
+package memory
+
+import (
+	"context"
+	"github.com/awakari/conditions-number/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestStateImpl_Cross(t *testing.T) {
+	st := NewState(10)
+	ctx := context.TODO()
+	cond := model.Condition{
+		Op:         model.OpCrossAbove,
+		Val:        90,
+		Hysteresis: 5,
+	}
+	steps := []struct {
+		entity string
+		val    float64
+		fires  bool
+	}{
+		{
+			val: 50,
+		},
+		{
+			val:   91,
+			fires: true,
+		},
+		{
+			val: 95,
+		},
+		{
+			entity: "host2",
+			val:    95,
+			fires:  true,
+		},
+		{
+			val: 87,
+		},
+		{
+			val: 92,
+		},
+		{
+			val: 84,
+		},
+		{
+			val:   92,
+			fires: true,
+		},
+	}
+	for i, step := range steps {
+		fires, err := st.Cross(ctx, "cond0", cond, model.Attr{Key: "cpu", Val: step.val, Entity: step.entity})
+		require.Nil(t, err)
+		assert.Equal(t, step.fires, fires, "step %d", i)
+	}
+	require.Nil(t, st.Delete(ctx, "cond0"))
+	fires, err := st.Cross(ctx, "cond0", cond, model.Attr{Key: "cpu", Val: 99})
+	require.Nil(t, err)
+	assert.True(t, fires)
+}
+
+func TestStateImpl_Delete(t *testing.T) {
+	st := newStateImpl(2)
+	ctx := context.TODO()
+	cond := model.Condition{
+		Op:  model.OpCrossAbove,
+		Val: 90,
+	}
+	for _, e := range []string{"e0", "e1", "e2"} {
+		_, err := st.Cross(ctx, "cond0", cond, model.Attr{Key: "cpu", Val: 95, Entity: e})
+		require.Nil(t, err)
+	}
+	_, err := st.Cross(ctx, "cond1", cond, model.Attr{Key: "cpu", Val: 95})
+	require.Nil(t, err)
+	// e0 and e1 are evicted
+	assert.Len(t, st.byCond["cond0"], 1)
+	require.Nil(t, st.Delete(ctx, "cond0"))
+	assert.Len(t, st.entries, 1)
+	assert.NotContains(t, st.byCond, "cond0")
+	fires, err := st.Cross(ctx, "cond1", cond, model.Attr{Key: "cpu", Val: 95})
+	require.Nil(t, err)
+	assert.False(t, fires)
+}
+
+func TestStateImpl_Observe(t *testing.T) {
+	st := NewState(10)
+	ctx := context.TODO()
+	attr := model.Attr{Key: "price", Val: 100, Entity: "product1"}
+	_, found, err := st.Observe(ctx, attr)
+	require.Nil(t, err)
+	assert.False(t, found)
+	_, found, err = st.Previous(ctx, attr)
+	require.Nil(t, err)
+	assert.False(t, found)
+	attr.Val = 90
+	prev, found, err := st.Observe(ctx, attr)
+	require.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, float64(100), prev)
+	prev, found, err = st.Previous(ctx, attr)
+	require.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, float64(100), prev)
+	_, found, err = st.Observe(ctx, model.Attr{Key: "price", Val: 1, Entity: "product2"})
+	require.Nil(t, err)
+	assert.False(t, found)
+}
+
+func TestStateImpl_Aggregate(t *testing.T) {
+	st := NewState(10)
+	ctx := context.TODO()
+	cond := model.Condition{
+		Key: "amount",
+		Op:  model.OpGt,
+		Val: 1,
+		Window: model.Window{
+			Agg: model.AggCount,
+			Dur: time.Minute,
+			Filter: model.WindowFilter{
+				Op: model.OpGt,
+			},
+		},
+	}
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	steps := []struct {
+		t   time.Duration
+		val float64
+		agg float64
+	}{
+		{
+			val: 10,
+			agg: 1,
+		},
+		{
+			t:   10 * time.Second,
+			val: -10,
+			agg: 1,
+		},
+		{
+			t:   20 * time.Second,
+			val: 5,
+			agg: 2,
+		},
+		{
+			t:   70 * time.Second,
+			val: 5,
+			agg: 2,
+		},
+		{
+			t:   3 * time.Minute,
+			agg: 0,
+		},
+	}
+	for i, step := range steps {
+		agg, ok, err := st.Aggregate(ctx, "cond0", cond, model.Attr{Key: "amount", Val: step.val}, t0.Add(step.t))
+		require.Nil(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, step.agg, agg, "step %d", i)
+	}
+}
+
+func TestStateImpl_Limit(t *testing.T) {
+	st := NewState(2)
+	ctx := context.TODO()
+	for _, e := range []string{"e0", "e1", "e0", "e2"} {
+		_, _, err := st.Observe(ctx, model.Attr{Key: "k", Val: 1, Entity: e})
+		require.Nil(t, err)
+	}
+	// e1 is the least recently used one
+	_, found, err := st.Observe(ctx, model.Attr{Key: "k", Val: 2, Entity: "e1"})
+	require.Nil(t, err)
+	assert.False(t, found)
+	_, found, err = st.Observe(ctx, model.Attr{Key: "k", Val: 2, Entity: "e2"})
+	require.Nil(t, err)
+	assert.True(t, found)
+}
+
+func TestStateImpl_Stats(t *testing.T) {
+	st := NewStats(10)
+	ctx := context.TODO()
+	attr := model.Attr{Key: "latency", Val: 1}
+	prev, err := st.Update(ctx, attr)
+	require.Nil(t, err)
+	assert.Equal(t, model.Stats{}, prev)
+	attr.Val = 3
+	prev, err = st.Update(ctx, attr)
+	require.Nil(t, err)
+	assert.Equal(t, model.Stats{Count: 1, Mean: 1}, prev)
+	attr.Val = 8
+	prev, err = st.Update(ctx, attr)
+	require.Nil(t, err)
+	assert.Equal(t, model.Stats{Count: 2, Mean: 2, M2: 2}, prev)
+	prev, err = st.Get(ctx, attr)
+	require.Nil(t, err)
+	assert.Equal(t, model.Stats{Count: 2, Mean: 2, M2: 2}, prev)
+	prev, err = st.Get(ctx, model.Attr{Key: "latency", Entity: "host2"})
+	require.Nil(t, err)
+	assert.Zero(t, prev.Count)
+}
@@ -0,0 +1,341 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/awakari/conditions-number/config"
+	"github.com/awakari/conditions-number/model"
+	"github.com/awakari/conditions-number/storage"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type storageImpl struct {
+	lock          *sync.RWMutex
+	idx           *index
+	createLockTtl time.Duration
+	clock         model.Clock
+	state         storage.State
+	stats         storage.Stats
+}
+
+type index struct {
+	seq uint64
+	// recs is the conditions by id
+	recs map[string]*record
+	// identities is the conditions by the identity, the same condition is created once
+	identities map[storage.Identity]*record
+	// keys is the exact key conditions by key, the empty key ones match any attribute key
+	keys map[string]*keyIndex
+	// patterns is the prefix and glob key conditions by the key literal prefix
+	patterns map[string]*keyIndex
+	// terms is the cross-attribute conditions by every term key
+	terms map[string]map[string]*record
+	// absent is the negated exact key conditions, those match when the key is absent in the attributes set
+	absent map[string]*record
+}
+
+type record struct {
+	id              string
+	identity        storage.Identity
+	cond            model.Condition
+	createLockTime  time.Time
+	createLockCount int
+	// interests is the ids of the interests referencing the condition
+	interests map[string]struct{}
+}
+
+// idLen is the length of the condition id: the hex sequence number, so the ids order is the creation order.
+const idLen = 16
+
+// NewStorage returns the storage keeping everything in memory, nothing is shared between the replicas or persisted.
+// The clock defines the current time for the relative-time conditions search.
+func NewStorage(cfgDb config.DbConfig, clock model.Clock) storage.Storage {
+	st := newStateImpl(cfgDb.Table.State.Limit)
+	return storageImpl{
+		lock: &sync.RWMutex{},
+		idx: &index{
+			recs:       map[string]*record{},
+			identities: map[storage.Identity]*record{},
+			keys:       map[string]*keyIndex{},
+			patterns:   map[string]*keyIndex{},
+			terms:      map[string]map[string]*record{},
+			absent:     map[string]*record{},
+		},
+		createLockTtl: cfgDb.Table.LockTtl.Create,
+		clock:         clock,
+		state:         st,
+		stats:         st,
+	}
+}
+
+func (s storageImpl) Close() error {
+	return nil
+}
+
+func (s storageImpl) Create(ctx context.Context, interestId string, cond model.Condition) (id string, err error) {
+	cond, err = storage.CanonicalCondition(cond)
+	if err == nil {
+		identity := storage.ConditionIdentity(cond)
+		maxLockTime := time.Now().UTC().Add(-s.createLockTtl)
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		rec, present := s.idx.identities[identity]
+		switch {
+		case !present:
+			rec = s.idx.add(cond, identity)
+			id = rec.id
+		case rec.createLockCount > 0 && !rec.createLockTime.Before(maxLockTime):
+			err = fmt.Errorf("%w: condition %s is locked for creation, id=%s", storage.ErrConflict, cond, rec.id)
+		default:
+			id = rec.id
+		}
+		if err == nil {
+			rec.interests[interestId] = struct{}{}
+		}
+	}
+	return
+}
+
+func (s storageImpl) LockCreate(ctx context.Context, id string) (err error) {
+	err = validateId("id", id)
+	if err == nil {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		rec, present := s.idx.recs[id]
+		switch present {
+		case true:
+			rec.createLockTime = time.Now().UTC()
+			rec.createLockCount++
+		default:
+			err = fmt.Errorf("%w: id=%s", storage.ErrNotFound, id)
+		}
+	}
+	return
+}
+
+func (s storageImpl) UnlockCreate(ctx context.Context, id string) (err error) {
+	err = validateId("id", id)
+	if err == nil {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		// decrement if > 0, otherwise just skip
+		if rec, present := s.idx.recs[id]; present && rec.createLockCount > 0 {
+			rec.createLockCount--
+		}
+	}
+	return
+}
+
+func (s storageImpl) Delete(ctx context.Context, interestId, id string) (err error) {
+	err = validateId("id", id)
+	var deleted bool
+	if err == nil {
+		s.lock.Lock()
+		if rec, present := s.idx.recs[id]; present {
+			delete(rec.interests, interestId)
+			if len(rec.interests) == 0 {
+				s.idx.remove(rec)
+				deleted = true
+			}
+		}
+		s.lock.Unlock()
+	}
+	if deleted {
+		err = s.state.Delete(ctx, id)
+	}
+	return
+}
+
+func (s storageImpl) SearchPage(ctx context.Context, attr model.Attr, limit uint32, cursor string) (ids []string, stats model.Stats, err error) {
+	err = validateCursor(cursor)
+	var recs []*record
+	var change, anomaly bool
+	if err == nil {
+		v := attr.Float64()
+		s.lock.RLock()
+		kis := []*keyIndex{
+			s.idx.keys[attr.Key],
+		}
+		if attr.Key != "" {
+			kis = append(kis, s.idx.keys[""])
+		}
+		for _, prefix := range model.KeyPrefixes(attr.Key) {
+			kis = append(kis, s.idx.patterns[prefix])
+		}
+		for _, ki := range kis {
+			if ki != nil {
+				recs = ki.candidates(recs, v, cursor)
+				// the stateful conditions preceding the cursor still define whether the state is read
+				kiChange, kiAnomaly := ki.statefulOps(attr)
+				change, anomaly = change || kiChange, anomaly || kiAnomaly
+			}
+		}
+		s.lock.RUnlock()
+	}
+	var am storage.AttrMatch
+	if err == nil {
+		am, err = storage.NewAttrMatch(ctx, s.state, s.stats, attr, cursor, s.clock(), change, anomaly)
+		stats = am.Stats()
+	}
+	if err == nil {
+		accept := func(ctx context.Context, rec *record) (bool, error) {
+			return am.Matches(ctx, rec.id, rec.cond)
+		}
+		ids, err = searchPage(ctx, recs, limit, accept)
+	}
+	return
+}
+
+func (s storageImpl) SearchMultiPage(ctx context.Context, attrs map[string]float64, limit uint32, cursor string) (ids []string, err error) {
+	err = validateCursor(cursor)
+	var recs []*record
+	if err == nil {
+		s.lock.RLock()
+		// the cross-attribute condition is selected once even when referencing several keys
+		selected := map[string]*record{}
+		for k := range attrs {
+			maps.Copy(selected, s.idx.terms[k])
+		}
+		for id, rec := range s.idx.absent {
+			if _, present := attrs[rec.cond.Key]; !present {
+				selected[id] = rec
+			}
+		}
+		s.lock.RUnlock()
+		for id, rec := range selected {
+			if id > cursor {
+				recs = append(recs, rec)
+			}
+		}
+	}
+	if err == nil {
+		accept := func(ctx context.Context, rec *record) (ok bool, err error) {
+			ok = rec.cond.MatchesAttrs(attrs)
+			return
+		}
+		ids, err = searchPage(ctx, recs, limit, accept)
+	}
+	return
+}
+
+// searchPage returns up to the limit of the candidate conditions accepted by the accept function in the ids order, the
+// zero limit means no limit.
+func searchPage(
+	ctx context.Context,
+	recs []*record,
+	limit uint32,
+	accept func(ctx context.Context, rec *record) (ok bool, err error),
+) (ids []string, err error) {
+	slices.SortFunc(recs, func(a, b *record) int {
+		return strings.Compare(a.id, b.id)
+	})
+	for _, rec := range recs {
+		if limit > 0 && len(ids) >= int(limit) {
+			break
+		}
+		var ok bool
+		ok, err = accept(ctx, rec)
+		if err != nil {
+			break
+		}
+		if ok {
+			ids = append(ids, rec.id)
+		}
+	}
+	return
+}
+
+func (idx *index) add(cond model.Condition, identity storage.Identity) (rec *record) {
+	idx.seq++
+	rec = &record{
+		id:        fmt.Sprintf("%0*x", idLen, idx.seq),
+		identity:  identity,
+		cond:      cond,
+		interests: map[string]struct{}{},
+	}
+	idx.recs[rec.id] = rec
+	idx.identities[identity] = rec
+	switch {
+	case len(cond.Terms) > 0:
+		for _, t := range cond.Terms {
+			byId, present := idx.terms[t.Key]
+			if !present {
+				byId = map[string]*record{}
+				idx.terms[t.Key] = byId
+			}
+			byId[rec.id] = rec
+		}
+	case cond.KeyMatch == model.KeyMatchExact:
+		keyIndexFor(idx.keys, cond.Key).add(rec)
+		if cond.Not && cond.Key != "" {
+			idx.absent[rec.id] = rec
+		}
+	default:
+		keyIndexFor(idx.patterns, cond.KeyLiteralPrefix()).add(rec)
+	}
+	return
+}
+
+func (idx *index) remove(rec *record) {
+	delete(idx.recs, rec.id)
+	delete(idx.identities, rec.identity)
+	cond := rec.cond
+	switch {
+	case len(cond.Terms) > 0:
+		for _, t := range cond.Terms {
+			delete(idx.terms[t.Key], rec.id)
+			if len(idx.terms[t.Key]) == 0 {
+				delete(idx.terms, t.Key)
+			}
+		}
+	case cond.KeyMatch == model.KeyMatchExact:
+		removeFromKeyIndex(idx.keys, cond.Key, rec)
+		delete(idx.absent, rec.id)
+	default:
+		removeFromKeyIndex(idx.patterns, cond.KeyLiteralPrefix(), rec)
+	}
+}
+
+func keyIndexFor(idxs map[string]*keyIndex, k string) (ki *keyIndex) {
+	ki, present := idxs[k]
+	if !present {
+		ki = newKeyIndex()
+		idxs[k] = ki
+	}
+	return
+}
+
+func removeFromKeyIndex(idxs map[string]*keyIndex, k string, rec *record) {
+	if ki, present := idxs[k]; present {
+		ki.remove(rec)
+		if ki.isEmpty() {
+			delete(idxs, k)
+		}
+	}
+}
+
+func validateCursor(cursor string) (err error) {
+	if cursor != "" {
+		err = validateId("cursor", cursor)
+	}
+	return
+}
+
+func validateId(field, id string) (err error) {
+	_, err = strconv.ParseUint(id, 16, 64)
+	if err == nil && len(id) != idLen {
+		err = fmt.Errorf("length should be %d", idLen)
+	}
+	if err != nil {
+		err = storage.InvalidError{
+			Field: field,
+			Err:   err,
+		}
+	}
+	return
+}
@@ -0,0 +1,411 @@
+package memory
+
+import (
+	"context"
+	"github.com/awakari/conditions-number/config"
+	"github.com/awakari/conditions-number/model"
+	"github.com/awakari/conditions-number/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newTestStorage(ttl time.Duration) storage.Storage {
+	cfgDb := config.DbConfig{}
+	cfgDb.Table.LockTtl.Create = ttl
+	cfgDb.Table.State.Limit = 100
+	return NewStorage(cfgDb, time.Now)
+}
+
+func TestStorageImpl_Create(t *testing.T) {
+	s := newTestStorage(time.Minute)
+	ctx := context.TODO()
+	id0, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpIn, Vals: []float64{2, 1, 2}})
+	require.Nil(t, err)
+	assert.Len(t, id0, idLen)
+	id1, err := s.Create(ctx, "interest1", model.Condition{Key: "k0", Op: model.OpIn, Vals: []float64{1, 2}})
+	require.Nil(t, err)
+	assert.Equal(t, id0, id1)
+	id2, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpIn, Vals: []float64{1, 3}})
+	require.Nil(t, err)
+	assert.NotEqual(t, id0, id2)
+	//
+	id3, err := s.Create(ctx, "interest0", model.Condition{
+		Terms: []model.Term{{Key: "b", Coef: 1}, {Key: "a", Coef: -1}, {Key: "b", Coef: 1}},
+		Op:    model.OpGt,
+	})
+	require.Nil(t, err)
+	id4, err := s.Create(ctx, "interest1", model.Condition{
+		Terms: []model.Term{{Key: "a", Coef: -1}, {Key: "b", Coef: 2}},
+		Op:    model.OpGt,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, id3, id4)
+	//
+	id5, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpGt, Int: ptr(int64(1))})
+	require.Nil(t, err)
+	id6, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpGt, Int: ptr(int64(1))})
+	require.Nil(t, err)
+	assert.Equal(t, id5, id6)
+	// the same values as the database storage compares those
+	id7, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpGt, Dec: "1.0"})
+	require.Nil(t, err)
+	id8, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpGt, Dec: "1"})
+	require.Nil(t, err)
+	assert.Equal(t, id7, id8)
+	id9, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpGt, Val: 1})
+	require.Nil(t, err)
+	assert.Equal(t, id7, id9)
+	id10, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpGt, Dec: "0.1"})
+	require.Nil(t, err)
+	id11, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpGt, Val: 0.1})
+	require.Nil(t, err)
+	assert.NotEqual(t, id10, id11)
+	id12, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpEq, Val: 10, Tolerance: model.Tolerance{Abs: 1}})
+	require.Nil(t, err)
+	id13, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpEq, Val: 10, Tolerance: model.Tolerance{Rel: 0.1}})
+	require.Nil(t, err)
+	assert.Equal(t, id12, id13)
+	id14, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpGt, Val: 1, Range: model.Range{Max: 2}})
+	require.Nil(t, err)
+	assert.Equal(t, id9, id14)
+	//
+	_, err = s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpGt, Dec: "1.x"})
+	assert.ErrorIs(t, err, model.ErrInvalidDecimal)
+	_, err = s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpMod})
+	assert.ErrorIs(t, err, model.ErrInvalidMod)
+	_, err = s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpChange, Not: true})
+	assert.ErrorIs(t, err, model.ErrInvalidNot)
+}
+
+func TestStorageImpl_LockCreate(t *testing.T) {
+	s := newTestStorage(time.Minute)
+	ctx := context.TODO()
+	cond := model.Condition{Key: "k0", Op: model.OpGt, Val: 1}
+	id, err := s.Create(ctx, "interest0", cond)
+	require.Nil(t, err)
+	require.Nil(t, s.LockCreate(ctx, id))
+	_, err = s.Create(ctx, "interest1", cond)
+	assert.ErrorIs(t, err, storage.ErrConflict)
+	require.Nil(t, s.LockCreate(ctx, id))
+	require.Nil(t, s.UnlockCreate(ctx, id))
+	_, err = s.Create(ctx, "interest1", cond)
+	assert.ErrorIs(t, err, storage.ErrConflict)
+	require.Nil(t, s.UnlockCreate(ctx, id))
+	require.Nil(t, s.UnlockCreate(ctx, id))
+	id1, err := s.Create(ctx, "interest1", cond)
+	require.Nil(t, err)
+	assert.Equal(t, id, id1)
+	//
+	assert.ErrorIs(t, s.LockCreate(ctx, "00000000000000ff"), storage.ErrNotFound)
+	var errInvalid storage.InvalidError
+	assert.ErrorAs(t, s.LockCreate(ctx, "cond0"), &errInvalid)
+	assert.Equal(t, "id", errInvalid.Field)
+}
+
+func TestStorageImpl_LockCreate_Expired(t *testing.T) {
+	s := newTestStorage(time.Millisecond)
+	ctx := context.TODO()
+	cond := model.Condition{Key: "k0", Op: model.OpGt, Val: 1}
+	id, err := s.Create(ctx, "interest0", cond)
+	require.Nil(t, err)
+	require.Nil(t, s.LockCreate(ctx, id))
+	time.Sleep(10 * time.Millisecond)
+	id1, err := s.Create(ctx, "interest1", cond)
+	require.Nil(t, err)
+	assert.Equal(t, id, id1)
+}
+
+func TestStorageImpl_Delete(t *testing.T) {
+	s := newTestStorage(time.Minute)
+	ctx := context.TODO()
+	cond := model.Condition{Key: "k0", Op: model.OpGt, Val: 1}
+	id, err := s.Create(ctx, "interest0", cond)
+	require.Nil(t, err)
+	ids, _, err := s.SearchPage(ctx, model.Attr{Key: "k0", Val: 2}, 10, "")
+	require.Nil(t, err)
+	assert.Equal(t, []string{id}, ids)
+	require.Nil(t, s.Delete(ctx, "interest0", id))
+	require.Nil(t, s.Delete(ctx, "interest0", id))
+	ids, _, err = s.SearchPage(ctx, model.Attr{Key: "k0", Val: 2}, 10, "")
+	require.Nil(t, err)
+	assert.Empty(t, ids)
+	id1, err := s.Create(ctx, "interest0", cond)
+	require.Nil(t, err)
+	assert.NotEqual(t, id, id1)
+	assert.ErrorIs(t, s.Delete(ctx, "interest0", ""), storage.ErrInvalid)
+}
+
+func TestStorageImpl_Delete_Shared(t *testing.T) {
+	s := newTestStorage(time.Minute)
+	ctx := context.TODO()
+	cond := model.Condition{Key: "price", Op: model.OpGt, Val: 10}
+	id1, err := s.Create(ctx, "interest1", cond)
+	require.Nil(t, err)
+	id2, err := s.Create(ctx, "interest2", cond)
+	require.Nil(t, err)
+	require.Equal(t, id1, id2)
+	_, err = s.Create(ctx, "interest2", cond)
+	require.Nil(t, err)
+	search := func() []string {
+		ids, _, err := s.SearchPage(ctx, model.Attr{Key: "price", Val: 11}, 10, "")
+		require.Nil(t, err)
+		return ids
+	}
+	require.Nil(t, s.Delete(ctx, "interest1", id1))
+	assert.Equal(t, []string{id1}, search())
+	require.Nil(t, s.Delete(ctx, "interest3", id1))
+	assert.Equal(t, []string{id1}, search())
+	require.Nil(t, s.Delete(ctx, "interest2", id1))
+	assert.Empty(t, search())
+}
+
+func TestStorageImpl_SearchPage(t *testing.T) {
+	s := newTestStorage(time.Minute)
+	ctx := context.TODO()
+	conds := map[string]model.Condition{
+		"gt": {
+			Key: "price",
+			Op:  model.OpGt,
+			Val: 10,
+		},
+		"gte": {
+			Key: "price",
+			Op:  model.OpGte,
+			Val: 20,
+		},
+		"lt": {
+			Key: "price",
+			Op:  model.OpLt,
+			Val: 20,
+		},
+		"lte dec": {
+			Key: "price",
+			Op:  model.OpLte,
+			Dec: "19.99",
+		},
+		"eq tolerance": {
+			Key:       "price",
+			Op:        model.OpEq,
+			Val:       20,
+			Tolerance: model.Tolerance{Abs: 0.5},
+		},
+		"range": {
+			Key:   "price",
+			Op:    model.OpRange,
+			Range: model.Range{Min: 15, Max: 20, MaxInclusive: true},
+		},
+		"range max exclusive": {
+			Key:   "price",
+			Op:    model.OpRange,
+			Range: model.Range{Min: 15, Max: 20, MinInclusive: true},
+		},
+		"in": {
+			Key:  "price",
+			Op:   model.OpIn,
+			Vals: []float64{20, 30},
+		},
+		"not gt": {
+			Key: "price",
+			Op:  model.OpGt,
+			Val: 25,
+			Not: true,
+		},
+		"other key": {
+			Key: "cost",
+			Op:  model.OpGt,
+		},
+		"unit": {
+			Key:  "price",
+			Op:   model.OpGt,
+			Unit: "EUR",
+		},
+		"key-less": {
+			Op:  model.OpLt,
+			Val: 100,
+		},
+		"prefix": {
+			Key:      "pri",
+			KeyMatch: model.KeyMatchPrefix,
+			Op:       model.OpGt,
+		},
+		"glob": {
+			Key:      "p*e",
+			KeyMatch: model.KeyMatchGlob,
+			Op:       model.OpGt,
+		},
+		"glob mismatch": {
+			Key:      "p*x",
+			KeyMatch: model.KeyMatchGlob,
+			Op:       model.OpGt,
+		},
+		"bits": {
+			Key: "price",
+			Op:  model.OpBitsAllSet,
+			Int: ptr(int64(0b10100)),
+		},
+		"relative": {
+			Key:      "price",
+			Op:       model.OpLt,
+			Val:      0,
+			Relative: true,
+		},
+	}
+	names := map[string]string{}
+	for name, cond := range conds {
+		id, err := s.Create(ctx, "interest0", cond)
+		require.Nil(t, err)
+		names[id] = name
+	}
+	var matched []string
+	var cursor string
+	for {
+		ids, _, err := s.SearchPage(ctx, model.Attr{Key: "price", Val: 20}, 3, cursor)
+		require.Nil(t, err)
+		assert.LessOrEqual(t, len(ids), 3)
+		for _, id := range ids {
+			assert.Greater(t, id, cursor)
+			matched = append(matched, names[id])
+		}
+		if len(ids) < 3 {
+			break
+		}
+		cursor = ids[len(ids)-1]
+	}
+	assert.ElementsMatch(t, []string{
+		"gt",
+		"gte",
+		"eq tolerance",
+		"range",
+		"in",
+		"not gt",
+		"key-less",
+		"prefix",
+		"glob",
+		"bits",
+		"relative",
+	}, matched)
+	//
+	// no limit
+	ids, _, err := s.SearchPage(ctx, model.Attr{Key: "price", Val: 20}, 0, "")
+	require.Nil(t, err)
+	assert.Len(t, ids, len(matched))
+	//
+	_, _, err = s.SearchPage(ctx, model.Attr{Key: "price", Val: 20}, 3, "cond0")
+	assert.ErrorIs(t, err, storage.ErrInvalid)
+}
+
+func TestStorageImpl_SearchPage_Stateful(t *testing.T) {
+	s := newTestStorage(time.Minute)
+	ctx := context.TODO()
+	idCross, err := s.Create(ctx, "interest0", model.Condition{Key: "cpu", Op: model.OpCrossAbove, Val: 90, Hysteresis: 5})
+	require.Nil(t, err)
+	idChange, err := s.Create(ctx, "interest0", model.Condition{Key: "cpu", Op: model.OpChange, Val: 20})
+	require.Nil(t, err)
+	idWindow, err := s.Create(ctx, "interest0", model.Condition{
+		Key: "cpu",
+		Op:  model.OpGte,
+		Val: 3,
+		Window: model.Window{
+			Agg: model.AggCount,
+			Dur: time.Minute,
+		},
+	})
+	require.Nil(t, err)
+	steps := []struct {
+		val float64
+		ids []string
+	}{
+		{
+			val: 50,
+		},
+		{
+			val: 95,
+			ids: []string{idCross, idChange},
+		},
+		{
+			val: 96,
+			ids: []string{idWindow},
+		},
+		{
+			val: 80,
+			ids: []string{idWindow},
+		},
+		{
+			val: 91,
+			ids: []string{idCross, idWindow},
+		},
+	}
+	for i, step := range steps {
+		ids, _, err := s.SearchPage(ctx, model.Attr{Key: "cpu", Val: step.val}, 10, "")
+		require.Nil(t, err)
+		assert.ElementsMatch(t, step.ids, ids, "step %d", i)
+	}
+}
+
+func TestStorageImpl_SearchPage_StatefulOps(t *testing.T) {
+	s := newTestStorage(time.Minute)
+	ctx := context.TODO()
+	idGt, err := s.Create(ctx, "interest0", model.Condition{Key: "cpu", Op: model.OpGt})
+	require.Nil(t, err)
+	// neither the previous value nor the statistics are kept without the change and the anomaly conditions
+	ids, stats, err := s.SearchPage(ctx, model.Attr{Key: "cpu", Val: 50}, 10, "")
+	require.Nil(t, err)
+	assert.Equal(t, []string{idGt}, ids)
+	assert.Zero(t, stats.Count)
+	_, err = s.Create(ctx, "interest0", model.Condition{Key: "cpu", Op: model.OpChange, Val: 20})
+	require.Nil(t, err)
+	_, err = s.Create(ctx, "interest0", model.Condition{Key: "cpu", Op: model.OpAnomaly, Val: 3})
+	require.Nil(t, err)
+	_, err = s.Create(ctx, "interest0", model.Condition{Key: "mem", Op: model.OpChange, Val: 20, Unit: "MiB"})
+	require.Nil(t, err)
+	ids, stats, err = s.SearchPage(ctx, model.Attr{Key: "cpu", Val: 95}, 10, "")
+	require.Nil(t, err)
+	assert.Equal(t, []string{idGt}, ids)
+	assert.Zero(t, stats.Count)
+	ids, stats, err = s.SearchPage(ctx, model.Attr{Key: "cpu", Val: 96}, 10, "")
+	require.Nil(t, err)
+	assert.Equal(t, []string{idGt}, ids)
+	assert.Equal(t, int64(1), stats.Count)
+	// the conditions of another unit don't keep the state
+	_, _, err = s.SearchPage(ctx, model.Attr{Key: "mem", Val: 10}, 10, "")
+	require.Nil(t, err)
+	ids, _, err = s.SearchPage(ctx, model.Attr{Key: "mem", Val: 100, Unit: "MiB"}, 10, "")
+	require.Nil(t, err)
+	assert.Empty(t, ids)
+}
+
+func TestStorageImpl_SearchMultiPage(t *testing.T) {
+	s := newTestStorage(time.Minute)
+	ctx := context.TODO()
+	idSpread, err := s.Create(ctx, "interest0", model.Condition{
+		Terms: []model.Term{{Key: "ask", Coef: 1}, {Key: "bid", Coef: -1}},
+		Op:    model.OpGt,
+		Val:   1,
+	})
+	require.Nil(t, err)
+	idSum, err := s.Create(ctx, "interest0", model.Condition{
+		Terms: []model.Term{{Key: "ask", Coef: 1}, {Key: "fee", Coef: 1}},
+		Op:    model.OpLt,
+		Val:   100,
+	})
+	require.Nil(t, err)
+	idAbsent, err := s.Create(ctx, "interest0", model.Condition{Key: "fee", Op: model.OpGt, Not: true})
+	require.Nil(t, err)
+	_, err = s.Create(ctx, "interest0", model.Condition{Key: "ask", Op: model.OpGt})
+	require.Nil(t, err)
+	ids, err := s.SearchMultiPage(ctx, map[string]float64{"ask": 10, "bid": 8}, 10, "")
+	require.Nil(t, err)
+	assert.Equal(t, []string{idSpread, idAbsent}, ids)
+	ids, err = s.SearchMultiPage(ctx, map[string]float64{"ask": 10, "bid": 8}, 1, idSpread)
+	require.Nil(t, err)
+	assert.Equal(t, []string{idAbsent}, ids)
+	ids, err = s.SearchMultiPage(ctx, map[string]float64{"ask": 10, "fee": 1}, 10, "")
+	require.Nil(t, err)
+	assert.Equal(t, []string{idSum}, ids)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
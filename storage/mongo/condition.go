@@ -1,17 +1,254 @@
 package mongo
 
-import "github.com/awakari/conditions-number/model"
+import (
+	"fmt"
+	"github.com/awakari/conditions-number/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type condition struct {
-	Id  string   `bson:"_id"`
-	Key string   `bson:"key"`
-	Op  model.Op `bson:"op"`
-	Val float64  `bson:"val"`
+	Id         string     `bson:"_id"`
+	Key        string     `bson:"key"`
+	Op         model.Op   `bson:"op"`
+	Val        any        `bson:"val"`
+	Hysteresis float64    `bson:"hysteresis"`
+	Window     *windowRec `bson:"window"`
+}
+
+type windowRec struct {
+	Agg       model.Agg     `bson:"agg"`
+	Dur       time.Duration `bson:"dur"`
+	Tumbling  bool          `bson:"tumbling"`
+	FilterOp  model.Op      `bson:"filter_op"`
+	FilterVal float64       `bson:"filter_val"`
 }
 
 const attrId = "_id"
 const attrKey = "key"
+const attrKeyMatch = "key_match"
+const attrKeyPrefix = "key_prefix"
+const attrKeyRegex = "key_regex"
+const attrTerms = "terms"
+const attrTermKey = "key"
+const attrTermCoef = "coef"
+const attrTermsKey = attrTerms + "." + attrTermKey
+const attrTermsId = "terms_id"
 const attrOp = "op"
 const attrVal = "val"
+const attrValInt = "val_int"
+const attrUnit = "unit"
+const attrRelative = "relative"
+const attrRangeMax = "range_max"
+const attrRangeMinIncl = "range_min_incl"
+const attrRangeMaxIncl = "range_max_incl"
+const attrHysteresis = "hysteresis"
+const attrChangeDir = "change_dir"
+const attrChangeRel = "change_rel"
+const attrWindow = "window"
+const attrModDiv = "mod_div"
+const attrPeriod = "period"
+const attrNot = "not"
+const attrModRem = "mod_rem"
+const attrEqMin = "eq_min"
+const attrEqMax = "eq_max"
+const attrVals = "vals"
+const attrValsId = "vals_id"
 const attrCreateLockTime = "create_lock_time"
 const attrCreateLockCount = "create_lock_count"
+const attrInterests = "interests"
+
+// encodeCondition returns the attributes identifying the condition record.
+// The range lower bound is stored as the regular value to keep it covered by the value index.
+// The exact decimal value is stored as Decimal128, the database compares it with the doubles numerically.
+// The exact integer value is stored separately as int64 to have its own index, the value is null then.
+// The windowed aggregate conditions have the window stored as the embedded document covered by the unique index.
+func encodeCondition(cond model.Condition) (rec bson.M, err error) {
+	rec = bson.M{
+		attrKey: cond.Key,
+		// exact key conditions keep the key match null to not collide with the key pattern ones
+		attrKeyMatch: nil,
+		attrOp:       cond.Op,
+		attrVal:      cond.Val,
+		// conditions without a unit keep it null
+		attrUnit: nil,
+	}
+	if cond.Unit != "" {
+		rec[attrUnit] = cond.Unit
+	}
+	// non-integer conditions keep the integer value null
+	rec[attrValInt] = nil
+	approxVal := cond.Val
+	// non-windowed conditions keep the window null
+	rec[attrWindow] = nil
+	switch {
+	case !cond.Window.IsZero():
+		rec[attrWindow] = windowRec{
+			Agg:       cond.Window.Agg,
+			Dur:       cond.Window.Dur,
+			Tumbling:  cond.Window.Tumbling,
+			FilterOp:  cond.Window.Filter.Op,
+			FilterVal: cond.Window.Filter.Val,
+		}
+	case cond.Dec != "" && cond.Op.IsComparison():
+		rec[attrVal], err = encodeDecimal(cond.Dec)
+		approxVal = cond.Dec.Float64()
+	case cond.Op.IsBitwise():
+		// the bit mask is kept as the integer value to use the bitwise query operators
+		var mask int64
+		mask, err = cond.BitMask()
+		rec[attrVal] = nil
+		rec[attrValInt] = mask
+	case cond.Int != nil && cond.Op.IsComparison():
+		rec[attrVal] = nil
+		rec[attrValInt] = *cond.Int
+		approxVal = float64(*cond.Int)
+	}
+	// absolute conditions keep the relative flag null
+	rec[attrRelative] = nil
+	if cond.Relative {
+		rec[attrRelative] = true
+	}
+	// not negated conditions keep the flag null
+	rec[attrNot] = nil
+	if cond.Not {
+		rec[attrNot] = true
+	}
+	// single attribute conditions keep the terms id null to not collide with the cross-attribute ones
+	rec[attrTermsId] = nil
+	switch {
+	case len(cond.Terms) > 0:
+		rec[attrKey] = ""
+		rec[attrTerms], rec[attrTermsId] = encodeTerms(cond.Terms)
+	case cond.KeyMatch == model.KeyMatchPrefix:
+		rec[attrKeyMatch] = cond.KeyMatch
+		rec[attrKeyPrefix] = cond.KeyLiteralPrefix()
+	case cond.KeyMatch == model.KeyMatchGlob:
+		rec[attrKeyMatch] = cond.KeyMatch
+		rec[attrKeyPrefix] = cond.KeyLiteralPrefix()
+		rec[attrKeyRegex] = model.GlobRegexp(cond.Key)
+	}
+	switch cond.Op {
+	case model.OpEq:
+		// exact equality conditions keep the bounds null to not collide with the tolerant ones
+		rec[attrEqMin] = nil
+		rec[attrEqMax] = nil
+		if !cond.Tolerance.IsZero() {
+			rec[attrEqMin], rec[attrEqMax] = cond.Tolerance.Bounds(approxVal)
+		}
+	case model.OpRange:
+		rec[attrVal] = cond.Range.Min
+		rec[attrRangeMax] = cond.Range.Max
+		rec[attrRangeMinIncl] = cond.Range.MinInclusive
+		rec[attrRangeMaxIncl] = cond.Range.MaxInclusive
+	case model.OpCyclicRange:
+		// the bounds are stored taken modulo the period
+		var r model.Range
+		r, err = cond.CyclicRange()
+		rec[attrVal] = r.Min
+		rec[attrRangeMax] = r.Max
+		rec[attrRangeMinIncl] = r.MinInclusive
+		rec[attrRangeMaxIncl] = r.MaxInclusive
+		rec[attrPeriod] = cond.Period
+	case model.OpCrossAbove, model.OpCrossBelow:
+		rec[attrHysteresis] = cond.Hysteresis
+	case model.OpChange:
+		rec[attrChangeDir] = cond.Change.Dir
+		rec[attrChangeRel] = cond.Change.Rel
+	case model.OpMod:
+		err = cond.Mod.Validate()
+		rec[attrModDiv] = cond.Mod.Div
+		rec[attrModRem] = cond.Mod.Rem
+		// the value is not used, zero to not distinguish the same conditions
+		rec[attrVal] = 0.0
+	case model.OpIn, model.OpNotIn:
+		rec[attrVal] = 0.0
+		vals := slices.Clone(cond.Vals)
+		slices.Sort(vals)
+		vals = slices.Compact(vals)
+		rec[attrVals] = vals
+		rec[attrValsId] = valsId(vals)
+	}
+	if err == nil {
+		err = cond.ValidateNot()
+	}
+	return
+}
+
+// decodeCrossing returns the crossing condition threshold and hysteresis.
+func (rec condition) decodeCrossing() (cond model.Condition) {
+	cond.Op = rec.Op
+	cond.Val, _ = rec.Val.(float64)
+	cond.Hysteresis = rec.Hysteresis
+	return
+}
+
+// decodeWindowed returns the windowed aggregate condition comparison and window.
+func (rec condition) decodeWindowed() (cond model.Condition) {
+	cond.Op = rec.Op
+	cond.Val, _ = rec.Val.(float64)
+	if rec.Window != nil {
+		cond.Window = model.Window{
+			Agg:      rec.Window.Agg,
+			Dur:      rec.Window.Dur,
+			Tumbling: rec.Window.Tumbling,
+			Filter: model.WindowFilter{
+				Op:  rec.Window.FilterOp,
+				Val: rec.Window.FilterVal,
+			},
+		}
+	}
+	return
+}
+
+func encodeDecimal(d model.Decimal) (dst primitive.Decimal128, err error) {
+	dst, err = primitive.ParseDecimal128(string(d))
+	if err != nil {
+		err = fmt.Errorf("%w: %s", model.ErrInvalidDecimal, err)
+	}
+	return
+}
+
+// valsId returns the scalar representation of the sorted values set.
+// The unique index can not include the values array itself: a multikey unique index would reject
+// the different sets sharing any element.
+func valsId(vals []float64) string {
+	var sb strings.Builder
+	for i, v := range vals {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	}
+	return sb.String()
+}
+
+// encodeTerms merges the terms having the same key and sorts them by key.
+// Returns also the scalar representation of the terms for the unique index.
+func encodeTerms(terms []model.Term) (recTerms []bson.M, id string) {
+	coefs := map[string]float64{}
+	for _, t := range terms {
+		coefs[t.Key] += t.Coef
+	}
+	keys := slices.Sorted(maps.Keys(coefs))
+	var sb strings.Builder
+	for i, k := range keys {
+		recTerms = append(recTerms, bson.M{
+			attrTermKey:  k,
+			attrTermCoef: coefs[k],
+		})
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.FormatFloat(coefs[k], 'g', -1, 64))
+		sb.WriteByte('*')
+		sb.WriteString(strconv.Quote(k))
+	}
+	id = sb.String()
+	return
+}
@@ -0,0 +1,138 @@
+package mongo
+
+import (
+	"context"
+	"github.com/awakari/conditions-number/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"slices"
+)
+
+type keysRec struct {
+	Id       primitive.ObjectID `bson:"_id"`
+	Key      string             `bson:"key"`
+	Op       model.Op           `bson:"op"`
+	Val      any                `bson:"val"`
+	KeyMatch *model.KeyMatch    `bson:"key_match"`
+	Terms    []termRec          `bson:"terms"`
+}
+
+type termRec struct {
+	Key  string  `bson:"key"`
+	Coef float64 `bson:"coef"`
+}
+
+var optsFindKeys = options.
+	Find().
+	SetProjection(bson.D{
+		{
+			Key:   attrId,
+			Value: 1,
+		},
+		{
+			Key:   attrKey,
+			Value: 1,
+		},
+		{
+			Key:   attrOp,
+			Value: 1,
+		},
+		{
+			Key:   attrVal,
+			Value: 1,
+		},
+		{
+			Key:   attrKeyMatch,
+			Value: 1,
+		},
+		{
+			Key:   attrTerms,
+			Value: 1,
+		},
+	})
+
+// NormalizeKeys updates the conditions and then the state of the stateful conditions if kept in the database.
+func (s storageImpl) NormalizeKeys(ctx context.Context, norm model.KeyNorm) (updated int64, conflicts []string, err error) {
+	var cursor *mongo.Cursor
+	cursor, err = s.coll.Find(ctx, bson.M{}, optsFindKeys)
+	if err == nil {
+		defer cursor.Close(ctx)
+		for err == nil && cursor.Next(ctx) {
+			var rec keysRec
+			err = cursor.Decode(&rec)
+			var u bson.M
+			if err == nil {
+				u = rec.normalize(norm)
+			}
+			if err == nil && len(u) > 0 {
+				// the key is a part of the shard key: the update is filtered by the full shard key and changes it as
+				// the retryable write
+				q := bson.M{
+					attrId:  rec.Id,
+					attrKey: rec.Key,
+					attrOp:  rec.Op,
+					attrVal: rec.Val,
+				}
+				_, err = s.coll.UpdateOne(ctx, q, bson.M{"$set": u})
+				switch {
+				case err == nil:
+					updated++
+				case mongo.IsDuplicateKeyError(err):
+					// the condition having the same normalized key already exists
+					conflicts = append(conflicts, rec.Id.Hex())
+					err = nil
+				}
+			}
+		}
+		if err == nil {
+			err = cursor.Err()
+		}
+	}
+	if st, ok := s.state.(stateImpl); ok && err == nil {
+		err = st.normalizeKeys(ctx, norm)
+	}
+	err = decodeError(err)
+	return
+}
+
+// normalize returns the updated attributes or nothing when the keys are already normalized.
+func (rec keysRec) normalize(norm model.KeyNorm) (u bson.M) {
+	switch {
+	case len(rec.Terms) > 0:
+		var terms []model.Term
+		for _, t := range rec.Terms {
+			terms = append(terms, model.Term{
+				Key:  norm.Normalize(t.Key),
+				Coef: t.Coef,
+			})
+		}
+		recTerms, termsId := encodeTerms(terms)
+		if !slices.EqualFunc(rec.Terms, recTerms, func(t termRec, recTerm bson.M) bool {
+			return t.Key == recTerm[attrTermKey] && t.Coef == recTerm[attrTermCoef]
+		}) {
+			u = bson.M{
+				attrTerms:   recTerms,
+				attrTermsId: termsId,
+			}
+		}
+	default:
+		cond := model.Condition{
+			Key: norm.Normalize(rec.Key),
+		}
+		if cond.Key != rec.Key {
+			u = bson.M{
+				attrKey: cond.Key,
+			}
+			if rec.KeyMatch != nil {
+				cond.KeyMatch = *rec.KeyMatch
+				u[attrKeyPrefix] = cond.KeyLiteralPrefix()
+			}
+			if cond.KeyMatch == model.KeyMatchGlob {
+				u[attrKeyRegex] = model.GlobRegexp(cond.Key)
+			}
+		}
+	}
+	return
+}
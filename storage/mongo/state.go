@@ -0,0 +1,342 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/awakari/conditions-number/model"
+	"github.com/awakari/conditions-number/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type stateImpl struct {
+	coll *mongo.Collection
+}
+
+type stateRec struct {
+	Armed   bool           `bson:"armed"`
+	Prev    *float64       `bson:"prev"`
+	Window  []windowBucket `bson:"window"`
+	Version int64          `bson:"version"`
+}
+
+type windowBucket struct {
+	Start int64   `bson:"start"`
+	Count int64   `bson:"count"`
+	Sum   float64 `bson:"sum"`
+	Min   float64 `bson:"min"`
+	Max   float64 `bson:"max"`
+}
+
+const stateAttrCondId = "cond_id"
+const stateAttrKey = "key"
+const stateAttrEntity = "entity"
+const stateAttrArmed = "armed"
+const stateAttrLast = "last"
+const stateAttrPrev = "prev"
+const stateAttrWindow = "window"
+const stateAttrVersion = "version"
+const stateAttrUpdated = "updated"
+
+// stateUpdateAttempts is the count of the optimistic window state update attempts.
+const stateUpdateAttempts = 10
+
+// stateCondIdNone is the condition id of the values observed regardless of the conditions.
+const stateCondIdNone = ""
+
+const stateCollNameSuffix = "-state"
+
+var stateIndices = []mongo.IndexModel{
+	{
+		Keys: bson.D{
+			{
+				Key:   stateAttrCondId,
+				Value: 1,
+			},
+			{
+				Key:   stateAttrKey,
+				Value: 1,
+			},
+			{
+				Key:   stateAttrEntity,
+				Value: 1,
+			},
+		},
+		Options: options.
+			Index().
+			SetUnique(true),
+	},
+}
+
+// errCodeIndexOptionsConflict is the error code of the existing index having the same keys but other options.
+const errCodeIndexOptionsConflict = 85
+
+var optsStateUpsert = options.
+	FindOneAndUpdate().
+	SetUpsert(true).
+	SetReturnDocument(options.Before)
+
+var optsStateObserve = options.
+	FindOneAndUpdate().
+	SetUpsert(true).
+	SetReturnDocument(options.After).
+	SetProjection(bson.M{
+		stateAttrPrev: 1,
+	})
+var optsStateUpdate = options.
+	Update().
+	SetUpsert(true)
+var optsStateFindKeys = options.
+	Find().
+	SetProjection(bson.M{
+		stateAttrKey: 1,
+	})
+var optsStatePrevious = options.
+	FindOne().
+	SetProjection(bson.M{
+		stateAttrPrev: 1,
+	})
+
+// newState creates the state collection indices, the state entries not updated for the ttl are expired unless the ttl
+// is zero.
+func newState(ctx context.Context, coll *mongo.Collection, ttl time.Duration) (st storage.State, err error) {
+	_, err = coll.Indexes().CreateMany(ctx, stateIndices)
+	if err == nil && ttl > 0 {
+		err = ensureStateTtl(ctx, coll, ttl)
+	}
+	if err == nil {
+		st = stateImpl{
+			coll: coll,
+		}
+	}
+	return
+}
+
+// ensureStateTtl creates the expiration index or changes the expiration time of the existing one.
+func ensureStateTtl(ctx context.Context, coll *mongo.Collection, ttl time.Duration) (err error) {
+	keys := bson.D{
+		{
+			Key:   stateAttrUpdated,
+			Value: 1,
+		},
+	}
+	secs := int32(ttl / time.Second)
+	_, err = coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: keys,
+		Options: options.
+			Index().
+			SetExpireAfterSeconds(secs),
+	})
+	var errCmd mongo.CommandError
+	if errors.As(err, &errCmd) && errCmd.Code == errCodeIndexOptionsConflict {
+		cmd := bson.D{
+			{
+				Key:   "collMod",
+				Value: coll.Name(),
+			},
+			{
+				Key: "index",
+				Value: bson.M{
+					"keyPattern":         keys,
+					"expireAfterSeconds": secs,
+				},
+			},
+		}
+		err = coll.Database().RunCommand(ctx, cmd).Err()
+	}
+	return
+}
+
+func (st stateImpl) Cross(ctx context.Context, condId string, cond model.Condition, attr model.Attr) (fires bool, err error) {
+	v := attr.Float64()
+	beyond, rearms := cond.Crossing(v)
+	q := bson.M{
+		stateAttrCondId: condId,
+		stateAttrKey:    attr.Key,
+		stateAttrEntity: attr.Entity,
+	}
+	set := bson.M{
+		stateAttrLast:    v,
+		stateAttrUpdated: time.Now().UTC(),
+	}
+	u := bson.M{
+		"$set": set,
+	}
+	switch {
+	case beyond:
+		set[stateAttrArmed] = false
+	case rearms:
+		set[stateAttrArmed] = true
+	default:
+		// the new condition is armed
+		u["$setOnInsert"] = bson.M{
+			stateAttrArmed: true,
+		}
+	}
+	var prev stateRec
+	err = st.coll.FindOneAndUpdate(ctx, q, u, optsStateUpsert).Decode(&prev)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		prev.Armed = true
+		err = nil
+	}
+	fires = beyond && prev.Armed
+	err = decodeError(err)
+	return
+}
+
+func (st stateImpl) Observe(ctx context.Context, attr model.Attr) (prev float64, found bool, err error) {
+	q := bson.M{
+		stateAttrCondId: stateCondIdNone,
+		stateAttrKey:    attr.Key,
+		stateAttrEntity: attr.Entity,
+	}
+	// the pipeline update moves the last value to the previous one, the new record has no previous value
+	u := bson.A{
+		bson.M{
+			"$set": bson.M{
+				stateAttrPrev:    "$" + stateAttrLast,
+				stateAttrLast:    attr.Float64(),
+				stateAttrUpdated: time.Now().UTC(),
+			},
+		},
+	}
+	var rec stateRec
+	err = st.coll.FindOneAndUpdate(ctx, q, u, optsStateObserve).Decode(&rec)
+	if err == nil && rec.Prev != nil {
+		prev, found = *rec.Prev, true
+	}
+	err = decodeError(err)
+	return
+}
+
+func (st stateImpl) Previous(ctx context.Context, attr model.Attr) (prev float64, found bool, err error) {
+	q := bson.M{
+		stateAttrCondId: stateCondIdNone,
+		stateAttrKey:    attr.Key,
+		stateAttrEntity: attr.Entity,
+	}
+	var rec stateRec
+	err = st.coll.FindOne(ctx, q, optsStatePrevious).Decode(&rec)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		err = nil
+	case err == nil && rec.Prev != nil:
+		prev, found = *rec.Prev, true
+	}
+	err = decodeError(err)
+	return
+}
+
+// Aggregate reads and writes back the window state using the version to detect the concurrent update, retries then.
+func (st stateImpl) Aggregate(ctx context.Context, condId string, cond model.Condition, attr model.Attr, t time.Time) (agg float64, ok bool, err error) {
+	v := attr.Float64()
+	q := bson.M{
+		stateAttrCondId: condId,
+		stateAttrKey:    attr.Key,
+		stateAttrEntity: attr.Entity,
+	}
+	var done bool
+	for i := 0; err == nil && !done && i < stateUpdateAttempts; i++ {
+		var rec stateRec
+		err = st.coll.FindOne(ctx, q).Decode(&rec)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			err = nil
+		}
+		if err == nil {
+			s := decodeWindow(rec.Window)
+			switch cond.Window.Accepts(v) {
+			case true:
+				s = cond.Window.Add(s, t, v)
+				done, err = st.updateWindow(ctx, q, rec.Version, s)
+			default:
+				done = true
+			}
+			agg, ok = cond.Window.Aggregate(s, t)
+		}
+	}
+	err = decodeError(err)
+	if err == nil && !done {
+		err = fmt.Errorf("%w: window state update attempts exhausted", storage.ErrInternal)
+	}
+	return
+}
+
+// updateWindow writes the window state if the version is the same, the new state has the zero version.
+func (st stateImpl) updateWindow(ctx context.Context, q bson.M, version int64, s model.WindowState) (ok bool, err error) {
+	qVersion := bson.M{
+		stateAttrVersion: version,
+	}
+	for k, v := range q {
+		qVersion[k] = v
+	}
+	u := bson.M{
+		"$set": bson.M{
+			stateAttrWindow:  encodeWindow(s),
+			stateAttrVersion: version + 1,
+			stateAttrUpdated: time.Now().UTC(),
+		},
+	}
+	// the version mismatch causes the upsert attempt failing with the duplicate key error
+	_, err = st.coll.UpdateOne(ctx, qVersion, u, optsStateUpdate)
+	switch {
+	case mongo.IsDuplicateKeyError(err):
+		err = nil
+	case err == nil:
+		ok = true
+	}
+	return
+}
+
+func encodeWindow(src model.WindowState) (dst []windowBucket) {
+	for _, b := range src {
+		dst = append(dst, windowBucket(b))
+	}
+	return
+}
+
+func decodeWindow(src []windowBucket) (dst model.WindowState) {
+	for _, b := range src {
+		dst = append(dst, model.WindowBucket(b))
+	}
+	return
+}
+
+func (st stateImpl) Delete(ctx context.Context, condId string) (err error) {
+	q := bson.M{
+		stateAttrCondId: condId,
+	}
+	_, err = st.coll.DeleteMany(ctx, q)
+	err = decodeError(err)
+	return
+}
+
+// normalizeKeys moves the state to the normalized attribute keys, the state already having the normalized key is kept
+// when both exist.
+func (st stateImpl) normalizeKeys(ctx context.Context, norm model.KeyNorm) (err error) {
+	var cursor *mongo.Cursor
+	cursor, err = st.coll.Find(ctx, bson.M{}, optsStateFindKeys)
+	if err == nil {
+		defer cursor.Close(ctx)
+		for err == nil && cursor.Next(ctx) {
+			var rec struct {
+				Id  any    `bson:"_id"`
+				Key string `bson:"key"`
+			}
+			err = cursor.Decode(&rec)
+			k := norm.Normalize(rec.Key)
+			if err == nil && k != rec.Key {
+				_, err = st.coll.UpdateByID(ctx, rec.Id, bson.M{"$set": bson.M{stateAttrKey: k}})
+				if mongo.IsDuplicateKeyError(err) {
+					_, err = st.coll.DeleteOne(ctx, bson.M{attrId: rec.Id})
+				}
+			}
+		}
+		if err == nil {
+			err = cursor.Err()
+		}
+	}
+	return
+}
@@ -0,0 +1,160 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"github.com/awakari/conditions-number/model"
+	"github.com/awakari/conditions-number/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// statsImpl keeps the statistics in the state records of the values observed regardless of the conditions.
+type statsImpl struct {
+	coll *mongo.Collection
+}
+
+type statsRec struct {
+	Prev struct {
+		Count int64   `bson:"count"`
+		Mean  float64 `bson:"mean"`
+		M2    float64 `bson:"m2"`
+	} `bson:"stats_prev"`
+}
+
+const statsAttrCount = "count"
+const statsAttrMean = "mean"
+const statsAttrM2 = "m2"
+const stateAttrStats = "stats"
+const stateAttrStatsPrev = "stats_prev"
+
+var optsStatsUpdate = options.
+	FindOneAndUpdate().
+	SetUpsert(true).
+	SetReturnDocument(options.After).
+	SetProjection(bson.M{
+		stateAttrStatsPrev: 1,
+	})
+var optsStatsGet = options.
+	FindOne().
+	SetProjection(bson.M{
+		stateAttrStatsPrev: 1,
+	})
+
+// newStats uses the state collection having the indices created by newState.
+func newStats(coll *mongo.Collection) storage.Stats {
+	return statsImpl{
+		coll: coll,
+	}
+}
+
+func (s statsImpl) Update(ctx context.Context, attr model.Attr) (prev model.Stats, err error) {
+	v := attr.Float64()
+	q := bson.M{
+		stateAttrCondId: stateCondIdNone,
+		stateAttrKey:    attr.Key,
+		stateAttrEntity: attr.Entity,
+	}
+	field := func(name string) string {
+		return "$" + stateAttrStatsPrev + "." + name
+	}
+	count := bson.M{
+		"$add": bson.A{
+			field(statsAttrCount),
+			1,
+		},
+	}
+	// the same as model.Stats.Add does
+	u := bson.A{
+		bson.M{
+			"$set": bson.M{
+				stateAttrStatsPrev: bson.M{
+					"$ifNull": bson.A{
+						"$" + stateAttrStats,
+						bson.M{
+							statsAttrCount: 0,
+							statsAttrMean:  0.0,
+							statsAttrM2:    0.0,
+						},
+					},
+				},
+				stateAttrUpdated: time.Now().UTC(),
+			},
+		},
+		bson.M{
+			"$set": bson.M{
+				stateAttrStats: bson.M{
+					statsAttrCount: count,
+					statsAttrMean: bson.M{
+						"$add": bson.A{
+							field(statsAttrMean),
+							bson.M{
+								"$divide": bson.A{
+									bson.M{
+										"$subtract": bson.A{
+											v,
+											field(statsAttrMean),
+										},
+									},
+									count,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		bson.M{
+			"$set": bson.M{
+				stateAttrStats + "." + statsAttrM2: bson.M{
+					"$add": bson.A{
+						field(statsAttrM2),
+						bson.M{
+							"$multiply": bson.A{
+								bson.M{
+									"$subtract": bson.A{
+										v,
+										field(statsAttrMean),
+									},
+								},
+								bson.M{
+									"$subtract": bson.A{
+										v,
+										"$" + stateAttrStats + "." + statsAttrMean,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	var rec statsRec
+	err = s.coll.FindOneAndUpdate(ctx, q, u, optsStatsUpdate).Decode(&rec)
+	if err == nil {
+		prev = model.Stats(rec.Prev)
+	}
+	err = decodeError(err)
+	return
+}
+
+func (s statsImpl) Get(ctx context.Context, attr model.Attr) (prev model.Stats, err error) {
+	q := bson.M{
+		stateAttrCondId: stateCondIdNone,
+		stateAttrKey:    attr.Key,
+		stateAttrEntity: attr.Entity,
+	}
+	var rec statsRec
+	err = s.coll.FindOne(ctx, q, optsStatsGet).Decode(&rec)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		err = nil
+	case err == nil:
+		prev = model.Stats(rec.Prev)
+	}
+	err = decodeError(err)
+	return
+}
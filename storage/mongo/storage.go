@@ -3,15 +3,20 @@ package mongo
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/awakari/conditions-number/config"
 	"github.com/awakari/conditions-number/model"
 	"github.com/awakari/conditions-number/storage"
+	"github.com/awakari/conditions-number/storage/memory"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"maps"
+	"math"
+	"slices"
 	"time"
 )
 
@@ -21,6 +26,9 @@ type storageImpl struct {
 	coll          *mongo.Collection
 	collRo        *mongo.Collection
 	createLockTtl time.Duration
+	clock         model.Clock
+	state         storage.State
+	stats         storage.Stats
 }
 
 var indices = []mongo.IndexModel{
@@ -39,12 +47,171 @@ var indices = []mongo.IndexModel{
 				Key:   attrVal,
 				Value: 1,
 			},
+			{
+				Key:   attrValInt,
+				Value: 1,
+			},
+			{
+				Key:   attrKeyMatch,
+				Value: 1,
+			},
+			{
+				Key:   attrTermsId,
+				Value: 1,
+			},
+			{
+				Key:   attrUnit,
+				Value: 1,
+			},
+			{
+				Key:   attrRelative,
+				Value: 1,
+			},
+			{
+				Key:   attrHysteresis,
+				Value: 1,
+			},
+			{
+				Key:   attrChangeDir,
+				Value: 1,
+			},
+			{
+				Key:   attrChangeRel,
+				Value: 1,
+			},
+			{
+				Key:   attrWindow,
+				Value: 1,
+			},
+			{
+				Key:   attrModDiv,
+				Value: 1,
+			},
+			{
+				Key:   attrPeriod,
+				Value: 1,
+			},
+			{
+				Key:   attrNot,
+				Value: 1,
+			},
+			{
+				Key:   attrModRem,
+				Value: 1,
+			},
+			{
+				Key:   attrRangeMax,
+				Value: 1,
+			},
+			{
+				Key:   attrRangeMinIncl,
+				Value: 1,
+			},
+			{
+				Key:   attrRangeMaxIncl,
+				Value: 1,
+			},
+			{
+				Key:   attrValsId,
+				Value: 1,
+			},
+			{
+				Key:   attrEqMin,
+				Value: 1,
+			},
+			{
+				Key:   attrEqMax,
+				Value: 1,
+			},
 		},
 		Options: options.
 			Index().
 			SetUnique(true),
 	},
+	// key pattern index, the search looks up all prefixes of the attribute key
+	{
+		Keys: bson.D{
+			{
+				Key:   attrKeyPrefix,
+				Value: 1,
+			},
+		},
+		Options: options.
+			Index().
+			SetPartialFilterExpression(bson.M{
+				attrKeyPrefix: bson.M{
+					"$exists": true,
+				},
+			}),
+	},
+	// cross-attribute conditions index
+	{
+		Keys: bson.D{
+			{
+				Key:   attrTermsKey,
+				Value: 1,
+			},
+		},
+		Options: options.
+			Index().
+			SetPartialFilterExpression(bson.M{
+				attrTerms: bson.M{
+					"$exists": true,
+				},
+			}),
+	},
+	// integer value index
+	{
+		Keys: bson.D{
+			{
+				Key:   attrKey,
+				Value: 1,
+			},
+			{
+				Key:   attrOp,
+				Value: 1,
+			},
+			{
+				Key:   attrValInt,
+				Value: 1,
+			},
+		},
+		Options: options.
+			Index().
+			SetPartialFilterExpression(bson.M{
+				attrValInt: bson.M{
+					"$type": "long",
+				},
+			}),
+	},
+	// values set membership index
+	{
+		Keys: bson.D{
+			{
+				Key:   attrKey,
+				Value: 1,
+			},
+			{
+				Key:   attrOp,
+				Value: 1,
+			},
+			{
+				Key:   attrVals,
+				Value: 1,
+			},
+		},
+		Options: options.
+			Index().
+			SetPartialFilterExpression(bson.M{
+				attrVals: bson.M{
+					"$exists": true,
+				},
+			}),
+	},
 }
+
+const indexNameId = "_id_"
+
 var projId = bson.D{
 	{
 		Key:   attrId,
@@ -57,10 +224,28 @@ var optsUpsert = options.
 	SetUpsert(true).
 	SetReturnDocument(options.After).
 	SetProjection(projId)
-var optsFindPage = options.
-	Find().
-	SetProjection(projId).
-	SetSort(projId)
+var projSearch = bson.D{
+	{
+		Key:   attrId,
+		Value: 1,
+	},
+	{
+		Key:   attrOp,
+		Value: 1,
+	},
+	{
+		Key:   attrVal,
+		Value: 1,
+	},
+	{
+		Key:   attrHysteresis,
+		Value: 1,
+	},
+	{
+		Key:   attrWindow,
+		Value: 1,
+	},
+}
 var clauseCreateLockMissing = bson.M{
 	"$or": []bson.M{
 		{
@@ -76,7 +261,8 @@ var clauseCreateLockMissing = bson.M{
 	},
 }
 
-func NewStorage(ctx context.Context, cfgDb config.DbConfig) (s storage.Storage, err error) {
+// NewStorage connects to the database, the clock defines the current time for the relative-time conditions search.
+func NewStorage(ctx context.Context, cfgDb config.DbConfig, clock model.Clock) (s storage.Storage, err error) {
 	clientOpts := options.
 		Client().
 		ApplyURI(cfgDb.Uri).
@@ -104,8 +290,20 @@ func NewStorage(ctx context.Context, cfgDb config.DbConfig) (s storage.Storage,
 			Collection().
 			SetReadPreference(readpref.SecondaryPreferred()))
 		stor.createLockTtl = cfgDb.Table.LockTtl.Create
+		stor.clock = clock
 		_, err = stor.ensureIndices(ctx)
 	}
+	if err == nil {
+		switch cfgDb.Table.State.Memory {
+		case true:
+			stor.state = memory.NewState(cfgDb.Table.State.Limit)
+			stor.stats = memory.NewStats(cfgDb.Table.State.Limit)
+		default:
+			collState := stor.db.Collection(cfgDb.Table.Name + stateCollNameSuffix)
+			stor.state, err = newState(ctx, collState, cfgDb.Table.State.Ttl)
+			stor.stats = newStats(collState)
+		}
+	}
 	if err == nil && cfgDb.Table.Shard {
 		err = stor.shardCollection(ctx)
 	}
@@ -115,8 +313,23 @@ func NewStorage(ctx context.Context, cfgDb config.DbConfig) (s storage.Storage,
 	return
 }
 
-func (s storageImpl) ensureIndices(ctx context.Context) ([]string, error) {
-	return s.coll.Indexes().CreateMany(ctx, indices)
+// ensureIndices creates the missing indices and drops the unique ones left by the previous versions: those are
+// narrower than the current unique index and would reject the new conditions differing by the added fields only.
+func (s storageImpl) ensureIndices(ctx context.Context) (names []string, err error) {
+	names, err = s.coll.Indexes().CreateMany(ctx, indices)
+	var specs []*mongo.IndexSpecification
+	if err == nil {
+		specs, err = s.coll.Indexes().ListSpecifications(ctx)
+	}
+	for _, spec := range specs {
+		if err != nil {
+			break
+		}
+		if spec.Unique != nil && *spec.Unique && spec.Name != indexNameId && !slices.Contains(names, spec.Name) {
+			_, err = s.coll.Indexes().DropOne(ctx, spec.Name)
+		}
+	}
+	return
 }
 
 func (s storageImpl) shardCollection(ctx context.Context) (err error) {
@@ -152,44 +365,44 @@ func (s storageImpl) Close() error {
 	return s.conn.Disconnect(context.TODO())
 }
 
-func (s storageImpl) Create(ctx context.Context, _, k string, o model.Op, v float64) (id string, err error) {
+func (s storageImpl) Create(ctx context.Context, interestId string, cond model.Condition) (id string, err error) {
 	maxLockTime := time.Now().UTC().Add(-s.createLockTtl)
 	clauseCreateLockExpired := bson.M{
 		attrCreateLockTime: bson.M{
 			"$lt": maxLockTime,
 		},
 	}
-	q := bson.M{
-		attrKey: k,
-		attrOp:  o,
-		attrVal: v,
-		"$or": []bson.M{
-			clauseCreateLockExpired,
-			clauseCreateLockMissing,
-		},
-	}
-	u := bson.M{
-		"$set": bson.M{
-			attrKey: k,
-			attrOp:  o,
-			attrVal: v,
-		},
-	}
-	result := s.coll.FindOneAndUpdate(ctx, q, u, optsUpsert)
-	var rec condition
+	rec, err := encodeCondition(cond)
+	var resultRec condition
 	if err == nil {
-		err = result.Decode(&rec)
+		q := bson.M{
+			"$or": []bson.M{
+				clauseCreateLockExpired,
+				clauseCreateLockMissing,
+			},
+		}
+		for k, v := range rec {
+			q[k] = v
+		}
+		u := bson.M{
+			"$set": rec,
+			"$addToSet": bson.M{
+				attrInterests: interestId,
+			},
+		}
+		err = s.coll.FindOneAndUpdate(ctx, q, u, optsUpsert).Decode(&resultRec)
+		// the condition encoding errors are the model validation ones and returned as is
+		err = decodeError(err)
 	}
 	if err == nil {
-		id = rec.Id
+		id = resultRec.Id
 	}
-	err = decodeError(err)
 	return
 }
 
 func (s storageImpl) LockCreate(ctx context.Context, id string) (err error) {
 	var oid primitive.ObjectID
-	oid, err = primitive.ObjectIDFromHex(id)
+	oid, err = decodeId("id", id)
 	var result *mongo.UpdateResult
 	if err == nil {
 		u := bson.M{
@@ -211,7 +424,7 @@ func (s storageImpl) LockCreate(ctx context.Context, id string) (err error) {
 
 func (s storageImpl) UnlockCreate(ctx context.Context, id string) (err error) {
 	var oid primitive.ObjectID
-	oid, err = primitive.ObjectIDFromHex(id)
+	oid, err = decodeId("id", id)
 	if err == nil {
 		q := bson.M{
 			attrId: oid,
@@ -230,38 +443,229 @@ func (s storageImpl) UnlockCreate(ctx context.Context, id string) (err error) {
 	return
 }
 
-func (s storageImpl) Delete(ctx context.Context, _, id string) (err error) {
+// Delete deletes the condition in one step when referenced by the interest only, otherwise removes the interest
+// reference. The concurrent Create adding the reference either makes the condition not referenced by the interest
+// only or follows the deletion creating the new condition. The condition created before the references tracking has
+// no references and is owned by the deleting interest.
+func (s storageImpl) Delete(ctx context.Context, interestId, id string) (err error) {
 	var oid primitive.ObjectID
-	oid, err = primitive.ObjectIDFromHex(id)
+	oid, err = decodeId("id", id)
+	var deleted bool
 	if err == nil {
 		q := bson.M{
 			attrId: oid,
+			"$or": []bson.M{
+				{
+					attrInterests: bson.A{
+						interestId,
+					},
+				},
+				{
+					attrInterests: bson.M{
+						"$exists": false,
+					},
+				},
+			},
+		}
+		deleted, err = s.deleteOne(ctx, q)
+	}
+	if err == nil && !deleted {
+		u := bson.M{
+			"$pull": bson.M{
+				attrInterests: interestId,
+			},
+		}
+		_, err = s.coll.UpdateByID(ctx, oid, u)
+		err = decodeError(err)
+	}
+	// the other interest reference may be removed concurrently after the deletion attempt above, the condition is left
+	// not referenced then
+	if err == nil && !deleted {
+		q := bson.M{
+			attrId: oid,
+			attrInterests: bson.M{
+				"$size": 0,
+			},
+		}
+		deleted, err = s.deleteOne(ctx, q)
+	}
+	if err == nil && deleted {
+		err = s.state.Delete(ctx, id)
+	}
+	return
+}
+
+func (s storageImpl) deleteOne(ctx context.Context, q bson.M) (deleted bool, err error) {
+	var result *mongo.DeleteResult
+	result, err = s.coll.DeleteOne(ctx, q)
+	if err == nil {
+		deleted = result.DeletedCount > 0
+	}
+	err = decodeError(err)
+	return
+}
+
+func (s storageImpl) SearchPage(ctx context.Context, attr model.Attr, limit uint32, cursor string) (ids []string, stats model.Stats, err error) {
+	now := model.UnixSeconds(s.clock())
+	var v any = attr.Val
+	switch {
+	case attr.Dec != "":
+		v, err = encodeDecimal(attr.Dec)
+	case attr.Int != nil:
+		v = *attr.Int
+	}
+	// the state is used only when the change or the anomaly conditions exist for the attribute, so the search doesn't
+	// write otherwise
+	var change, anomaly bool
+	if err == nil {
+		change, anomaly, err = s.statefulOps(ctx, attr)
+	}
+	// the first page observes the value, the following pages reuse the same previous value and statistics
+	var prev float64
+	var prevFound bool
+	if err == nil && change {
+		switch cursor {
+		case "":
+			prev, prevFound, err = s.state.Observe(ctx, attr)
+		default:
+			prev, prevFound, err = s.state.Previous(ctx, attr)
+		}
+	}
+	if err == nil && anomaly {
+		switch cursor {
+		case "":
+			stats, err = s.stats.Update(ctx, attr)
+		default:
+			stats, err = s.stats.Get(ctx, attr)
+		}
+	}
+	if err == nil {
+		vals := []bson.M{
+			valsQuery(nil, v),
+			valsQuery(true, attr.Float64()-now),
+			// the windowed aggregate conditions are selected regardless of the value
+			{
+				attrRelative: nil,
+				attrWindow: bson.M{
+					"$ne": nil,
+				},
+			},
+		}
+		if prevFound {
+			vals = append(vals, changeQuery(prev, attr.Float64()))
+		}
+		if bits, ok := attr.Bits(); ok {
+			vals = append(vals, bitsQuery(bits))
+		}
+		if i, ok := attr.Integer(); ok {
+			vals = append(vals, modQuery(i))
+		}
+		vals = append(vals, cyclicRangeQuery(attr.Float64()))
+		if z, ok := stats.ZScore(attr.Float64()); ok {
+			vals = append(vals, bson.M{
+				attrOp:       model.OpAnomaly,
+				attrRelative: nil,
+				attrVal: bson.M{
+					"$lt": math.Abs(z),
+				},
+			})
+		}
+		query := func(cursorObjId primitive.ObjectID) bson.M {
+			return searchQuery(attr, vals, cursorObjId)
+		}
+		// the crossing conditions are selected when either beyond the threshold or the re-arm level,
+		// the state decides whether those fire, the same is for the windowed aggregate conditions
+		accept := func(ctx context.Context, rec condition) (ok bool, err error) {
+			switch {
+			case rec.Op.IsCrossing():
+				ok, err = s.state.Cross(ctx, rec.Id, rec.decodeCrossing(), attr)
+			case rec.Window != nil:
+				cond := rec.decodeWindowed()
+				var agg float64
+				agg, ok, err = s.state.Aggregate(ctx, rec.Id, cond, attr, s.clock())
+				ok = ok && cond.MatchesAggregate(agg)
+			default:
+				ok = true
+			}
+			return
+		}
+		ids, err = s.searchPage(ctx, limit, cursor, query, accept)
+	}
+	return
+}
+
+// statefulOps reports whether the change and the anomaly conditions exist for the attribute key and unit.
+func (s storageImpl) statefulOps(ctx context.Context, attr model.Attr) (change, anomaly bool, err error) {
+	q := bson.M{
+		"$and": append(keyQuery(attr), bson.M{
+			attrOp: bson.M{
+				"$in": bson.A{
+					model.OpChange,
+					model.OpAnomaly,
+				},
+			},
+		}),
+	}
+	var ops []any
+	ops, err = s.collRo.Distinct(ctx, attrOp, q)
+	for _, op := range ops {
+		// the operation is stored as the integer of the minimal size
+		var i int64
+		switch v := op.(type) {
+		case int32:
+			i = int64(v)
+		case int64:
+			i = v
+		}
+		switch model.Op(i) {
+		case model.OpChange:
+			change = true
+		case model.OpAnomaly:
+			anomaly = true
 		}
-		_, err = s.coll.DeleteOne(ctx, q)
 	}
 	err = decodeError(err)
 	return
 }
 
-func (s storageImpl) SearchPage(ctx context.Context, key string, val float64, limit uint32, cursor string) (ids []string, err error) {
+func (s storageImpl) SearchMultiPage(ctx context.Context, attrs map[string]float64, limit uint32, cursor string) (ids []string, err error) {
+	query := func(cursorObjId primitive.ObjectID) bson.M {
+		return searchMultiQuery(attrs, cursorObjId)
+	}
+	ids, err = s.searchPage(ctx, limit, cursor, query, nil)
+	return
+}
+
+// searchPage returns up to the limit of the found conditions accepted by the optional accept function.
+func (s storageImpl) searchPage(
+	ctx context.Context,
+	limit uint32,
+	cursor string,
+	query func(cursor primitive.ObjectID) bson.M,
+	accept func(ctx context.Context, rec condition) (ok bool, err error),
+) (ids []string, err error) {
 	var cursorObjId primitive.ObjectID
 	switch cursor {
 	case "":
 		cursorObjId = primitive.NilObjectID
 	default:
-		cursorObjId, err = primitive.ObjectIDFromHex(cursor)
+		cursorObjId, err = decodeId("cursor", cursor)
 	}
 	var cur *mongo.Cursor
 	if err == nil {
-		q := searchQuery(key, val, cursorObjId)
-		cur, err = s.collRo.Find(ctx, q, optsFindPage.SetLimit(int64(limit)))
+		q := query(cursorObjId)
+		cur, err = s.collRo.Find(ctx, q, findPageOpts(limit))
 	}
 	if err == nil {
 		defer cur.Close(ctx)
-		for cur.Next(ctx) {
+		for (limit == 0 || len(ids) < int(limit)) && cur.Next(ctx) {
 			var rec condition
 			err = cur.Decode(&rec)
-			if err == nil {
+			ok := true
+			if err == nil && accept != nil {
+				ok, err = accept(ctx, rec)
+			}
+			if err == nil && ok {
 				ids = append(ids, rec.Id)
 			}
 			if err != nil {
@@ -273,82 +677,687 @@ func (s storageImpl) SearchPage(ctx context.Context, key string, val float64, li
 	return
 }
 
-func searchQuery(k string, v float64, cursor primitive.ObjectID) (q bson.M) {
-	return bson.M{
-		"$and": []bson.M{
-			{
-				attrId: bson.M{
-					"$gt": cursor,
-				},
+// findPageOpts returns the search options fetching the batches of the page size, the zero limit means no limit.
+// The limit is not set as the found conditions may be not accepted and the next batch is fetched then.
+func findPageOpts(limit uint32) (opts *options.FindOptions) {
+	opts = options.
+		Find().
+		SetProjection(projSearch).
+		SetSort(projId)
+	if limit > 0 {
+		opts.SetBatchSize(int32(min(limit, math.MaxInt32)))
+	}
+	return
+}
+
+// searchQuery selects the conditions matching the attribute key and unit and any of the values queries.
+// The relative-time conditions are compared with the offset of the attribute value from the current Unix time.
+func searchQuery(attr model.Attr, vals []bson.M, cursor primitive.ObjectID) (q bson.M) {
+	clauses := []bson.M{
+		{
+			attrId: bson.M{
+				"$gt": cursor,
 			},
+		},
+	}
+	clauses = append(clauses, keyQuery(attr)...)
+	clauses = append(clauses, bson.M{
+		"$or": []bson.M{
 			{
-				"$or": []bson.M{
-					{
-						attrKey: "",
-					},
-					{
-						attrKey: k,
-					},
-				},
+				attrNot: nil,
+				"$or":   vals,
 			},
 			{
-				"$or": []bson.M{
-					{
-						"$and": []bson.M{
-							{
-								attrOp: model.OpGt,
-							},
-							{
-								attrVal: bson.M{
-									"$lt": v,
-								},
-							},
-						},
-					},
-					{
-						"$and": []bson.M{
-							{
-								attrOp: model.OpGte,
+				attrNot: true,
+				"$nor":  vals,
+			},
+		},
+	})
+	return bson.M{
+		"$and": clauses,
+	}
+}
+
+// keyQuery returns the clauses selecting the single attribute conditions matching the attribute key and unit.
+func keyQuery(attr model.Attr) []bson.M {
+	k := attr.Key
+	var u any
+	if attr.Unit != "" {
+		u = attr.Unit
+	}
+	return []bson.M{
+		{
+			attrUnit: u,
+		},
+		{
+			"$or": []bson.M{
+				{
+					attrKey:     "",
+					attrTermsId: nil,
+				},
+				{
+					attrKey: k,
+				},
+				{
+					attrKeyPrefix: bson.M{
+						"$in": model.KeyPrefixes(k),
+					},
+					"$or": []bson.M{
+						{
+							attrKeyMatch: model.KeyMatchPrefix,
+						},
+						{
+							attrKeyMatch: model.KeyMatchGlob,
+							"$expr": bson.M{
+								"$regexMatch": bson.M{
+									"input": k,
+									"regex": "$" + attrKeyRegex,
+								},
 							},
-							{
-								attrVal: bson.M{
-									"$lte": v,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// changeQuery selects the change conditions satisfied by the value following the previous one, see
+// model.Condition.Changed.
+func changeQuery(prev, v float64) bson.M {
+	d := v - prev
+	rel := model.RelChange(prev, v)
+	dirs := func(d float64) bson.M {
+		return bson.M{
+			"$or": []bson.M{
+				{
+					attrChangeDir: model.ChangeAny,
+					attrVal: bson.M{
+						"$lt": math.Abs(d),
+					},
+				},
+				{
+					attrChangeDir: model.ChangeUp,
+					attrVal: bson.M{
+						"$lt": d,
+					},
+				},
+				{
+					attrChangeDir: model.ChangeDown,
+					attrVal: bson.M{
+						"$lt": -d,
+					},
+				},
+			},
+		}
+	}
+	return bson.M{
+		attrOp:       model.OpChange,
+		attrRelative: nil,
+		"$or": []bson.M{
+			{
+				"$and": []bson.M{
+					{
+						attrChangeRel: false,
+					},
+					dirs(d),
+				},
+			},
+			{
+				"$and": []bson.M{
+					{
+						attrChangeRel: true,
+					},
+					dirs(rel),
+				},
+			},
+		},
+	}
+}
+
+// bitsQuery selects the bitwise conditions satisfied by the attribute bits, the condition bit mask is kept as the
+// integer value. The bit positions are used instead of the numeric bit masks, as the latter are limited to 32 bits.
+func bitsQuery(bits int64) bson.M {
+	set, unset := []int{}, []int{}
+	for i := 0; i < 64; i++ {
+		switch bits & (1 << i) {
+		case 0:
+			unset = append(unset, i)
+		default:
+			set = append(set, i)
+		}
+	}
+	return bson.M{
+		attrRelative: nil,
+		attrWindow:   nil,
+		"$or": []bson.M{
+			{
+				// all the mask bits are set when the mask has no bits clear in the value
+				attrOp: model.OpBitsAllSet,
+				attrValInt: bson.M{
+					"$bitsAllClear": unset,
+				},
+			},
+			{
+				attrOp: model.OpBitsAnySet,
+				attrValInt: bson.M{
+					"$bitsAnySet": set,
+				},
+			},
+			{
+				attrOp: model.OpBitsNoneSet,
+				attrValInt: bson.M{
+					"$bitsAllClear": set,
+				},
+			},
+		},
+	}
+}
+
+// modQuery selects the modulo conditions satisfied by the integer value, the stored divisors are never zero.
+func modQuery(i int64) bson.M {
+	return bson.M{
+		attrOp:       model.OpMod,
+		attrRelative: nil,
+		attrWindow:   nil,
+		"$expr": bson.M{
+			"$eq": bson.A{
+				bson.M{
+					"$mod": bson.A{
+						i,
+						"$" + attrModDiv,
+					},
+				},
+				"$" + attrModRem,
+			},
+		},
+	}
+}
+
+// cyclicRangeQuery selects the cyclic range conditions containing the value taken modulo the condition period, the
+// stored bounds are taken modulo the period already. The range wraps around the end of the period when the lower
+// bound is greater than the upper one. The range spanning the whole period is stored either as [0, period] containing any
+// value or as the range excluding the single value, see model.Condition.CyclicRange.
+func cyclicRangeQuery(v float64) bson.M {
+	aboveMin := bson.M{
+		"$cond": bson.A{
+			"$" + attrRangeMinIncl,
+			bson.M{
+				"$gte": bson.A{
+					"$$v",
+					"$" + attrVal,
+				},
+			},
+			bson.M{
+				"$gt": bson.A{
+					"$$v",
+					"$" + attrVal,
+				},
+			},
+		},
+	}
+	belowMax := bson.M{
+		"$cond": bson.A{
+			"$" + attrRangeMaxIncl,
+			bson.M{
+				"$lte": bson.A{
+					"$$v",
+					"$" + attrRangeMax,
+				},
+			},
+			bson.M{
+				"$lt": bson.A{
+					"$$v",
+					"$" + attrRangeMax,
+				},
+			},
+		},
+	}
+	return bson.M{
+		attrOp:       model.OpCyclicRange,
+		attrRelative: nil,
+		attrWindow:   nil,
+		"$expr": bson.M{
+			"$let": bson.M{
+				"vars": bson.M{
+					// the remainder has the sign of the value, shift the negative one into [0, period)
+					"v": bson.M{
+						"$mod": bson.A{
+							bson.M{
+								"$add": bson.A{
+									bson.M{
+										"$mod": bson.A{
+											v,
+											"$" + attrPeriod,
+										},
+									},
+									"$" + attrPeriod,
 								},
 							},
+							"$" + attrPeriod,
+						},
+					},
+				},
+				"in": bson.M{
+					"$cond": bson.A{
+						bson.M{
+							"$lte": bson.A{
+								"$" + attrVal,
+								"$" + attrRangeMax,
+							},
+						},
+						bson.M{
+							"$and": bson.A{
+								aboveMin,
+								belowMax,
+							},
+						},
+						bson.M{
+							"$or": bson.A{
+								aboveMin,
+								belowMax,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// valsQuery selects both the integer and the other conditions by the relative flag value.
+// The integer conditions are compared using the integer value field, the database compares the numbers of
+// different types by their values.
+func valsQuery(relative any, v any) bson.M {
+	return bson.M{
+		attrRelative: relative,
+		attrWindow:   nil,
+		"$or": []bson.M{
+			{
+				"$and": []bson.M{
+					{
+						attrValInt: nil,
+					},
+					valQuery(attrVal, v),
+				},
+			},
+			{
+				"$and": []bson.M{
+					{
+						attrValInt: bson.M{
+							"$type": "long",
+						},
+					},
+					valQuery(attrValInt, v),
+				},
+			},
+		},
+	}
+}
+
+// valQuery selects the conditions satisfied by the value, the comparison operations use the specified value field.
+func valQuery(valField string, v any) bson.M {
+	return bson.M{
+		"$or": []bson.M{
+			{
+				"$and": []bson.M{
+					{
+						attrOp: model.OpGt,
+					},
+					{
+						valField: bson.M{
+							"$lt": v,
 						},
 					},
+				},
+			},
+			{
+				"$and": []bson.M{
+					{
+						attrOp: model.OpGte,
+					},
 					{
-						"$and": []bson.M{
+						valField: bson.M{
+							"$lte": v,
+						},
+					},
+				},
+			},
+			{
+				"$and": []bson.M{
+					{
+						attrOp: model.OpEq,
+					},
+					{
+						"$or": []bson.M{
 							{
-								attrOp: model.OpEq,
+								valField: v,
 							},
 							{
-								attrVal: v,
+								attrEqMin: bson.M{
+									"$lte": v,
+								},
+								attrEqMax: bson.M{
+									"$gte": v,
+								},
 							},
 						},
 					},
+				},
+			},
+			{
+				"$and": []bson.M{
+					{
+						attrOp: model.OpLte,
+					},
+					{
+						valField: bson.M{
+							"$gte": v,
+						},
+					},
+				},
+			},
+			{
+				"$and": []bson.M{
+					{
+						attrOp: model.OpLt,
+					},
+					{
+						valField: bson.M{
+							"$gt": v,
+						},
+					},
+				},
+			},
+			{
+				"$and": []bson.M{
+					{
+						attrOp: model.OpNe,
+					},
+					{
+						valField: bson.M{
+							"$ne": v,
+						},
+					},
+				},
+			},
+			{
+				"$and": []bson.M{
+					{
+						attrOp: model.OpRange,
+					},
 					{
-						"$and": []bson.M{
+						"$or": []bson.M{
 							{
-								attrOp: model.OpLte,
+								attrRangeMinIncl: true,
+								attrVal: bson.M{
+									"$lte": v,
+								},
 							},
 							{
+								attrRangeMinIncl: false,
 								attrVal: bson.M{
+									"$lt": v,
+								},
+							},
+						},
+					},
+					{
+						"$or": []bson.M{
+							{
+								attrRangeMaxIncl: true,
+								attrRangeMax: bson.M{
 									"$gte": v,
 								},
 							},
+							{
+								attrRangeMaxIncl: false,
+								attrRangeMax: bson.M{
+									"$gt": v,
+								},
+							},
+						},
+					},
+				},
+			},
+			{
+				"$and": []bson.M{
+					{
+						attrOp: model.OpIn,
+					},
+					{
+						attrVals: v,
+					},
+				},
+			},
+			{
+				"$and": []bson.M{
+					{
+						attrOp: model.OpNotIn,
+					},
+					{
+						attrVals: bson.M{
+							"$ne": v,
 						},
 					},
+				},
+			},
+			{
+				"$and": []bson.M{
+					{
+						attrOp: model.OpCrossAbove,
+					},
 					{
-						"$and": []bson.M{
+						"$or": []bson.M{
 							{
-								attrOp: model.OpLt,
+								attrVal: bson.M{
+									"$lt": v,
+								},
 							},
+							// re-arm
+							{
+								"$expr": bson.M{
+									"$gt": bson.A{
+										bson.M{
+											"$subtract": bson.A{
+												"$" + attrVal,
+												"$" + attrHysteresis,
+											},
+										},
+										v,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			{
+				"$and": []bson.M{
+					{
+						attrOp: model.OpCrossBelow,
+					},
+					{
+						"$or": []bson.M{
 							{
 								attrVal: bson.M{
 									"$gt": v,
 								},
 							},
+							// re-arm
+							{
+								"$expr": bson.M{
+									"$lt": bson.A{
+										bson.M{
+											"$add": bson.A{
+												"$" + attrVal,
+												"$" + attrHysteresis,
+											},
+										},
+										v,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// searchMultiQuery selects the cross-attribute conditions referencing only the specified attributes and computes the
+// sum of the condition terms substituting the attribute values. The negated exact key conditions of the absent
+// attributes are selected too.
+func searchMultiQuery(attrs map[string]float64, cursor primitive.ObjectID) (q bson.M) {
+	keys := slices.Sorted(maps.Keys(attrs))
+	vals := make([]float64, len(keys))
+	for i, k := range keys {
+		vals[i] = attrs[k]
+	}
+	termVal := bson.M{
+		"$arrayElemAt": bson.A{
+			bson.M{
+				"$literal": vals,
+			},
+			bson.M{
+				"$indexOfArray": bson.A{
+					bson.M{
+						"$literal": keys,
+					},
+					"$$t." + attrTermKey,
+				},
+			},
+		},
+	}
+	sum := bson.M{
+		"$sum": bson.M{
+			"$map": bson.M{
+				"input": "$" + attrTerms,
+				"as":    "t",
+				"in": bson.M{
+					"$multiply": bson.A{
+						"$$t." + attrTermCoef,
+						termVal,
+					},
+				},
+			},
+		},
+	}
+	// the integer conditions keep the value null, any number is greater than null
+	val := bson.M{
+		"$ifNull": bson.A{
+			"$" + attrVal,
+			"$" + attrValInt,
+		},
+	}
+	cmp := func(op model.Op, cmpOp string) bson.M {
+		return bson.M{
+			attrOp: op,
+			"$expr": bson.M{
+				cmpOp: bson.A{
+					sum,
+					val,
+				},
+			},
+		}
+	}
+	// every term key is present and the sum satisfies the comparison
+	matches := bson.M{
+		"$and": []bson.M{
+			{
+				attrTerms: bson.M{
+					"$not": bson.M{
+						"$elemMatch": bson.M{
+							attrTermKey: bson.M{
+								"$nin": keys,
+							},
+						},
+					},
+				},
+			},
+			{
+				"$or": []bson.M{
+					cmp(model.OpGt, "$gt"),
+					cmp(model.OpGte, "$gte"),
+					{
+						attrOp: model.OpEq,
+						"$expr": bson.M{
+							"$or": bson.A{
+								bson.M{
+									"$eq": bson.A{
+										sum,
+										val,
+									},
+								},
+								// the bounds are null for the exact equality, any number is greater than null
+								bson.M{
+									"$and": bson.A{
+										bson.M{
+											"$gte": bson.A{
+												sum,
+												"$" + attrEqMin,
+											},
+										},
+										bson.M{
+											"$lte": bson.A{
+												sum,
+												"$" + attrEqMax,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					cmp(model.OpLte, "$lte"),
+					cmp(model.OpLt, "$lt"),
+					cmp(model.OpNe, "$ne"),
+				},
+			},
+		},
+	}
+	return bson.M{
+		"$and": []bson.M{
+			{
+				attrId: bson.M{
+					"$gt": cursor,
+				},
+			},
+			{
+				attrRelative: nil,
+				attrWindow:   nil,
+			},
+			{
+				"$or": []bson.M{
+					{
+						attrTermsKey: bson.M{
+							"$in": keys,
+						},
+						// the negated conditions match also when any term key is absent
+						"$or": []bson.M{
+							{
+								attrNot: nil,
+								"$and": []bson.M{
+									matches,
+								},
+							},
+							{
+								attrNot: true,
+								"$nor": []bson.M{
+									matches,
+								},
+							},
+						},
+					},
+					{
+						// the negated single attribute conditions match when the attribute is absent
+						attrTermsId:  nil,
+						attrKeyMatch: nil,
+						attrNot:      true,
+						attrKey: bson.M{
+							"$nin": keys,
+							"$ne":  "",
 						},
 					},
 				},
@@ -357,9 +1366,22 @@ func searchQuery(k string, v float64, cursor primitive.ObjectID) (q bson.M) {
 	}
 }
 
+func decodeId(field, id string) (oid primitive.ObjectID, err error) {
+	oid, err = primitive.ObjectIDFromHex(id)
+	if err != nil {
+		err = storage.InvalidError{
+			Field: field,
+			Err:   err,
+		}
+	}
+	return
+}
+
 func decodeError(src error) (dst error) {
 	switch {
 	case src == nil:
+	case errors.Is(src, storage.ErrInvalid):
+		dst = src
 	case mongo.IsDuplicateKeyError(src):
 		dst = fmt.Errorf("%w: %s", storage.ErrConflict, src)
 	default:
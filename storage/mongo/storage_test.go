@@ -8,7 +8,11 @@ import (
 	"github.com/awakari/conditions-number/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"math/rand"
 	"os"
 	"testing"
 	"time"
@@ -29,19 +33,1367 @@ func TestNewStorage(t *testing.T) {
 	dbCfg.Tls.Insecure = true
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
 	defer cancel()
-	s, err := NewStorage(ctx, dbCfg)
+	s, err := NewStorage(ctx, dbCfg, time.Now)
 	assert.NotNil(t, s)
 	assert.Nil(t, err)
 	//
 	clear(ctx, t, s.(storageImpl))
 }
 
+func TestNewStorage_BaselineIndex(t *testing.T) {
+	//
+	collName := fmt.Sprintf("conditions-number-test-%d", time.Now().UnixMicro())
+	dbCfg := config.DbConfig{
+		Uri:  dbUri,
+		Name: "conditions-number",
+	}
+	dbCfg.Table.Name = collName + "-tmp"
+	dbCfg.Tls.Enabled = true
+	dbCfg.Tls.Insecure = true
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+	tmp, err := NewStorage(ctx, dbCfg, time.Now)
+	require.Nil(t, err)
+	// the collection created by the baseline version having the unique index by key, op and value only
+	coll := tmp.(storageImpl).db.Collection(collName)
+	_, err = coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{
+				Key:   attrKey,
+				Value: 1,
+			},
+			{
+				Key:   attrOp,
+				Value: 1,
+			},
+			{
+				Key:   attrVal,
+				Value: 1,
+			},
+		},
+		Options: options.
+			Index().
+			SetUnique(true),
+	})
+	require.Nil(t, err)
+	_, err = coll.InsertOne(ctx, bson.M{attrKey: "price", attrOp: model.OpGt, attrVal: 1.0})
+	require.Nil(t, err)
+	clear(ctx, t, tmp.(storageImpl))
+	//
+	dbCfg.Table.Name = collName
+	s, err := NewStorage(ctx, dbCfg, time.Now)
+	require.Nil(t, err)
+	defer clear(ctx, t, s.(storageImpl))
+	specs, err := s.(storageImpl).coll.Indexes().ListSpecifications(ctx)
+	require.Nil(t, err)
+	var names []string
+	for _, spec := range specs {
+		names = append(names, spec.Name)
+	}
+	assert.NotContains(t, names, "key_1_op_1_val_1")
+	//
+	conds := []model.Condition{
+		{Key: "price", Op: model.OpGt, Val: 1, Unit: "EUR"},
+		{Key: "price", Op: model.OpGt, Val: 1, Not: true},
+		{Key: "price", Op: model.OpEq, Val: 1},
+		{Key: "price", Op: model.OpEq, Val: 1, Tolerance: model.Tolerance{Abs: 0.1}},
+		{Key: "price", Op: model.OpRange, Range: model.Range{Min: 1, Max: 2}},
+		{Key: "price", Op: model.OpRange, Range: model.Range{Min: 1, Max: 3}},
+	}
+	for _, cond := range conds {
+		_, err = s.Create(ctx, "interest1", cond)
+		assert.Nil(t, err, cond)
+	}
+}
+
 func clear(ctx context.Context, t *testing.T, s storageImpl) {
 	require.Nil(t, s.coll.Drop(ctx))
+	require.Nil(t, s.state.(stateImpl).coll.Drop(ctx))
 	require.Nil(t, s.Close())
 }
 
-func TestStorageImpl_SearchPage(t *testing.T) {
+func TestStorageImpl_SearchPage(t *testing.T) {
+	//
+	collName := fmt.Sprintf("conditions-number-test-%d", time.Now().UnixMicro())
+	dbCfg := config.DbConfig{
+		Uri:  dbUri,
+		Name: "conditions-number",
+	}
+	dbCfg.Table.Name = collName
+	dbCfg.Tls.Enabled = true
+	dbCfg.Tls.Insecure = true
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Minute)
+	defer cancel()
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	ts := model.UnixSeconds(now)
+	s, err := NewStorage(ctx, dbCfg, func() time.Time {
+		return now
+	})
+	require.Nil(t, err)
+	defer clear(ctx, t, s.(storageImpl))
+	//
+	cond0, err := s.Create(ctx, "interest1", model.Condition{Key: "salary", Op: model.OpGt, Val: 2.7182818})
+	require.Nil(t, err)
+	cond1, err := s.Create(ctx, "interest1", model.Condition{Key: "salary", Op: model.OpGte, Val: 3.1415926})
+	require.Nil(t, err)
+	cond2, err := s.Create(ctx, "interest1", model.Condition{Key: "salary", Op: model.OpEq, Val: 3})
+	require.Nil(t, err)
+	cond4, err := s.Create(ctx, "interest1", model.Condition{Key: "price", Op: model.OpLte, Val: 123})
+	require.Nil(t, err)
+	cond5, err := s.Create(ctx, "interest1", model.Condition{Key: "price", Op: model.OpLt, Val: 123})
+	require.Nil(t, err)
+	cond6, err := s.Create(ctx, "interest1", model.Condition{Key: "price", Op: model.OpNe, Val: 123})
+	require.Nil(t, err)
+	cond7, err := s.Create(ctx, "interest1", model.Condition{Key: "temperature", Op: model.OpRange, Range: model.Range{
+		Min:          10,
+		MinInclusive: true,
+		Max:          20,
+	}})
+	require.Nil(t, err)
+	cond8, err := s.Create(ctx, "interest1", model.Condition{Key: "temperature", Op: model.OpRange, Range: model.Range{
+		Min:          10,
+		Max:          20,
+		MaxInclusive: true,
+	}})
+	require.Nil(t, err)
+	cond9, err := s.Create(ctx, "interest1", model.Condition{Key: "status_code", Op: model.OpIn, Vals: []float64{
+		504, 500, 502, 503,
+	}})
+	require.Nil(t, err)
+	cond10, err := s.Create(ctx, "interest1", model.Condition{Key: "status_code", Op: model.OpNotIn, Vals: []float64{
+		200, 204,
+	}})
+	require.Nil(t, err)
+	cond11, err := s.Create(ctx, "interest1", model.Condition{Key: "ratio", Op: model.OpEq, Val: 0.3, Tolerance: model.Tolerance{
+		Abs: 1e-9,
+	}})
+	require.Nil(t, err)
+	cond12, err := s.Create(ctx, "interest1", model.Condition{Key: "ratio", Op: model.OpEq, Val: 0.3})
+	require.Nil(t, err)
+	cond13, err := s.Create(ctx, "interest1", model.Condition{Key: "sensor.*.temperature", KeyMatch: model.KeyMatchGlob, Op: model.OpGt, Val: 50})
+	require.Nil(t, err)
+	cond14, err := s.Create(ctx, "interest1", model.Condition{Key: "sensor.", KeyMatch: model.KeyMatchPrefix, Op: model.OpGt, Val: 50})
+	require.Nil(t, err)
+	cond15, err := s.Create(ctx, "interest1", model.Condition{Key: "distance", Op: model.OpLt, Val: 5000, Unit: "m"})
+	require.Nil(t, err)
+	cond16, err := s.Create(ctx, "interest1", model.Condition{Key: "distance", Op: model.OpLt, Val: 5000})
+	require.Nil(t, err)
+	cond17, err := s.Create(ctx, "interest1", model.Condition{Key: "published", Op: model.OpGte, Val: -86400, Relative: true})
+	require.Nil(t, err)
+	cond18, err := s.Create(ctx, "interest1", model.Condition{Key: "published", Op: model.OpGte, Val: -86400})
+	require.Nil(t, err)
+	cond19, err := s.Create(ctx, "interest1", model.Condition{Key: "expires", Op: model.OpRange, Range: model.Range{
+		Min: 0,
+		Max: 604800,
+	}, Relative: true})
+	require.Nil(t, err)
+	cond20, err := s.Create(ctx, "interest1", model.Condition{Key: "cost", Op: model.OpEq, Dec: "19.99"})
+	require.Nil(t, err)
+	cond21, err := s.Create(ctx, "interest1", model.Condition{Key: "cost", Op: model.OpLte, Val: 19.99})
+	require.Nil(t, err)
+	idMax := int64(9007199254740993)
+	cond22, err := s.Create(ctx, "interest1", model.Condition{Key: "id", Op: model.OpEq, Int: &idMax})
+	require.Nil(t, err)
+	cond23, err := s.Create(ctx, "interest1", model.Condition{Key: "id", Op: model.OpLt, Int: &idMax})
+	require.Nil(t, err)
+	idBelowMax := idMax - 1
+	//
+	cases := map[string]struct {
+		key    string
+		val    float64
+		unit   string
+		dec    model.Decimal
+		int    *int64
+		limit  uint32
+		cursor string
+		ids    []string
+		err    error
+	}{
+		"salary = 3": {
+			key:   "salary",
+			val:   3,
+			limit: 10,
+			ids: []string{
+				cond0,
+				cond2,
+			},
+		},
+		"salary = 3.1415926": {
+			key:   "salary",
+			val:   3.1415926,
+			limit: 10,
+			ids: []string{
+				cond0,
+				cond1,
+			},
+		},
+		"salary = 3.1415926 no limit": {
+			key: "salary",
+			val: 3.1415926,
+			ids: []string{
+				cond0,
+				cond1,
+			},
+		},
+		"salary = 2": {
+			key:   "salary",
+			val:   2,
+			limit: 10,
+			ids:   []string{},
+		},
+		"salary = 2.8": {
+			key:   "salary",
+			val:   2.8,
+			limit: 10,
+			ids: []string{
+				cond0,
+			},
+		},
+		"SourceId = 1000": {
+			key:   "SourceId",
+			val:   1000,
+			limit: 10,
+			ids:   []string{},
+		},
+		"price = 122.99": {
+			key:   "price",
+			val:   122.99,
+			limit: 10,
+			ids: []string{
+				cond4,
+				cond5,
+				cond6,
+			},
+		},
+		"price = 123.00": {
+			key:   "price",
+			val:   123.0,
+			limit: 10,
+			ids: []string{
+				cond4,
+			},
+		},
+		"price = 123.99": {
+			key:   "price",
+			val:   123.99,
+			limit: 10,
+			ids: []string{
+				cond6,
+			},
+		},
+		"temperature = 10": {
+			key:   "temperature",
+			val:   10,
+			limit: 10,
+			ids: []string{
+				cond7,
+			},
+		},
+		"temperature = 15": {
+			key:   "temperature",
+			val:   15,
+			limit: 10,
+			ids: []string{
+				cond7,
+				cond8,
+			},
+		},
+		"temperature = 20": {
+			key:   "temperature",
+			val:   20,
+			limit: 10,
+			ids: []string{
+				cond8,
+			},
+		},
+		"temperature = 25": {
+			key:   "temperature",
+			val:   25,
+			limit: 10,
+			ids:   []string{},
+		},
+		"status_code = 502": {
+			key:   "status_code",
+			val:   502,
+			limit: 10,
+			ids: []string{
+				cond9,
+				cond10,
+			},
+		},
+		"status_code = 404": {
+			key:   "status_code",
+			val:   404,
+			limit: 10,
+			ids: []string{
+				cond10,
+			},
+		},
+		"status_code = 200": {
+			key:   "status_code",
+			val:   200,
+			limit: 10,
+			ids:   []string{},
+		},
+		"ratio = 0.1 + 0.2": {
+			key:   "ratio",
+			val:   0.30000000000000004,
+			limit: 10,
+			ids: []string{
+				cond11,
+			},
+		},
+		"ratio = 0.3": {
+			key:   "ratio",
+			val:   0.3,
+			limit: 10,
+			ids: []string{
+				cond11,
+				cond12,
+			},
+		},
+		"ratio = 0.31": {
+			key:   "ratio",
+			val:   0.31,
+			limit: 10,
+			ids:   []string{},
+		},
+		"sensor.kitchen.temperature = 60": {
+			key:   "sensor.kitchen.temperature",
+			val:   60,
+			limit: 10,
+			ids: []string{
+				cond13,
+				cond14,
+			},
+		},
+		"sensor.kitchen.floor.temperature = 60": {
+			key:   "sensor.kitchen.floor.temperature",
+			val:   60,
+			limit: 10,
+			ids: []string{
+				cond14,
+			},
+		},
+		"sensor.kitchen.temperature = 40": {
+			key:   "sensor.kitchen.temperature",
+			val:   40,
+			limit: 10,
+			ids:   []string{},
+		},
+		"sensors.temperature = 60": {
+			key:   "sensors.temperature",
+			val:   60,
+			limit: 10,
+			ids:   []string{},
+		},
+		"distance = 4000 m": {
+			key:   "distance",
+			val:   4000,
+			unit:  "m",
+			limit: 10,
+			ids: []string{
+				cond15,
+			},
+		},
+		"distance = 4000": {
+			key:   "distance",
+			val:   4000,
+			limit: 10,
+			ids: []string{
+				cond16,
+			},
+		},
+		"distance = 4000 K": {
+			key:   "distance",
+			val:   4000,
+			unit:  "K",
+			limit: 10,
+			ids:   []string{},
+		},
+		"published hour ago": {
+			key:   "published",
+			val:   ts - 3600,
+			limit: 10,
+			ids: []string{
+				cond17,
+				cond18,
+			},
+		},
+		"published 2 days ago": {
+			key:   "published",
+			val:   ts - 2*86400,
+			limit: 10,
+			ids: []string{
+				cond18,
+			},
+		},
+		"expires in day": {
+			key:   "expires",
+			val:   ts + 86400,
+			limit: 10,
+			ids: []string{
+				cond19,
+			},
+		},
+		"expired": {
+			key:   "expires",
+			val:   ts - 1,
+			limit: 10,
+			ids:   []string{},
+		},
+		"cost = 19.99 exact": {
+			key:   "cost",
+			dec:   "19.990",
+			limit: 10,
+			ids: []string{
+				cond20,
+			},
+		},
+		"cost = 19.99": {
+			key:   "cost",
+			val:   19.99,
+			limit: 10,
+			ids: []string{
+				cond21,
+			},
+		},
+		"id = 2^53 + 1": {
+			key:   "id",
+			int:   &idMax,
+			limit: 10,
+			ids: []string{
+				cond22,
+			},
+		},
+		"id = 2^53": {
+			key:   "id",
+			int:   &idBelowMax,
+			limit: 10,
+			ids: []string{
+				cond23,
+			},
+		},
+		"id = 2^53 float": {
+			key:   "id",
+			val:   9007199254740992,
+			limit: 10,
+			ids: []string{
+				cond23,
+			},
+		},
+	}
+	//
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			var ids []string
+			ids, _, err = s.SearchPage(ctx, model.Attr{Key: c.key, Val: c.val, Unit: c.unit, Dec: c.dec, Int: c.int}, c.limit, c.cursor)
+			assert.Equal(t, len(c.ids), len(ids))
+			assert.ErrorIs(t, err, c.err)
+			assert.ElementsMatch(t, c.ids, ids)
+		})
+	}
+}
+
+func TestStorageImpl_SearchPage_Crossing(t *testing.T) {
+	//
+	collName := fmt.Sprintf("conditions-number-test-%d", time.Now().UnixMicro())
+	dbCfg := config.DbConfig{
+		Uri:  dbUri,
+		Name: "conditions-number",
+	}
+	dbCfg.Table.Name = collName
+	dbCfg.Tls.Enabled = true
+	dbCfg.Tls.Insecure = true
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+	s, err := NewStorage(ctx, dbCfg, time.Now)
+	require.Nil(t, err)
+	defer clear(ctx, t, s.(storageImpl))
+	//
+	above, err := s.Create(ctx, "interest1", model.Condition{Key: "cpu", Op: model.OpCrossAbove, Val: 90, Hysteresis: 5})
+	require.Nil(t, err)
+	below, err := s.Create(ctx, "interest1", model.Condition{Key: "cpu", Op: model.OpCrossBelow, Val: 10})
+	require.Nil(t, err)
+	//
+	steps := []struct {
+		entity string
+		val    float64
+		ids    []string
+	}{
+		{
+			val: 50,
+		},
+		{
+			val: 91,
+			ids: []string{
+				above,
+			},
+		},
+		{
+			val: 95,
+		},
+		{
+			entity: "host2",
+			val:    95,
+			ids: []string{
+				above,
+			},
+		},
+		{
+			val: 87,
+		},
+		{
+			val: 92,
+		},
+		{
+			val: 84,
+		},
+		{
+			val: 92,
+			ids: []string{
+				above,
+			},
+		},
+		{
+			val: 5,
+			ids: []string{
+				below,
+			},
+		},
+		{
+			val: 9,
+		},
+	}
+	for i, step := range steps {
+		ids, _, err := s.SearchPage(ctx, model.Attr{Key: "cpu", Val: step.val, Entity: step.entity}, 10, "")
+		require.Nil(t, err)
+		assert.ElementsMatch(t, step.ids, ids, "step %d", i)
+	}
+	//
+	require.Nil(t, s.Delete(ctx, "interest1", above))
+	n, err := s.(storageImpl).state.(stateImpl).coll.CountDocuments(ctx, bson.M{stateAttrCondId: above})
+	require.Nil(t, err)
+	assert.Zero(t, n)
+}
+
+func TestStorageImpl_SearchPage_Change(t *testing.T) {
+	//
+	collName := fmt.Sprintf("conditions-number-test-%d", time.Now().UnixMicro())
+	dbCfg := config.DbConfig{
+		Uri:  dbUri,
+		Name: "conditions-number",
+	}
+	dbCfg.Table.Name = collName
+	dbCfg.Tls.Enabled = true
+	dbCfg.Tls.Insecure = true
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+	s, err := NewStorage(ctx, dbCfg, time.Now)
+	require.Nil(t, err)
+	defer clear(ctx, t, s.(storageImpl))
+	//
+	drop, err := s.Create(ctx, "interest1", model.Condition{
+		Key: "price",
+		Op:  model.OpChange,
+		Val: 0.1,
+		Change: model.Change{
+			Dir: model.ChangeDown,
+			Rel: true,
+		},
+	})
+	require.Nil(t, err)
+	delta, err := s.Create(ctx, "interest1", model.Condition{Key: "price", Op: model.OpChange, Val: 5})
+	require.Nil(t, err)
+	//
+	steps := []struct {
+		entity string
+		val    float64
+		cursor string
+		ids    []string
+	}{
+		{
+			val: 100,
+		},
+		{
+			val: 104,
+		},
+		{
+			entity: "product2",
+			val:    50,
+		},
+		{
+			val: 93,
+			ids: []string{
+				drop,
+				delta,
+			},
+		},
+		{
+			// the next page reuses the same previous value
+			val:    93,
+			cursor: drop,
+			ids: []string{
+				delta,
+			},
+		},
+		{
+			val: 99,
+			ids: []string{
+				delta,
+			},
+		},
+		{
+			entity: "product2",
+			val:    44,
+			ids: []string{
+				drop,
+				delta,
+			},
+		},
+	}
+	for i, step := range steps {
+		ids, _, err := s.SearchPage(ctx, model.Attr{Key: "price", Val: step.val, Entity: step.entity}, 10, step.cursor)
+		require.Nil(t, err)
+		assert.ElementsMatch(t, step.ids, ids, "step %d", i)
+	}
+}
+
+func TestStorageImpl_SearchPage_Window(t *testing.T) {
+	for _, memory := range []bool{false, true} {
+		t.Run(fmt.Sprintf("memory=%t", memory), func(t *testing.T) {
+			//
+			collName := fmt.Sprintf("conditions-number-test-%d", time.Now().UnixMicro())
+			dbCfg := config.DbConfig{
+				Uri:  dbUri,
+				Name: "conditions-number",
+			}
+			dbCfg.Table.Name = collName
+			dbCfg.Table.State.Memory = memory
+			dbCfg.Table.State.Limit = 100
+			dbCfg.Tls.Enabled = true
+			dbCfg.Tls.Insecure = true
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+			defer cancel()
+			now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			s, err := NewStorage(ctx, dbCfg, func() time.Time {
+				return now
+			})
+			require.Nil(t, err)
+			defer clear(ctx, t, s.(storageImpl))
+			//
+			avg, err := s.Create(ctx, "interest1", model.Condition{
+				Key: "latency",
+				Op:  model.OpGt,
+				Val: 300,
+				Window: model.Window{
+					Agg: model.AggAvg,
+					Dur: 5 * time.Minute,
+				},
+			})
+			require.Nil(t, err)
+			count, err := s.Create(ctx, "interest1", model.Condition{
+				Key: "latency",
+				Op:  model.OpGte,
+				Val: 2,
+				Window: model.Window{
+					Agg:      model.AggCount,
+					Dur:      time.Hour,
+					Tumbling: true,
+					Filter: model.WindowFilter{
+						Op:  model.OpGt,
+						Val: 1000,
+					},
+				},
+			})
+			require.Nil(t, err)
+			//
+			steps := []struct {
+				t   time.Duration
+				val float64
+				ids []string
+			}{
+				{
+					val: 200,
+				},
+				{
+					t:   time.Minute,
+					val: 500,
+					ids: []string{
+						avg,
+					},
+				},
+				{
+					t:   2 * time.Minute,
+					val: 1500,
+					ids: []string{
+						avg,
+					},
+				},
+				{
+					t:   10 * time.Minute,
+					val: 100,
+				},
+				{
+					t:   20 * time.Minute,
+					val: 2000,
+					ids: []string{
+						avg,
+						count,
+					},
+				},
+				{
+					t:   61 * time.Minute,
+					val: 1,
+				},
+			}
+			for i, step := range steps {
+				now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(step.t)
+				ids, _, err := s.SearchPage(ctx, model.Attr{Key: "latency", Val: step.val}, 10, "")
+				require.Nil(t, err)
+				assert.ElementsMatch(t, step.ids, ids, "step %d", i)
+			}
+		})
+	}
+}
+
+func TestStorageImpl_SearchPage_Anomaly(t *testing.T) {
+	//
+	collName := fmt.Sprintf("conditions-number-test-%d", time.Now().UnixMicro())
+	dbCfg := config.DbConfig{
+		Uri:  dbUri,
+		Name: "conditions-number",
+	}
+	dbCfg.Table.Name = collName
+	dbCfg.Table.State.Ttl = time.Hour
+	dbCfg.Tls.Enabled = true
+	dbCfg.Tls.Insecure = true
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+	s, err := NewStorage(ctx, dbCfg, time.Now)
+	require.Nil(t, err)
+	defer clear(ctx, t, s.(storageImpl))
+	//
+	cond := model.Condition{Key: "latency", Op: model.OpAnomaly, Val: 3}
+	id, err := s.Create(ctx, "interest1", cond)
+	require.Nil(t, err)
+	//
+	var expected model.Stats
+	for i, v := range []float64{100, 110, 90, 105, 95, 100, 200} {
+		var ids []string
+		var stats model.Stats
+		ids, stats, err = s.SearchPage(ctx, model.Attr{Key: "latency", Val: v}, 10, "")
+		require.Nil(t, err)
+		assert.Equal(t, expected.Count, stats.Count, "step %d", i)
+		assert.InDelta(t, expected.Mean, stats.Mean, 1e-9, "step %d", i)
+		assert.InDelta(t, expected.M2, stats.M2, 1e-9, "step %d", i)
+		switch cond.Deviates(expected, v) {
+		case true:
+			assert.Equal(t, []string{id}, ids, "step %d", i)
+		default:
+			assert.Empty(t, ids, "step %d", i)
+		}
+		expected = expected.Add(v)
+	}
+	// the next page reuses the same statistics
+	_, stats, err := s.SearchPage(ctx, model.Attr{Key: "latency", Val: 200}, 10, id)
+	require.Nil(t, err)
+	assert.Equal(t, int64(6), stats.Count)
+	// the attribute having no stateful conditions leaves no state
+	_, stats, err = s.SearchPage(ctx, model.Attr{Key: "cpu", Val: 1}, 10, "")
+	require.Nil(t, err)
+	assert.Zero(t, stats.Count)
+	n, err := s.(storageImpl).state.(stateImpl).coll.CountDocuments(ctx, bson.M{stateAttrKey: "cpu"})
+	require.Nil(t, err)
+	assert.Zero(t, n)
+}
+
+func TestStorageImpl_SearchPage_Bits(t *testing.T) {
+	//
+	collName := fmt.Sprintf("conditions-number-test-%d", time.Now().UnixMicro())
+	dbCfg := config.DbConfig{
+		Uri:  dbUri,
+		Name: "conditions-number",
+	}
+	dbCfg.Table.Name = collName
+	dbCfg.Tls.Enabled = true
+	dbCfg.Tls.Insecure = true
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+	s, err := NewStorage(ctx, dbCfg, time.Now)
+	require.Nil(t, err)
+	defer clear(ctx, t, s.(storageImpl))
+	//
+	conds := map[string]model.Condition{
+		"all": {
+			Key: "flags",
+			Op:  model.OpBitsAllSet,
+			Int: ptr(int64(0b101)),
+		},
+		"any": {
+			Key: "flags",
+			Op:  model.OpBitsAnySet,
+			Int: ptr(int64(0b110)),
+		},
+		"none": {
+			Key: "flags",
+			Op:  model.OpBitsNoneSet,
+			Int: ptr(int64(0b1000)),
+		},
+		"high": {
+			Key: "flags",
+			Op:  model.OpBitsAllSet,
+			Int: ptr(int64(1 << 40)),
+		},
+	}
+	ids := map[string]string{}
+	for k, cond := range conds {
+		ids[k], err = s.Create(ctx, "interest1", cond)
+		require.Nil(t, err)
+	}
+	_, err = s.Create(ctx, "interest1", model.Condition{Key: "flags", Op: model.OpBitsAnySet, Val: -1})
+	assert.ErrorIs(t, err, model.ErrInvalidBitMask)
+	//
+	cases := map[string]struct {
+		attr     model.Attr
+		expected []string
+	}{
+		"int": {
+			attr: model.Attr{
+				Key: "flags",
+				Int: ptr(int64(0b111)),
+			},
+			expected: []string{
+				"all",
+				"any",
+				"none",
+			},
+		},
+		"float": {
+			attr: model.Attr{
+				Key: "flags",
+				Val: 0b1001,
+			},
+		},
+		"high bit": {
+			attr: model.Attr{
+				Key: "flags",
+				Int: ptr(int64(1<<40 | 0b1000)),
+			},
+			expected: []string{
+				"high",
+			},
+		},
+		"zero": {
+			attr: model.Attr{
+				Key: "flags",
+			},
+			expected: []string{
+				"none",
+			},
+		},
+		"fraction": {
+			attr: model.Attr{
+				Key: "flags",
+				Val: 1.5,
+			},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			var expected []string
+			for _, condKey := range c.expected {
+				expected = append(expected, ids[condKey])
+			}
+			actual, _, err := s.SearchPage(ctx, c.attr, 10, "")
+			require.Nil(t, err)
+			assert.ElementsMatch(t, expected, actual)
+		})
+	}
+}
+
+func TestStorageImpl_SearchPage_Mod(t *testing.T) {
+	//
+	collName := fmt.Sprintf("conditions-number-test-%d", time.Now().UnixMicro())
+	dbCfg := config.DbConfig{
+		Uri:  dbUri,
+		Name: "conditions-number",
+	}
+	dbCfg.Table.Name = collName
+	dbCfg.Tls.Enabled = true
+	dbCfg.Tls.Insecure = true
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+	s, err := NewStorage(ctx, dbCfg, time.Now)
+	require.Nil(t, err)
+	defer clear(ctx, t, s.(storageImpl))
+	//
+	conds := map[string]model.Condition{
+		"even": {
+			Key: "id",
+			Op:  model.OpMod,
+			Mod: model.Mod{
+				Div: 2,
+			},
+		},
+		"odd": {
+			Key: "id",
+			Op:  model.OpMod,
+			Mod: model.Mod{
+				Div: 2,
+				Rem: 1,
+			},
+		},
+		"every 1000th": {
+			Key: "id",
+			Op:  model.OpMod,
+			Mod: model.Mod{
+				Div: 1000,
+			},
+		},
+		"negative": {
+			Key: "id",
+			Op:  model.OpMod,
+			Mod: model.Mod{
+				Div: 3,
+				Rem: -1,
+			},
+		},
+	}
+	ids := map[string]string{}
+	for k, cond := range conds {
+		ids[k], err = s.Create(ctx, "interest1", cond)
+		require.Nil(t, err)
+	}
+	_, err = s.Create(ctx, "interest1", model.Condition{Key: "id", Op: model.OpMod})
+	assert.ErrorIs(t, err, model.ErrInvalidMod)
+	//
+	cases := map[string]struct {
+		attr     model.Attr
+		expected []string
+	}{
+		"float": {
+			attr: model.Attr{
+				Key: "id",
+				Val: 3000,
+			},
+			expected: []string{
+				"even",
+				"every 1000th",
+			},
+		},
+		"int": {
+			attr: model.Attr{
+				Key: "id",
+				Int: ptr(int64(9007199254740993)),
+			},
+			expected: []string{
+				"odd",
+			},
+		},
+		"negative": {
+			attr: model.Attr{
+				Key: "id",
+				Val: -7,
+			},
+			// the remainder has the sign of the value
+			expected: []string{
+				"negative",
+			},
+		},
+		"fraction": {
+			attr: model.Attr{
+				Key: "id",
+				Val: 2.5,
+			},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			var expected []string
+			for _, condKey := range c.expected {
+				expected = append(expected, ids[condKey])
+			}
+			actual, _, err := s.SearchPage(ctx, c.attr, 10, "")
+			require.Nil(t, err)
+			assert.ElementsMatch(t, expected, actual)
+		})
+	}
+}
+
+func TestStorageImpl_SearchPage_CyclicRange(t *testing.T) {
+	//
+	collName := fmt.Sprintf("conditions-number-test-%d", time.Now().UnixMicro())
+	dbCfg := config.DbConfig{
+		Uri:  dbUri,
+		Name: "conditions-number",
+	}
+	dbCfg.Table.Name = collName
+	dbCfg.Tls.Enabled = true
+	dbCfg.Tls.Insecure = true
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+	s, err := NewStorage(ctx, dbCfg, time.Now)
+	require.Nil(t, err)
+	defer clear(ctx, t, s.(storageImpl))
+	//
+	conds := map[string]model.Condition{
+		"night": {
+			Key: "hour",
+			Op:  model.OpCyclicRange,
+			Range: model.Range{
+				Min:          22,
+				MinInclusive: true,
+				Max:          6,
+			},
+			Period: 24,
+		},
+		"day": {
+			Key: "hour",
+			Op:  model.OpCyclicRange,
+			Range: model.Range{
+				Min:          6,
+				MinInclusive: true,
+				Max:          22,
+			},
+			Period: 24,
+		},
+		"weekend": {
+			// the same key to check the conditions having different periods
+			Key: "hour",
+			Op:  model.OpCyclicRange,
+			Range: model.Range{
+				Min:          -2,
+				MinInclusive: true,
+				Max:          0,
+				MaxInclusive: true,
+			},
+			Period: 7,
+		},
+		"all day": {
+			// the whole period excluding the end being the same as the start
+			Key: "hour",
+			Op:  model.OpCyclicRange,
+			Range: model.Range{
+				Min:          0,
+				MinInclusive: true,
+				Max:          24,
+			},
+			Period: 24,
+		},
+		"all day since 6": {
+			Key: "hour",
+			Op:  model.OpCyclicRange,
+			Range: model.Range{
+				Min:          6,
+				MinInclusive: true,
+				Max:          30,
+			},
+			Period: 24,
+		},
+	}
+	ids := map[string]string{}
+	for k, cond := range conds {
+		ids[k], err = s.Create(ctx, "interest1", cond)
+		require.Nil(t, err)
+	}
+	_, err = s.Create(ctx, "interest1", model.Condition{Key: "hour", Op: model.OpCyclicRange, Range: model.Range{Max: 1}})
+	assert.ErrorIs(t, err, model.ErrInvalidPeriod)
+	//
+	cases := map[string]struct {
+		val      float64
+		expected []string
+	}{
+		"midnight": {
+			val: 0,
+			expected: []string{
+				"all day since 6",
+				"night",
+				"weekend",
+			},
+		},
+		"night end": {
+			val: 6,
+			expected: []string{
+				"all day",
+				"day",
+				"weekend",
+			},
+		},
+		"late": {
+			val: 23.5,
+			expected: []string{
+				"all day",
+				"all day since 6",
+				"night",
+			},
+		},
+		"negative": {
+			val: -1,
+			expected: []string{
+				"all day",
+				"all day since 6",
+				"night",
+				"weekend",
+			},
+		},
+		"next day noon": {
+			val: 36,
+			expected: []string{
+				"all day",
+				"all day since 6",
+				"day",
+			},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			var expected []string
+			for _, condKey := range c.expected {
+				expected = append(expected, ids[condKey])
+			}
+			actual, _, err := s.SearchPage(ctx, model.Attr{Key: "hour", Val: c.val}, 10, "")
+			require.Nil(t, err)
+			assert.ElementsMatch(t, expected, actual)
+		})
+	}
+}
+
+func TestStorageImpl_SearchPage_Matches(t *testing.T) {
+	//
+	collName := fmt.Sprintf("conditions-number-test-%d", time.Now().UnixMicro())
+	dbCfg := config.DbConfig{
+		Uri:  dbUri,
+		Name: "conditions-number",
+	}
+	dbCfg.Table.Name = collName
+	dbCfg.Tls.Enabled = true
+	dbCfg.Tls.Insecure = true
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+	s, err := NewStorage(ctx, dbCfg, time.Now)
+	require.Nil(t, err)
+	defer clear(ctx, t, s.(storageImpl))
+	//
+	keys := []string{"", "k0", "k1"}
+	keyPatterns := []model.Condition{
+		{
+			Key:      "k?",
+			KeyMatch: model.KeyMatchGlob,
+		},
+		{
+			Key:      "k",
+			KeyMatch: model.KeyMatchPrefix,
+		},
+	}
+	randVal := func(r *rand.Rand) float64 {
+		return float64(r.Intn(9)-4) / 2
+	}
+	r := rand.New(rand.NewSource(42))
+	conds := map[string]model.Condition{}
+	for i := 0; i < 200; i++ {
+		cond := model.Condition{
+			Key: keys[r.Intn(len(keys))],
+			Op:  model.Op(1 + r.Intn(int(model.OpNotIn))),
+			Val: randVal(r),
+		}
+		if r.Intn(4) == 0 {
+			keyPattern := keyPatterns[r.Intn(len(keyPatterns))]
+			cond.Key = keyPattern.Key
+			cond.KeyMatch = keyPattern.KeyMatch
+		}
+		switch cond.Op {
+		case model.OpEq:
+			if r.Intn(2) == 0 {
+				cond.Tolerance.Abs = 0.5
+			}
+		case model.OpRange:
+			cond.Range = model.Range{
+				Min:          randVal(r),
+				MinInclusive: r.Intn(2) == 0,
+				Max:          randVal(r),
+				MaxInclusive: r.Intn(2) == 0,
+			}
+		case model.OpIn, model.OpNotIn:
+			cond.Vals = []float64{randVal(r), randVal(r)}
+		}
+		var id string
+		id, err = s.Create(ctx, "interest1", cond)
+		require.Nil(t, err)
+		conds[id] = cond
+	}
+	//
+	for _, k := range keys[1:] {
+		for v := -2.5; v <= 2.5; v += 0.25 {
+			t.Run(fmt.Sprintf("%s = %f", k, v), func(t *testing.T) {
+				var expected []string
+				for id, cond := range conds {
+					if cond.Matches(k, v) {
+						expected = append(expected, id)
+					}
+				}
+				var ids []string
+				ids, _, err = s.SearchPage(ctx, model.Attr{Key: k, Val: v}, uint32(len(conds)), "")
+				assert.Nil(t, err)
+				assert.ElementsMatch(t, expected, ids)
+			})
+		}
+	}
+}
+
+func TestStorageImpl_SearchPage_Not(t *testing.T) {
+	//
+	collName := fmt.Sprintf("conditions-number-test-%d", time.Now().UnixMicro())
+	dbCfg := config.DbConfig{
+		Uri:  dbUri,
+		Name: "conditions-number",
+	}
+	dbCfg.Table.Name = collName
+	dbCfg.Tls.Enabled = true
+	dbCfg.Tls.Insecure = true
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+	s, err := NewStorage(ctx, dbCfg, time.Now)
+	require.Nil(t, err)
+	defer clear(ctx, t, s.(storageImpl))
+	//
+	conds := map[string]model.Condition{
+		"gt": {
+			Key: "x",
+			Op:  model.OpGt,
+			Val: 5,
+		},
+		"not gt": {
+			Key: "x",
+			Op:  model.OpGt,
+			Val: 5,
+			Not: true,
+		},
+		"not any key eq": {
+			Op:  model.OpEq,
+			Val: 0,
+			Not: true,
+		},
+		"not bits": {
+			Key: "x",
+			Op:  model.OpBitsAnySet,
+			Int: ptr(int64(1)),
+			Not: true,
+		},
+		"not terms": {
+			Op: model.OpLt,
+			Terms: []model.Term{
+				{
+					Key:  "a",
+					Coef: 1,
+				},
+				{
+					Key:  "b",
+					Coef: -1,
+				},
+			},
+			Not: true,
+		},
+	}
+	ids := map[string]string{}
+	for k, cond := range conds {
+		ids[k], err = s.Create(ctx, "interest1", cond)
+		require.Nil(t, err)
+	}
+	_, err = s.Create(ctx, "interest1", model.Condition{Key: "x", Op: model.OpCrossAbove, Val: 5, Not: true})
+	assert.ErrorIs(t, err, model.ErrInvalidNot)
+	//
+	cases := map[string]struct {
+		attr     model.Attr
+		attrs    map[string]float64
+		expected []string
+	}{
+		"above": {
+			attr: model.Attr{
+				Key: "x",
+				Val: 6,
+			},
+			expected: []string{
+				"gt",
+				"not any key eq",
+				"not bits",
+			},
+		},
+		"below": {
+			attr: model.Attr{
+				Key: "x",
+				Val: 1,
+			},
+			expected: []string{
+				"not gt",
+				"not any key eq",
+			},
+		},
+		"zero": {
+			attr: model.Attr{
+				Key: "y",
+			},
+		},
+		"fraction": {
+			attr: model.Attr{
+				Key: "x",
+				Val: 1.5,
+			},
+			expected: []string{
+				"not gt",
+				"not any key eq",
+				"not bits",
+			},
+		},
+		"multi absent": {
+			attrs: map[string]float64{
+				"a": 1,
+			},
+			expected: []string{
+				"not gt",
+				"not bits",
+				"not terms",
+			},
+		},
+		"multi present": {
+			attrs: map[string]float64{
+				"a": 1,
+				"b": 2,
+				"x": 3,
+			},
+		},
+		"multi not holding": {
+			attrs: map[string]float64{
+				"a": 2,
+				"b": 1,
+				"x": 3,
+			},
+			expected: []string{
+				"not terms",
+			},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			var expected []string
+			for _, condKey := range c.expected {
+				expected = append(expected, ids[condKey])
+			}
+			var actual []string
+			var err error
+			switch c.attrs {
+			case nil:
+				actual, _, err = s.SearchPage(ctx, c.attr, 10, "")
+			default:
+				actual, err = s.SearchMultiPage(ctx, c.attrs, 10, "")
+			}
+			require.Nil(t, err)
+			assert.ElementsMatch(t, expected, actual)
+		})
+	}
+}
+
+func TestStorageImpl_SearchMultiPage(t *testing.T) {
 	//
 	collName := fmt.Sprintf("conditions-number-test-%d", time.Now().UnixMicro())
 	dbCfg := config.DbConfig{
@@ -51,103 +1403,152 @@ func TestStorageImpl_SearchPage(t *testing.T) {
 	dbCfg.Table.Name = collName
 	dbCfg.Tls.Enabled = true
 	dbCfg.Tls.Insecure = true
-	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
 	defer cancel()
-	s, err := NewStorage(ctx, dbCfg)
+	s, err := NewStorage(ctx, dbCfg, time.Now)
 	require.Nil(t, err)
 	defer clear(ctx, t, s.(storageImpl))
 	//
-	cond0, err := s.Create(ctx, "interest1", "salary", model.OpGt, 2.7182818)
+	cond0, err := s.Create(ctx, "interest1", model.Condition{Op: model.OpLt, Terms: []model.Term{
+		{
+			Key:  "sale_price",
+			Coef: 1,
+		},
+		{
+			Key:  "list_price",
+			Coef: -1,
+		},
+	}})
 	require.Nil(t, err)
-	cond1, err := s.Create(ctx, "interest1", "salary", model.OpGte, 3.1415926)
+	cond1, err := s.Create(ctx, "interest1", model.Condition{Op: model.OpGt, Terms: []model.Term{
+		{
+			Key:  "used",
+			Coef: 1,
+		},
+		{
+			Key:  "reserved",
+			Coef: 1,
+		},
+		{
+			Key:  "quota",
+			Coef: -1,
+		},
+	}})
 	require.Nil(t, err)
-	cond2, err := s.Create(ctx, "interest1", "salary", model.OpEq, 3)
+	cond2, err := s.Create(ctx, "interest1", model.Condition{Op: model.OpEq, Terms: []model.Term{
+		{
+			Key:  "quota",
+			Coef: -1,
+		},
+		{
+			Key:  "used",
+			Coef: 1,
+		},
+		{
+			Key:  "reserved",
+			Coef: 1,
+		},
+	}})
 	require.Nil(t, err)
-	cond4, err := s.Create(ctx, "interest1", "price", model.OpLte, 123)
+	cond3, err := s.Create(ctx, "interest1", model.Condition{Op: model.OpGt})
 	require.Nil(t, err)
-	cond5, err := s.Create(ctx, "interest1", "price", model.OpLt, 123)
+	cond4, err := s.Create(ctx, "interest1", model.Condition{Op: model.OpGt, Int: ptr(int64(1000)), Terms: []model.Term{
+		{
+			Key:  "bytes_in",
+			Coef: 1,
+		},
+		{
+			Key:  "bytes_out",
+			Coef: 1,
+		},
+	}})
 	require.Nil(t, err)
 	//
 	cases := map[string]struct {
-		key    string
-		val    float64
-		limit  uint32
-		cursor string
-		ids    []string
-		err    error
+		attrs map[string]float64
+		ids   []string
 	}{
-		"salary = 3": {
-			key:   "salary",
-			val:   3,
-			limit: 10,
-			ids: []string{
-				cond0,
-				cond2,
+		"integer threshold exceeded": {
+			attrs: map[string]float64{
+				"bytes_in":  600,
+				"bytes_out": 500,
 			},
-		},
-		"salary = 3.1415926": {
-			key:   "salary",
-			val:   3.1415926,
-			limit: 10,
 			ids: []string{
-				cond0,
-				cond1,
+				cond4,
 			},
 		},
-		"salary = 2": {
-			key:   "salary",
-			val:   2,
-			limit: 10,
-			ids:   []string{},
+		"integer threshold not exceeded": {
+			attrs: map[string]float64{
+				"bytes_in":  100,
+				"bytes_out": 100,
+			},
+			ids: []string{},
 		},
-		"salary = 2.8": {
-			key:   "salary",
-			val:   2.8,
-			limit: 10,
+		"sale price below list price": {
+			attrs: map[string]float64{
+				"sale_price": 90,
+				"list_price": 100,
+			},
 			ids: []string{
 				cond0,
 			},
 		},
-		"SourceId = 1000": {
-			key:   "SourceId",
-			val:   1000,
-			limit: 10,
-			ids:   []string{},
+		"over quota": {
+			attrs: map[string]float64{
+				"used":     70,
+				"reserved": 40,
+				"quota":    100,
+			},
+			ids: []string{
+				cond1,
+			},
 		},
-		"price = 122.99": {
-			key:   "price",
-			val:   122.99,
-			limit: 10,
+		"exactly quota": {
+			attrs: map[string]float64{
+				"used":     60,
+				"reserved": 40,
+				"quota":    100,
+			},
 			ids: []string{
-				cond4,
-				cond5,
+				cond2,
 			},
 		},
-		"price = 123.00": {
-			key:   "price",
-			val:   123.0,
-			limit: 10,
+		"all": {
+			attrs: map[string]float64{
+				"sale_price": 90,
+				"list_price": 100,
+				"used":       70,
+				"reserved":   40,
+				"quota":      100,
+			},
 			ids: []string{
-				cond4,
+				cond0,
+				cond1,
 			},
 		},
-		"price = 123.99": {
-			key:   "price",
-			val:   123.99,
-			limit: 10,
-			ids:   []string{},
+		"missing attribute": {
+			attrs: map[string]float64{
+				"sale_price": 90,
+			},
+			ids: []string{},
+		},
+		"empty": {
+			ids: []string{},
 		},
 	}
 	//
 	for k, c := range cases {
 		t.Run(k, func(t *testing.T) {
 			var ids []string
-			ids, err = s.SearchPage(ctx, c.key, c.val, c.limit, c.cursor)
-			assert.Equal(t, len(c.ids), len(ids))
-			assert.ErrorIs(t, err, c.err)
+			ids, err = s.SearchMultiPage(ctx, c.attrs, 10, "")
+			assert.Nil(t, err)
 			assert.ElementsMatch(t, c.ids, ids)
 		})
 	}
+	//
+	ids, _, err := s.SearchPage(ctx, model.Attr{Key: "used", Val: 70}, 10, "")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{cond3}, ids)
 }
 
 func TestStorageImpl_Create(t *testing.T) {
@@ -162,20 +1563,27 @@ func TestStorageImpl_Create(t *testing.T) {
 	dbCfg.Tls.Insecure = true
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
 	defer cancel()
-	s, err := NewStorage(ctx, dbCfg)
+	s, err := NewStorage(ctx, dbCfg, time.Now)
 	require.Nil(t, err)
 	defer clear(ctx, t, s.(storageImpl))
 	//
 	var existingId string
-	existingId, err = s.Create(ctx, "interest1", "price", model.OpEq, 42)
+	existingId, err = s.Create(ctx, "interest1", model.Condition{Key: "price", Op: model.OpEq, Val: 42})
 	require.Nil(t, err)
 	//
 	cases := map[string]struct {
-		key string
-		op  model.Op
-		val float64
-		dup bool
-		err error
+		key      string
+		keyMatch model.KeyMatch
+		op       model.Op
+		val      float64
+		rng      model.Range
+		set      []float64
+		tol      model.Tolerance
+		terms    []model.Term
+		unit     string
+		relative bool
+		dup      bool
+		err      error
 	}{
 		"different key": {
 			key: "",
@@ -187,6 +1595,84 @@ func TestStorageImpl_Create(t *testing.T) {
 			op:  model.OpLt,
 			val: 42,
 		},
+		"different op ne": {
+			key: "price",
+			op:  model.OpNe,
+			val: 42,
+		},
+		"range": {
+			key: "price",
+			op:  model.OpRange,
+			rng: model.Range{
+				Min: 42,
+				Max: 43,
+			},
+		},
+		"range with different inclusion": {
+			key: "price",
+			op:  model.OpRange,
+			rng: model.Range{
+				Min:          42,
+				MinInclusive: true,
+				Max:          43,
+			},
+		},
+		"tolerant equality": {
+			key: "price",
+			op:  model.OpEq,
+			val: 42,
+			tol: model.Tolerance{
+				Rel: 0.01,
+			},
+		},
+		"in": {
+			key: "price",
+			op:  model.OpIn,
+			set: []float64{
+				42, 43,
+			},
+		},
+		"not in": {
+			key: "price",
+			op:  model.OpNotIn,
+			set: []float64{
+				42, 43,
+			},
+		},
+		"glob key": {
+			key:      "price.*",
+			keyMatch: model.KeyMatchGlob,
+			op:       model.OpEq,
+			val:      42,
+		},
+		"prefix key": {
+			key:      "price",
+			keyMatch: model.KeyMatchPrefix,
+			op:       model.OpEq,
+			val:      42,
+		},
+		"cross-attribute": {
+			op:  model.OpGt,
+			val: 42,
+			terms: []model.Term{
+				{
+					Key:  "price",
+					Coef: 1,
+				},
+			},
+		},
+		"with unit": {
+			key:  "price",
+			op:   model.OpEq,
+			val:  42,
+			unit: "USD",
+		},
+		"relative": {
+			key:      "price",
+			op:       model.OpEq,
+			val:      42,
+			relative: true,
+		},
 		"different values": {
 			key: "",
 			op:  model.OpEq,
@@ -198,15 +1684,40 @@ func TestStorageImpl_Create(t *testing.T) {
 			val: 42,
 			dup: true,
 		},
+		"invalid bit mask": {
+			key: "flags",
+			op:  model.OpBitsAllSet,
+			val: -1,
+			err: model.ErrInvalidBitMask,
+		},
+		"invalid period": {
+			key: "hour",
+			op:  model.OpCyclicRange,
+			err: model.ErrInvalidPeriod,
+		},
 	}
 	//
 	for k, c := range cases {
 		t.Run(k, func(t *testing.T) {
 			var id string
-			id, err = s.Create(ctx, "interest1", c.key, c.op, c.val)
-			if c.dup {
+			id, err = s.Create(ctx, "interest1", model.Condition{
+				Key:       c.key,
+				KeyMatch:  c.keyMatch,
+				Op:        c.op,
+				Val:       c.val,
+				Range:     c.rng,
+				Vals:      c.set,
+				Tolerance: c.tol,
+				Terms:     c.terms,
+				Unit:      c.unit,
+				Relative:  c.relative,
+			})
+			switch {
+			case c.err != nil:
+				assert.Empty(t, id)
+			case c.dup:
 				assert.Equal(t, existingId, id)
-			} else {
+			default:
 				assert.NotEmpty(t, id)
 			}
 			assert.ErrorIs(t, err, c.err)
@@ -227,7 +1738,7 @@ func TestStorageImpl_LockCreate(t *testing.T) {
 	dbCfg.Tls.Insecure = true
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
 	defer cancel()
-	s, err := NewStorage(ctx, dbCfg)
+	s, err := NewStorage(ctx, dbCfg, time.Now)
 	require.Nil(t, err)
 	defer clear(ctx, t, s.(storageImpl))
 	//
@@ -246,13 +1757,13 @@ func TestStorageImpl_LockCreate(t *testing.T) {
 	for k, c := range cases {
 		t.Run(k, func(t *testing.T) {
 			var existingId string
-			existingId, err = s.Create(ctx, "interest1", "key0", model.OpEq, 42)
+			existingId, err = s.Create(ctx, "interest1", model.Condition{Key: "key0", Op: model.OpEq, Val: 42})
 			require.Nil(t, err)
 			err = s.LockCreate(ctx, existingId) // locks for 1 seconds
 			require.Nil(t, err)
 			time.Sleep(c.delay)
 			var id string
-			id, err = s.Create(ctx, "interest1", "key0", model.OpEq, 42)
+			id, err = s.Create(ctx, "interest1", model.Condition{Key: "key0", Op: model.OpEq, Val: 42})
 			if c.err == nil {
 				assert.Equal(t, existingId, id)
 			}
@@ -274,7 +1785,7 @@ func TestStorageImpl_LockCreate_Missing(t *testing.T) {
 	dbCfg.Tls.Insecure = true
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
 	defer cancel()
-	s, err := NewStorage(ctx, dbCfg)
+	s, err := NewStorage(ctx, dbCfg, time.Now)
 	require.Nil(t, err)
 	defer clear(ctx, t, s.(storageImpl))
 	//
@@ -282,6 +1793,33 @@ func TestStorageImpl_LockCreate_Missing(t *testing.T) {
 	assert.ErrorIs(t, err, storage.ErrNotFound)
 }
 
+func TestStorageImpl_InvalidId(t *testing.T) {
+	//
+	collName := fmt.Sprintf("conditions-number-test-%d", time.Now().UnixMicro())
+	dbCfg := config.DbConfig{
+		Uri:  dbUri,
+		Name: "conditions-number",
+	}
+	dbCfg.Table.Name = collName
+	dbCfg.Tls.Enabled = true
+	dbCfg.Tls.Insecure = true
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+	s, err := NewStorage(ctx, dbCfg, time.Now)
+	require.Nil(t, err)
+	defer clear(ctx, t, s.(storageImpl))
+	//
+	var errInvalid storage.InvalidError
+	err = s.LockCreate(ctx, "cond0")
+	assert.ErrorAs(t, err, &errInvalid)
+	assert.Equal(t, "id", errInvalid.Field)
+	err = s.Delete(ctx, "interest1", "cond0")
+	assert.ErrorIs(t, err, storage.ErrInvalid)
+	_, _, err = s.SearchPage(ctx, model.Attr{Key: "x"}, 10, "cond0")
+	assert.ErrorAs(t, err, &errInvalid)
+	assert.Equal(t, "cursor", errInvalid.Field)
+}
+
 func TestStorageImpl_UnlockCreate(t *testing.T) {
 	//
 	collName := fmt.Sprintf("conditions-number-test-%d", time.Now().UnixMicro())
@@ -295,37 +1833,37 @@ func TestStorageImpl_UnlockCreate(t *testing.T) {
 	dbCfg.Tls.Insecure = true
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
 	defer cancel()
-	s, err := NewStorage(ctx, dbCfg)
+	s, err := NewStorage(ctx, dbCfg, time.Now)
 	require.Nil(t, err)
 	defer clear(ctx, t, s.(storageImpl))
 	//
 	var existingId string
-	existingId, err = s.Create(ctx, "interest1", "foo", model.OpEq, 3.1415926)
+	existingId, err = s.Create(ctx, "interest1", model.Condition{Key: "foo", Op: model.OpEq, Val: 3.1415926})
 	require.Nil(t, err)
 	//
 	err = s.LockCreate(ctx, existingId) // locks for 1 minute, lock count -> 1
 	require.Nil(t, err)
 	//
-	_, err = s.Create(ctx, "interest1", "foo", model.OpEq, 3.1415926)
+	_, err = s.Create(ctx, "interest1", model.Condition{Key: "foo", Op: model.OpEq, Val: 3.1415926})
 	assert.ErrorIs(t, err, storage.ErrConflict)
 	//
 	err = s.LockCreate(ctx, existingId) // locks for 1 minute, lock count -> 2
 	require.Nil(t, err)
 	//
-	_, err = s.Create(ctx, "interest1", "foo", model.OpEq, 3.1415926)
+	_, err = s.Create(ctx, "interest1", model.Condition{Key: "foo", Op: model.OpEq, Val: 3.1415926})
 	assert.ErrorIs(t, err, storage.ErrConflict)
 	//
 	err = s.UnlockCreate(ctx, existingId) // unlocks, lock count -> 1
 	require.Nil(t, err)
 	//
-	_, err = s.Create(ctx, "interest1", "foo", model.OpEq, 3.1415926)
+	_, err = s.Create(ctx, "interest1", model.Condition{Key: "foo", Op: model.OpEq, Val: 3.1415926})
 	assert.ErrorIs(t, err, storage.ErrConflict)
 	//
 	err = s.UnlockCreate(ctx, existingId) // unlocks, lock count -> 0
 	require.Nil(t, err)
 	//
 	var id string
-	id, err = s.Create(ctx, "interest1", "foo", model.OpEq, 3.1415926)
+	id, err = s.Create(ctx, "interest1", model.Condition{Key: "foo", Op: model.OpEq, Val: 3.1415926})
 	assert.Nil(t, err)
 	assert.Equal(t, existingId, id)
 }
@@ -342,11 +1880,11 @@ func TestStorageImpl_Delete(t *testing.T) {
 	dbCfg.Tls.Insecure = true
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
 	defer cancel()
-	s, err := NewStorage(ctx, dbCfg)
+	s, err := NewStorage(ctx, dbCfg, time.Now)
 	require.Nil(t, err)
 	defer clear(ctx, t, s.(storageImpl))
 	//
-	id, err := s.Create(ctx, "interest1", "key0", model.OpEq, 3.1415926)
+	id, err := s.Create(ctx, "interest1", model.Condition{Key: "key0", Op: model.OpEq, Val: 3.1415926})
 	require.Nil(t, err)
 	//
 	cases := map[string]struct {
@@ -363,8 +1901,173 @@ func TestStorageImpl_Delete(t *testing.T) {
 	//
 	for k, c := range cases {
 		t.Run(k, func(t *testing.T) {
-			err = s.Delete(ctx, "interes1", c.id)
+			err = s.Delete(ctx, "interest1", c.id)
 			assert.ErrorIs(t, err, c.err)
 		})
 	}
 }
+
+func TestStorageImpl_Delete_Shared(t *testing.T) {
+	//
+	collName := fmt.Sprintf("conditions-number-test-%d", time.Now().UnixMicro())
+	dbCfg := config.DbConfig{
+		Uri:  dbUri,
+		Name: "conditions-number",
+	}
+	dbCfg.Table.Name = collName
+	dbCfg.Tls.Enabled = true
+	dbCfg.Tls.Insecure = true
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+	s, err := NewStorage(ctx, dbCfg, time.Now)
+	require.Nil(t, err)
+	defer clear(ctx, t, s.(storageImpl))
+	//
+	cond := model.Condition{Key: "price", Op: model.OpGt, Val: 10}
+	id1, err := s.Create(ctx, "interest1", cond)
+	require.Nil(t, err)
+	id2, err := s.Create(ctx, "interest2", cond)
+	require.Nil(t, err)
+	require.Equal(t, id1, id2)
+	_, err = s.Create(ctx, "interest2", cond)
+	require.Nil(t, err)
+	//
+	search := func() []string {
+		ids, _, err := s.SearchPage(ctx, model.Attr{Key: "price", Val: 11}, 10, "")
+		require.Nil(t, err)
+		return ids
+	}
+	require.Nil(t, s.Delete(ctx, "interest1", id1))
+	assert.Equal(t, []string{id1}, search())
+	require.Nil(t, s.Delete(ctx, "interest3", id1))
+	assert.Equal(t, []string{id1}, search())
+	require.Nil(t, s.Delete(ctx, "interest2", id1))
+	assert.Empty(t, search())
+}
+
+func TestStorageImpl_Delete_Legacy(t *testing.T) {
+	//
+	collName := fmt.Sprintf("conditions-number-test-%d", time.Now().UnixMicro())
+	dbCfg := config.DbConfig{
+		Uri:  dbUri,
+		Name: "conditions-number",
+	}
+	dbCfg.Table.Name = collName
+	dbCfg.Tls.Enabled = true
+	dbCfg.Tls.Insecure = true
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+	s, err := NewStorage(ctx, dbCfg, time.Now)
+	require.Nil(t, err)
+	defer clear(ctx, t, s.(storageImpl))
+	// the condition created before the references tracking has no references
+	cond := model.Condition{Key: "price", Op: model.OpGt, Val: 10}
+	rec, err := encodeCondition(cond)
+	require.Nil(t, err)
+	result, err := s.(storageImpl).coll.InsertOne(ctx, rec)
+	require.Nil(t, err)
+	id := result.InsertedID.(primitive.ObjectID).Hex()
+	//
+	require.Nil(t, s.Delete(ctx, "interest1", id))
+	ids, _, err := s.SearchPage(ctx, model.Attr{Key: "price", Val: 11}, 10, "")
+	require.Nil(t, err)
+	assert.Empty(t, ids)
+}
+
+func TestStorageImpl_NormalizeKeys(t *testing.T) {
+	//
+	collName := fmt.Sprintf("conditions-number-test-%d", time.Now().UnixMicro())
+	dbCfg := config.DbConfig{
+		Uri:  dbUri,
+		Name: "conditions-number",
+	}
+	dbCfg.Table.Name = collName
+	dbCfg.Tls.Enabled = true
+	dbCfg.Tls.Insecure = true
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+	s, err := NewStorage(ctx, dbCfg, time.Now)
+	require.Nil(t, err)
+	defer clear(ctx, t, s.(storageImpl))
+	//
+	conds := []model.Condition{
+		{
+			Key: "Price ",
+			Op:  model.OpGt,
+			Val: 1,
+		},
+		{
+			Key: "price",
+			Op:  model.OpLt,
+			Val: 1,
+		},
+		{
+			Key: "PRICE",
+			Op:  model.OpLt,
+			Val: 1,
+		},
+		{
+			Key:      "Item.*",
+			KeyMatch: model.KeyMatchGlob,
+			Op:       model.OpGt,
+			Val:      1,
+		},
+		{
+			Terms: []model.Term{
+				{
+					Key:  "Sale Price",
+					Coef: 1,
+				},
+				{
+					Key:  "List Price",
+					Coef: -1,
+				},
+			},
+			Op: model.OpLt,
+		},
+	}
+	var ids []string
+	for _, cond := range conds {
+		var id string
+		id, err = s.Create(ctx, "interest0", cond)
+		require.Nil(t, err)
+		ids = append(ids, id)
+	}
+	change, err := s.Create(ctx, "interest0", model.Condition{Key: "Rate", Op: model.OpChange, Val: 5})
+	require.Nil(t, err)
+	_, _, err = s.SearchPage(ctx, model.Attr{Key: "Rate", Val: 100}, 10, "")
+	require.Nil(t, err)
+	//
+	norm := model.KeyNorm{
+		Trim: true,
+		Fold: true,
+		Sep:  "_",
+	}
+	updated, conflicts, err := s.(storage.KeyMigration).NormalizeKeys(ctx, norm)
+	require.Nil(t, err)
+	assert.Equal(t, int64(4), updated)
+	assert.Equal(t, []string{ids[2]}, conflicts)
+	//
+	updated, conflicts, err = s.(storage.KeyMigration).NormalizeKeys(ctx, norm)
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), updated)
+	assert.Equal(t, []string{ids[2]}, conflicts)
+	// the previous value is observed with the not normalized key
+	ids, _, err = s.SearchPage(ctx, model.Attr{Key: "rate", Val: 110}, 10, "")
+	require.Nil(t, err)
+	assert.Equal(t, []string{change}, ids)
+	//
+	ids, _, err = s.SearchPage(ctx, model.Attr{Key: "price", Val: 2}, 10, "")
+	require.Nil(t, err)
+	assert.Len(t, ids, 1)
+	ids, _, err = s.SearchPage(ctx, model.Attr{Key: "item.count", Val: 2}, 10, "")
+	require.Nil(t, err)
+	assert.Len(t, ids, 1)
+	ids, err = s.SearchMultiPage(ctx, map[string]float64{"sale_price": 1, "list_price": 2}, 10, "")
+	require.Nil(t, err)
+	assert.Len(t, ids, 1)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,474 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/awakari/conditions-number/config"
+	"github.com/awakari/conditions-number/model"
+	"github.com/awakari/conditions-number/storage"
+	"github.com/awakari/conditions-number/storage/memory"
+	_ "modernc.org/sqlite"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type storageImpl struct {
+	db             *sql.DB
+	table          string
+	tableTerms     string
+	tableInterests string
+	createLockTtl  time.Duration
+	clock          model.Clock
+	state          storage.State
+	stats          storage.Stats
+}
+
+const driverName = "sqlite"
+
+// the pragmas are applied to every connection: the readers don't block the writer and the writers wait for each other
+const dsnPragmas = "?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)"
+
+const tableTermsSuffix = "-terms"
+
+const tableInterestsSuffix = "-interests"
+
+// schema is the list of the statements creating the tables, the format arguments are the quoted conditions and terms
+// table names, the quoted index names and the quoted interests table name.
+// The conditions table identity column is unique the same as the database storage unique index, see storage.Identity.
+// The spec column is the rest of the canonical condition, see storage.CanonicalCondition.
+// The val_min and val_max columns are the bounds of the values the condition may hold for, see
+// model.Condition.ValBounds, null means no bound.
+// The terms table is the cross-attribute conditions by every term key.
+// The interests table is the references of the interests to the conditions.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS %[1]s (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		key TEXT NOT NULL,
+		op INTEGER NOT NULL,
+		val REAL NOT NULL,
+		spec TEXT NOT NULL,
+		identity TEXT NOT NULL UNIQUE,
+		key_match INTEGER NOT NULL,
+		key_prefix TEXT NOT NULL,
+		unit TEXT NOT NULL,
+		terms INTEGER NOT NULL,
+		negated INTEGER NOT NULL,
+		val_min REAL,
+		val_max REAL,
+		create_lock_time INTEGER,
+		create_lock_count INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS %[3]s ON %[1]s (key, unit, val_min, val_max)`,
+	`CREATE INDEX IF NOT EXISTS %[4]s ON %[1]s (key_prefix) WHERE key_match <> 0`,
+	`CREATE INDEX IF NOT EXISTS %[5]s ON %[1]s (key) WHERE negated <> 0`,
+	`CREATE TABLE IF NOT EXISTS %[2]s (
+		key TEXT NOT NULL,
+		cond_id INTEGER NOT NULL,
+		PRIMARY KEY (key, cond_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS %[6]s (
+		cond_id INTEGER NOT NULL,
+		interest_id TEXT NOT NULL,
+		PRIMARY KEY (cond_id, interest_id)
+	)`,
+}
+
+// NewStorage opens the database file at the configured path creating the tables if missing.
+// The stateful conditions state is kept in memory. The clock defines the current time for the relative-time conditions
+// search.
+func NewStorage(ctx context.Context, cfgDb config.DbConfig, clock model.Clock) (s storage.Storage, err error) {
+	var db *sql.DB
+	db, err = sql.Open(driverName, "file:"+cfgDb.Path+dsnPragmas)
+	stor := storageImpl{
+		db:             db,
+		table:          quoteIdent(cfgDb.Table.Name),
+		tableTerms:     quoteIdent(cfgDb.Table.Name + tableTermsSuffix),
+		tableInterests: quoteIdent(cfgDb.Table.Name + tableInterestsSuffix),
+		createLockTtl:  cfgDb.Table.LockTtl.Create,
+		clock:          clock,
+		state:          memory.NewState(cfgDb.Table.State.Limit),
+		stats:          memory.NewStats(cfgDb.Table.State.Limit),
+	}
+	for i := 0; err == nil && i < len(schema); i++ {
+		q := fmt.Sprintf(
+			schema[i],
+			stor.table,
+			stor.tableTerms,
+			quoteIdent(cfgDb.Table.Name+"-key-val"),
+			quoteIdent(cfgDb.Table.Name+"-key-prefix"),
+			quoteIdent(cfgDb.Table.Name+"-negated"),
+			stor.tableInterests,
+		)
+		_, err = db.ExecContext(ctx, q)
+	}
+	switch err {
+	case nil:
+		s = stor
+	default:
+		err = decodeError(err)
+		if db != nil {
+			_ = db.Close()
+		}
+	}
+	return
+}
+
+func (s storageImpl) Close() error {
+	return s.db.Close()
+}
+
+func (s storageImpl) Create(ctx context.Context, interestId string, cond model.Condition) (id string, err error) {
+	cond, err = storage.CanonicalCondition(cond)
+	var spec, identity []byte
+	if err == nil {
+		spec, err = encodeSpec(cond)
+	}
+	if err == nil {
+		identity, err = encodeIdentity(cond)
+	}
+	if err == nil {
+		err = s.inTx(ctx, func(tx *sql.Tx) (err error) {
+			valMin, valMax := cond.ValBounds()
+			// the existing condition is updated to return its id unless locked for creation
+			q := fmt.Sprintf(
+				`INSERT INTO %s (key, op, val, spec, identity, key_match, key_prefix, unit, terms, negated, val_min, val_max)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT (identity) DO UPDATE SET create_lock_count = create_lock_count
+				WHERE create_lock_time IS NULL OR create_lock_count < 1 OR create_lock_time < ?
+				RETURNING id`,
+				s.table,
+			)
+			maxLockTime := time.Now().UTC().Add(-s.createLockTtl)
+			var rowId int64
+			err = tx.
+				QueryRowContext(
+					ctx, q,
+					cond.Key, cond.Op, cond.Val, string(spec), string(identity), cond.KeyMatch, cond.KeyLiteralPrefix(), cond.Unit,
+					len(cond.Terms) > 0, cond.Not, valMin, valMax, maxLockTime.UnixNano(),
+				).
+				Scan(&rowId)
+			if errors.Is(err, sql.ErrNoRows) {
+				err = fmt.Errorf("%w: condition %s is locked for creation", storage.ErrConflict, cond)
+			}
+			for i := 0; err == nil && i < len(cond.Terms); i++ {
+				q = fmt.Sprintf(`INSERT OR IGNORE INTO %s (key, cond_id) VALUES (?, ?)`, s.tableTerms)
+				_, err = tx.ExecContext(ctx, q, cond.Terms[i].Key, rowId)
+			}
+			if err == nil {
+				q = fmt.Sprintf(`INSERT OR IGNORE INTO %s (cond_id, interest_id) VALUES (?, ?)`, s.tableInterests)
+				_, err = tx.ExecContext(ctx, q, rowId, interestId)
+			}
+			if err == nil {
+				id = encodeId(rowId)
+			}
+			return
+		})
+	}
+	return
+}
+
+func (s storageImpl) LockCreate(ctx context.Context, id string) (err error) {
+	var rowId int64
+	rowId, err = decodeId("id", id)
+	var result sql.Result
+	if err == nil {
+		q := fmt.Sprintf(
+			`UPDATE %s SET create_lock_time = ?, create_lock_count = create_lock_count + 1 WHERE id = ?`,
+			s.table,
+		)
+		result, err = s.db.ExecContext(ctx, q, time.Now().UTC().UnixNano(), rowId)
+	}
+	var n int64
+	if err == nil {
+		n, err = result.RowsAffected()
+	}
+	err = decodeError(err)
+	if err == nil && n < 1 {
+		err = fmt.Errorf("%w: id=%s", storage.ErrNotFound, id)
+	}
+	return
+}
+
+func (s storageImpl) UnlockCreate(ctx context.Context, id string) (err error) {
+	var rowId int64
+	rowId, err = decodeId("id", id)
+	if err == nil {
+		// decrement if > 0, otherwise just skip
+		q := fmt.Sprintf(
+			`UPDATE %s SET create_lock_count = create_lock_count - 1 WHERE id = ? AND create_lock_count > 0`,
+			s.table,
+		)
+		_, err = s.db.ExecContext(ctx, q, rowId)
+		err = decodeError(err)
+	}
+	return
+}
+
+// Delete removes the interest reference and deletes the condition if no references remain within the same transaction.
+func (s storageImpl) Delete(ctx context.Context, interestId, id string) (err error) {
+	var rowId int64
+	rowId, err = decodeId("id", id)
+	var deleted bool
+	if err == nil {
+		err = s.inTx(ctx, func(tx *sql.Tx) (err error) {
+			q := fmt.Sprintf(`DELETE FROM %s WHERE cond_id = ? AND interest_id = ?`, s.tableInterests)
+			_, err = tx.ExecContext(ctx, q, rowId, interestId)
+			var result sql.Result
+			if err == nil {
+				q = fmt.Sprintf(
+					`DELETE FROM %s WHERE id = ? AND NOT EXISTS (SELECT 1 FROM %s WHERE cond_id = ?)`,
+					s.table, s.tableInterests,
+				)
+				result, err = tx.ExecContext(ctx, q, rowId, rowId)
+			}
+			var n int64
+			if err == nil {
+				n, err = result.RowsAffected()
+			}
+			deleted = n > 0
+			if err == nil && deleted {
+				_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE cond_id = ?`, s.tableTerms), rowId)
+			}
+			return
+		})
+	}
+	if err == nil && deleted {
+		err = s.state.Delete(ctx, id)
+	}
+	return
+}
+
+func (s storageImpl) SearchPage(ctx context.Context, attr model.Attr, limit uint32, cursor string) (ids []string, stats model.Stats, err error) {
+	var cursorRowId int64
+	cursorRowId, err = decodeCursor(cursor)
+	var change, anomaly bool
+	if err == nil {
+		change, anomaly, err = s.statefulOps(ctx, attr)
+	}
+	var am storage.AttrMatch
+	if err == nil {
+		am, err = storage.NewAttrMatch(ctx, s.state, s.stats, attr, cursor, s.clock(), change, anomaly)
+		stats = am.Stats()
+	}
+	if err == nil {
+		prefixes := model.KeyPrefixes(attr.Key)
+		q := fmt.Sprintf(
+			`SELECT id, key, op, val, spec FROM %s
+			WHERE id > ? AND terms = 0 AND unit = ?
+			AND (key_match = 0 AND key IN (?, '') OR key_match <> 0 AND key_prefix IN (%s))
+			AND (val_min IS NULL OR val_min <= ?) AND (val_max IS NULL OR val_max >= ?)
+			ORDER BY id`,
+			s.table, placeholders(len(prefixes)),
+		)
+		v := attr.Float64()
+		args := []any{cursorRowId, attr.Unit, attr.Key}
+		for _, p := range prefixes {
+			args = append(args, p)
+		}
+		args = append(args, v, v)
+		accept := func(ctx context.Context, id string, cond model.Condition) (bool, error) {
+			return am.Matches(ctx, id, cond)
+		}
+		ids, err = s.searchPage(ctx, limit, q, args, accept)
+	}
+	return
+}
+
+// statefulOps reports whether the change and the anomaly conditions exist for the attribute key and unit.
+func (s storageImpl) statefulOps(ctx context.Context, attr model.Attr) (change, anomaly bool, err error) {
+	prefixes := model.KeyPrefixes(attr.Key)
+	q := fmt.Sprintf(
+		`SELECT DISTINCT key, key_match, op FROM %s
+		WHERE terms = 0 AND unit = ? AND op IN (?, ?)
+		AND (key_match = 0 AND key IN (?, '') OR key_match <> 0 AND key_prefix IN (%s))`,
+		s.table, placeholders(len(prefixes)),
+	)
+	args := []any{attr.Unit, model.OpChange, model.OpAnomaly, attr.Key}
+	for _, p := range prefixes {
+		args = append(args, p)
+	}
+	var rows *sql.Rows
+	rows, err = s.db.QueryContext(ctx, q, args...)
+	if err == nil {
+		defer rows.Close()
+		for err == nil && rows.Next() {
+			var cond model.Condition
+			err = rows.Scan(&cond.Key, &cond.KeyMatch, &cond.Op)
+			switch {
+			case err != nil, !cond.MatchesKey(attr.Key):
+			case cond.Op == model.OpChange:
+				change = true
+			case cond.Op == model.OpAnomaly:
+				anomaly = true
+			}
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+	}
+	err = decodeError(err)
+	return
+}
+
+func (s storageImpl) SearchMultiPage(ctx context.Context, attrs map[string]float64, limit uint32, cursor string) (ids []string, err error) {
+	var cursorRowId int64
+	cursorRowId, err = decodeCursor(cursor)
+	if err == nil {
+		// the cross-attribute conditions referencing any of the keys and the negated exact key conditions of the
+		// absent keys
+		q := fmt.Sprintf(
+			`SELECT id, key, op, val, spec FROM %s
+			WHERE id > ? AND (
+				id IN (SELECT cond_id FROM %s WHERE key IN (%s))
+				OR terms = 0 AND key_match = 0 AND negated <> 0 AND key <> '' AND key NOT IN (%[3]s)
+			)
+			ORDER BY id`,
+			s.table, s.tableTerms, placeholders(len(attrs)),
+		)
+		args := []any{cursorRowId}
+		var keys []any
+		for k := range attrs {
+			keys = append(keys, k)
+		}
+		args = append(args, keys...)
+		args = append(args, keys...)
+		accept := func(ctx context.Context, id string, cond model.Condition) (ok bool, err error) {
+			ok = cond.MatchesAttrs(attrs)
+			return
+		}
+		ids, err = s.searchPage(ctx, limit, q, args, accept)
+	}
+	return
+}
+
+// searchPage returns up to the limit of the found conditions accepted by the accept function, the zero limit means no
+// limit.
+func (s storageImpl) searchPage(
+	ctx context.Context,
+	limit uint32,
+	q string,
+	args []any,
+	accept func(ctx context.Context, id string, cond model.Condition) (ok bool, err error),
+) (ids []string, err error) {
+	var rows *sql.Rows
+	rows, err = s.db.QueryContext(ctx, q, args...)
+	if err == nil {
+		defer rows.Close()
+		for (limit == 0 || len(ids) < int(limit)) && rows.Next() {
+			var rowId int64
+			var cond model.Condition
+			var spec string
+			err = rows.Scan(&rowId, &cond.Key, &cond.Op, &cond.Val, &spec)
+			if err == nil {
+				err = decodeSpec(spec, &cond)
+			}
+			id := encodeId(rowId)
+			var ok bool
+			if err == nil {
+				ok, err = accept(ctx, id, cond)
+			}
+			if err != nil {
+				break
+			}
+			if ok {
+				ids = append(ids, id)
+			}
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+	}
+	err = decodeError(err)
+	return
+}
+
+func (s storageImpl) inTx(ctx context.Context, f func(tx *sql.Tx) error) (err error) {
+	var tx *sql.Tx
+	tx, err = s.db.BeginTx(ctx, nil)
+	if err == nil {
+		err = f(tx)
+		switch err {
+		case nil:
+			err = tx.Commit()
+		default:
+			_ = tx.Rollback()
+		}
+	}
+	err = decodeError(err)
+	return
+}
+
+// encodeSpec returns the canonical condition except the key, the operation and the value having own columns.
+func encodeSpec(cond model.Condition) (spec []byte, err error) {
+	cond.Key, cond.Op, cond.Val = "", model.OpUndefined, 0
+	spec, err = json.Marshal(cond)
+	if err != nil {
+		err = fmt.Errorf("%w: %s", storage.ErrInvalid, err)
+	}
+	return
+}
+
+// encodeIdentity returns the canonical condition identity having the unused fields zero and the exact values in the
+// canonical form, so the same condition is created once.
+func encodeIdentity(cond model.Condition) (identity []byte, err error) {
+	identity, err = json.Marshal(storage.ConditionIdentity(cond))
+	if err != nil {
+		err = fmt.Errorf("%w: %s", storage.ErrInvalid, err)
+	}
+	return
+}
+
+func decodeSpec(spec string, cond *model.Condition) (err error) {
+	key, op, val := cond.Key, cond.Op, cond.Val
+	err = json.Unmarshal([]byte(spec), cond)
+	cond.Key, cond.Op, cond.Val = key, op, val
+	return
+}
+
+func encodeId(rowId int64) string {
+	return strconv.FormatInt(rowId, 10)
+}
+
+func decodeId(field, id string) (rowId int64, err error) {
+	rowId, err = strconv.ParseInt(id, 10, 64)
+	if err == nil && rowId < 1 {
+		err = fmt.Errorf("id %d should be positive", rowId)
+	}
+	if err != nil {
+		err = storage.InvalidError{
+			Field: field,
+			Err:   err,
+		}
+	}
+	return
+}
+
+func decodeCursor(cursor string) (rowId int64, err error) {
+	if cursor != "" {
+		rowId, err = decodeId("cursor", cursor)
+	}
+	return
+}
+
+func decodeError(src error) (dst error) {
+	switch {
+	case src == nil:
+	case errors.Is(src, storage.ErrInvalid), errors.Is(src, storage.ErrConflict):
+		dst = src
+	default:
+		dst = fmt.Errorf("%w: %s", storage.ErrInternal, src)
+	}
+	return
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,474 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/awakari/conditions-number/config"
+	"github.com/awakari/conditions-number/model"
+	"github.com/awakari/conditions-number/storage"
+	"github.com/awakari/conditions-number/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestStorage(t *testing.T, ttl time.Duration) storage.Storage {
+	cfgDb := config.DbConfig{
+		Path: filepath.Join(t.TempDir(), "test.sqlite"),
+	}
+	cfgDb.Table.Name = "conditions-number"
+	cfgDb.Table.LockTtl.Create = ttl
+	cfgDb.Table.State.Limit = 100
+	s, err := NewStorage(context.TODO(), cfgDb, time.Now)
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		assert.Nil(t, s.Close())
+	})
+	return s
+}
+
+func TestNewStorage_Reopen(t *testing.T) {
+	cfgDb := config.DbConfig{
+		Path: filepath.Join(t.TempDir(), "test.sqlite"),
+	}
+	cfgDb.Table.Name = "conditions-number"
+	ctx := context.TODO()
+	s, err := NewStorage(ctx, cfgDb, time.Now)
+	require.Nil(t, err)
+	id, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpGt, Val: 1})
+	require.Nil(t, err)
+	require.Nil(t, s.Close())
+	s, err = NewStorage(ctx, cfgDb, time.Now)
+	require.Nil(t, err)
+	defer s.Close()
+	ids, _, err := s.SearchPage(ctx, model.Attr{Key: "k0", Val: 2}, 10, "")
+	require.Nil(t, err)
+	assert.Equal(t, []string{id}, ids)
+}
+
+func TestStorageImpl_Create(t *testing.T) {
+	s := newTestStorage(t, time.Minute)
+	ctx := context.TODO()
+	id0, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpIn, Vals: []float64{2, 1, 2}})
+	require.Nil(t, err)
+	id1, err := s.Create(ctx, "interest1", model.Condition{Key: "k0", Op: model.OpIn, Vals: []float64{1, 2}})
+	require.Nil(t, err)
+	assert.Equal(t, id0, id1)
+	id2, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpIn, Vals: []float64{1, 3}})
+	require.Nil(t, err)
+	assert.NotEqual(t, id0, id2)
+	//
+	id3, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpGt, Val: 1})
+	require.Nil(t, err)
+	id4, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpGt, Val: 2})
+	require.Nil(t, err)
+	assert.NotEqual(t, id3, id4)
+	id5, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpGt, Int: ptr(int64(1))})
+	require.Nil(t, err)
+	assert.NotEqual(t, id3, id5)
+	id6, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpGt, Int: ptr(int64(1))})
+	require.Nil(t, err)
+	assert.Equal(t, id5, id6)
+	id9, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpGt, Dec: "1.50"})
+	require.Nil(t, err)
+	id10, err := s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpGt, Dec: "1.5"})
+	require.Nil(t, err)
+	assert.Equal(t, id9, id10)
+	//
+	id7, err := s.Create(ctx, "interest0", model.Condition{
+		Terms: []model.Term{{Key: "b", Coef: 1}, {Key: "a", Coef: -1}, {Key: "b", Coef: 1}},
+		Op:    model.OpGt,
+	})
+	require.Nil(t, err)
+	id8, err := s.Create(ctx, "interest1", model.Condition{
+		Terms: []model.Term{{Key: "a", Coef: -1}, {Key: "b", Coef: 2}},
+		Op:    model.OpGt,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, id7, id8)
+	//
+	_, err = s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpGt, Dec: "1.x"})
+	assert.ErrorIs(t, err, model.ErrInvalidDecimal)
+	_, err = s.Create(ctx, "interest0", model.Condition{Key: "k0", Op: model.OpCyclicRange})
+	assert.ErrorIs(t, err, model.ErrInvalidPeriod)
+}
+
+func TestStorageImpl_Create_SameAsMemory(t *testing.T) {
+	cases := map[string]struct {
+		a    model.Condition
+		b    model.Condition
+		same bool
+	}{
+		"range differs by unused val": {
+			a:    model.Condition{Key: "k0", Op: model.OpRange, Range: model.Range{Min: 1, Max: 2}},
+			b:    model.Condition{Key: "k0", Op: model.OpRange, Range: model.Range{Min: 1, Max: 2}, Val: 3},
+			same: true,
+		},
+		"in differs by unused val": {
+			a:    model.Condition{Key: "k0", Op: model.OpIn, Vals: []float64{1, 2}},
+			b:    model.Condition{Key: "k0", Op: model.OpIn, Vals: []float64{1, 2}, Val: 3},
+			same: true,
+		},
+		"gt with unused tolerance": {
+			a:    model.Condition{Key: "k0", Op: model.OpGt, Val: 5},
+			b:    model.Condition{Key: "k0", Op: model.OpGt, Val: 5, Tolerance: model.Tolerance{Abs: 1}},
+			same: true,
+		},
+		"same decimal": {
+			a:    model.Condition{Key: "k0", Op: model.OpGt, Dec: "5"},
+			b:    model.Condition{Key: "k0", Op: model.OpGt, Dec: "5.0"},
+			same: true,
+		},
+		"decimal and float": {
+			a:    model.Condition{Key: "k0", Op: model.OpGt, Dec: "5"},
+			b:    model.Condition{Key: "k0", Op: model.OpGt, Val: 5},
+			same: true,
+		},
+		"eq tolerance differs": {
+			a: model.Condition{Key: "k0", Op: model.OpEq, Val: 5, Tolerance: model.Tolerance{Abs: 1}},
+			b: model.Condition{Key: "k0", Op: model.OpEq, Val: 5},
+		},
+		"integer and float": {
+			a: model.Condition{Key: "k0", Op: model.OpGt, Int: ptr(int64(5))},
+			b: model.Condition{Key: "k0", Op: model.OpGt, Val: 5},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			ctx := context.TODO()
+			cfgDb := config.DbConfig{}
+			cfgDb.Table.State.Limit = 100
+			for _, s := range []storage.Storage{newTestStorage(t, time.Minute), memory.NewStorage(cfgDb, time.Now)} {
+				idA, err := s.Create(ctx, "interest0", c.a)
+				require.Nil(t, err)
+				idB, err := s.Create(ctx, "interest0", c.b)
+				require.Nil(t, err)
+				assert.Equal(t, c.same, idA == idB)
+			}
+		})
+	}
+}
+
+func TestStorageImpl_LockCreate(t *testing.T) {
+	s := newTestStorage(t, time.Minute)
+	ctx := context.TODO()
+	cond := model.Condition{Key: "k0", Op: model.OpGt, Val: 1}
+	id, err := s.Create(ctx, "interest0", cond)
+	require.Nil(t, err)
+	require.Nil(t, s.LockCreate(ctx, id))
+	_, err = s.Create(ctx, "interest1", cond)
+	assert.ErrorIs(t, err, storage.ErrConflict)
+	require.Nil(t, s.UnlockCreate(ctx, id))
+	require.Nil(t, s.UnlockCreate(ctx, id))
+	id1, err := s.Create(ctx, "interest1", cond)
+	require.Nil(t, err)
+	assert.Equal(t, id, id1)
+	//
+	assert.ErrorIs(t, s.LockCreate(ctx, "12345"), storage.ErrNotFound)
+	var errInvalid storage.InvalidError
+	assert.ErrorAs(t, s.LockCreate(ctx, "cond0"), &errInvalid)
+	assert.Equal(t, "id", errInvalid.Field)
+}
+
+func TestStorageImpl_LockCreate_Expired(t *testing.T) {
+	s := newTestStorage(t, time.Millisecond)
+	ctx := context.TODO()
+	cond := model.Condition{Key: "k0", Op: model.OpGt, Val: 1}
+	id, err := s.Create(ctx, "interest0", cond)
+	require.Nil(t, err)
+	require.Nil(t, s.LockCreate(ctx, id))
+	time.Sleep(10 * time.Millisecond)
+	id1, err := s.Create(ctx, "interest1", cond)
+	require.Nil(t, err)
+	assert.Equal(t, id, id1)
+}
+
+func TestStorageImpl_Delete(t *testing.T) {
+	s := newTestStorage(t, time.Minute)
+	ctx := context.TODO()
+	cond := model.Condition{
+		Terms: []model.Term{{Key: "a", Coef: 1}, {Key: "b", Coef: 1}},
+		Op:    model.OpGt,
+	}
+	id, err := s.Create(ctx, "interest0", cond)
+	require.Nil(t, err)
+	ids, err := s.SearchMultiPage(ctx, map[string]float64{"a": 1, "b": 1}, 10, "")
+	require.Nil(t, err)
+	assert.Equal(t, []string{id}, ids)
+	require.Nil(t, s.Delete(ctx, "interest0", id))
+	require.Nil(t, s.Delete(ctx, "interest0", id))
+	ids, err = s.SearchMultiPage(ctx, map[string]float64{"a": 1, "b": 1}, 10, "")
+	require.Nil(t, err)
+	assert.Empty(t, ids)
+	assert.ErrorIs(t, s.Delete(ctx, "interest0", ""), storage.ErrInvalid)
+}
+
+func TestStorageImpl_Delete_Shared(t *testing.T) {
+	s := newTestStorage(t, time.Minute)
+	ctx := context.TODO()
+	cond := model.Condition{Key: "price", Op: model.OpGt, Val: 10}
+	id1, err := s.Create(ctx, "interest1", cond)
+	require.Nil(t, err)
+	id2, err := s.Create(ctx, "interest2", cond)
+	require.Nil(t, err)
+	require.Equal(t, id1, id2)
+	_, err = s.Create(ctx, "interest2", cond)
+	require.Nil(t, err)
+	search := func() []string {
+		ids, _, err := s.SearchPage(ctx, model.Attr{Key: "price", Val: 11}, 10, "")
+		require.Nil(t, err)
+		return ids
+	}
+	require.Nil(t, s.Delete(ctx, "interest1", id1))
+	assert.Equal(t, []string{id1}, search())
+	require.Nil(t, s.Delete(ctx, "interest3", id1))
+	assert.Equal(t, []string{id1}, search())
+	require.Nil(t, s.Delete(ctx, "interest2", id1))
+	assert.Empty(t, search())
+}
+
+func TestStorageImpl_SearchPage(t *testing.T) {
+	s := newTestStorage(t, time.Minute)
+	ctx := context.TODO()
+	conds := map[string]model.Condition{
+		"gt": {
+			Key: "price",
+			Op:  model.OpGt,
+			Val: 10,
+		},
+		"gte": {
+			Key: "price",
+			Op:  model.OpGte,
+			Val: 20,
+		},
+		"lt": {
+			Key: "price",
+			Op:  model.OpLt,
+			Val: 20,
+		},
+		"lte dec": {
+			Key: "price",
+			Op:  model.OpLte,
+			Dec: "19.99",
+		},
+		"eq dec": {
+			Key: "price",
+			Op:  model.OpEq,
+			Dec: "20.0",
+		},
+		"eq tolerance": {
+			Key:       "price",
+			Op:        model.OpEq,
+			Val:       20.3,
+			Tolerance: model.Tolerance{Abs: 0.5},
+		},
+		"range": {
+			Key:   "price",
+			Op:    model.OpRange,
+			Range: model.Range{Min: 15, Max: 20, MaxInclusive: true},
+		},
+		"range max exclusive": {
+			Key:   "price",
+			Op:    model.OpRange,
+			Range: model.Range{Min: 15, Max: 20, MinInclusive: true},
+		},
+		"cyclic range": {
+			Key:    "price",
+			Op:     model.OpCyclicRange,
+			Range:  model.Range{Min: 22, Max: 27, MinInclusive: true},
+			Period: 6,
+		},
+		"in": {
+			Key:  "price",
+			Op:   model.OpIn,
+			Vals: []float64{20, 30},
+		},
+		"not gt": {
+			Key: "price",
+			Op:  model.OpGt,
+			Val: 25,
+			Not: true,
+		},
+		"other key": {
+			Key: "cost",
+			Op:  model.OpGt,
+		},
+		"unit": {
+			Key:  "price",
+			Op:   model.OpGt,
+			Unit: "EUR",
+		},
+		"key-less": {
+			Op:  model.OpLt,
+			Val: 100,
+		},
+		"prefix": {
+			Key:      "pri",
+			KeyMatch: model.KeyMatchPrefix,
+			Op:       model.OpGt,
+		},
+		"glob": {
+			Key:      "p*e",
+			KeyMatch: model.KeyMatchGlob,
+			Op:       model.OpGt,
+		},
+		"glob mismatch": {
+			Key:      "p*x",
+			KeyMatch: model.KeyMatchGlob,
+			Op:       model.OpGt,
+		},
+		"mod": {
+			Key: "price",
+			Op:  model.OpMod,
+			Mod: model.Mod{Div: 7, Rem: 6},
+		},
+		"cross-attribute": {
+			Terms: []model.Term{{Key: "price", Coef: 1}},
+			Op:    model.OpGt,
+		},
+	}
+	names := map[string]string{}
+	for name, cond := range conds {
+		id, err := s.Create(ctx, "interest0", cond)
+		require.Nil(t, err)
+		names[id] = name
+	}
+	var matched []string
+	var cursor string
+	for {
+		ids, _, err := s.SearchPage(ctx, model.Attr{Key: "price", Val: 20}, 3, cursor)
+		require.Nil(t, err)
+		assert.LessOrEqual(t, len(ids), 3)
+		for _, id := range ids {
+			matched = append(matched, names[id])
+		}
+		if len(ids) < 3 {
+			break
+		}
+		cursor = ids[len(ids)-1]
+	}
+	assert.ElementsMatch(t, []string{
+		"gt",
+		"gte",
+		"eq dec",
+		"eq tolerance",
+		"range",
+		"cyclic range",
+		"in",
+		"not gt",
+		"key-less",
+		"prefix",
+		"glob",
+		"mod",
+	}, matched)
+	// no limit
+	ids, _, err := s.SearchPage(ctx, model.Attr{Key: "price", Val: 20}, 0, "")
+	require.Nil(t, err)
+	assert.Len(t, ids, len(matched))
+	//
+	_, _, err = s.SearchPage(ctx, model.Attr{Key: "price", Val: 20}, 3, "cond0")
+	assert.ErrorIs(t, err, storage.ErrInvalid)
+}
+
+func TestStorageImpl_SearchPage_Stateful(t *testing.T) {
+	s := newTestStorage(t, time.Minute)
+	ctx := context.TODO()
+	idCross, err := s.Create(ctx, "interest0", model.Condition{Key: "cpu", Op: model.OpCrossAbove, Val: 90, Hysteresis: 5})
+	require.Nil(t, err)
+	idChange, err := s.Create(ctx, "interest0", model.Condition{Key: "cpu", Op: model.OpChange, Val: 20})
+	require.Nil(t, err)
+	steps := []struct {
+		val float64
+		ids []string
+	}{
+		{
+			val: 50,
+		},
+		{
+			val: 95,
+			ids: []string{idCross, idChange},
+		},
+		{
+			val: 96,
+		},
+		{
+			val: 80,
+		},
+		{
+			val: 91,
+			ids: []string{idCross},
+		},
+	}
+	for i, step := range steps {
+		ids, _, err := s.SearchPage(ctx, model.Attr{Key: "cpu", Val: step.val}, 10, "")
+		require.Nil(t, err)
+		assert.ElementsMatch(t, step.ids, ids, "step %d", i)
+	}
+}
+
+func TestStorageImpl_SearchPage_StatefulOps(t *testing.T) {
+	s := newTestStorage(t, time.Minute)
+	ctx := context.TODO()
+	idGt, err := s.Create(ctx, "interest0", model.Condition{Key: "cpu", Op: model.OpGt})
+	require.Nil(t, err)
+	// neither the previous value nor the statistics are kept without the change and the anomaly conditions
+	ids, stats, err := s.SearchPage(ctx, model.Attr{Key: "cpu", Val: 50}, 10, "")
+	require.Nil(t, err)
+	assert.Equal(t, []string{idGt}, ids)
+	assert.Zero(t, stats.Count)
+	_, err = s.Create(ctx, "interest0", model.Condition{Key: "cpu", Op: model.OpChange, Val: 20})
+	require.Nil(t, err)
+	_, err = s.Create(ctx, "interest0", model.Condition{Key: "cpu", Op: model.OpAnomaly, Val: 3})
+	require.Nil(t, err)
+	_, err = s.Create(ctx, "interest0", model.Condition{Key: "mem", Op: model.OpChange, Val: 20, Unit: "MiB"})
+	require.Nil(t, err)
+	ids, stats, err = s.SearchPage(ctx, model.Attr{Key: "cpu", Val: 95}, 10, "")
+	require.Nil(t, err)
+	assert.Equal(t, []string{idGt}, ids)
+	assert.Zero(t, stats.Count)
+	ids, stats, err = s.SearchPage(ctx, model.Attr{Key: "cpu", Val: 96}, 10, "")
+	require.Nil(t, err)
+	assert.Equal(t, []string{idGt}, ids)
+	assert.Equal(t, int64(1), stats.Count)
+	// the conditions of another unit don't keep the state
+	_, _, err = s.SearchPage(ctx, model.Attr{Key: "mem", Val: 10}, 10, "")
+	require.Nil(t, err)
+	ids, _, err = s.SearchPage(ctx, model.Attr{Key: "mem", Val: 100, Unit: "MiB"}, 10, "")
+	require.Nil(t, err)
+	assert.Empty(t, ids)
+}
+
+func TestStorageImpl_SearchMultiPage(t *testing.T) {
+	s := newTestStorage(t, time.Minute)
+	ctx := context.TODO()
+	idSpread, err := s.Create(ctx, "interest0", model.Condition{
+		Terms: []model.Term{{Key: "ask", Coef: 1}, {Key: "bid", Coef: -1}},
+		Op:    model.OpGt,
+		Val:   1,
+	})
+	require.Nil(t, err)
+	idSum, err := s.Create(ctx, "interest0", model.Condition{
+		Terms: []model.Term{{Key: "ask", Coef: 1}, {Key: "fee", Coef: 1}},
+		Op:    model.OpLt,
+		Val:   100,
+	})
+	require.Nil(t, err)
+	idAbsent, err := s.Create(ctx, "interest0", model.Condition{Key: "fee", Op: model.OpGt, Not: true})
+	require.Nil(t, err)
+	_, err = s.Create(ctx, "interest0", model.Condition{Key: "ask", Op: model.OpGt})
+	require.Nil(t, err)
+	ids, err := s.SearchMultiPage(ctx, map[string]float64{"ask": 10, "bid": 8}, 10, "")
+	require.Nil(t, err)
+	assert.Equal(t, []string{idSpread, idAbsent}, ids)
+	ids, err = s.SearchMultiPage(ctx, map[string]float64{"ask": 10, "bid": 8}, 1, idSpread)
+	require.Nil(t, err)
+	assert.Equal(t, []string{idAbsent}, ids)
+	ids, err = s.SearchMultiPage(ctx, map[string]float64{"ask": 10, "fee": 1}, 10, "")
+	require.Nil(t, err)
+	assert.Equal(t, []string{idSum}, ids)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
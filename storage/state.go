@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+	"github.com/awakari/conditions-number/model"
+	"time"
+)
+
+// State keeps the state of the stateful conditions between the searches.
+type State interface {
+
+	// Cross updates the state of the crossing condition (see model.Condition.Crossing) using the attribute value and
+	// reports whether the condition fires. The state is kept per condition, attribute key and attribute entity.
+	Cross(ctx context.Context, condId string, cond model.Condition, attr model.Attr) (fires bool, err error)
+
+	// Observe remembers the attribute value and returns the previous one when found. The values are kept per attribute
+	// key and entity.
+	Observe(ctx context.Context, attr model.Attr) (prev float64, found bool, err error)
+
+	// Previous returns the value preceding the last observed one for the attribute key and entity when found.
+	Previous(ctx context.Context, attr model.Attr) (prev float64, found bool, err error)
+
+	// Aggregate adds the attribute value observed at the specified time to the window of the windowed aggregate
+	// condition (see model.Window) when the value passes the window filter. Returns the aggregate of the window values
+	// if any. The window is kept per condition, attribute key and attribute entity.
+	Aggregate(ctx context.Context, condId string, cond model.Condition, attr model.Attr, t time.Time) (agg float64, ok bool, err error)
+
+	// Delete removes all the state of the condition.
+	Delete(ctx context.Context, condId string) (err error)
+}
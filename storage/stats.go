@@ -0,0 +1,17 @@
+package storage
+
+import (
+	"context"
+	"github.com/awakari/conditions-number/model"
+)
+
+// Stats keeps the running statistics of the attribute values for the anomaly conditions.
+type Stats interface {
+
+	// Update adds the attribute value to the statistics of the attribute key and entity and returns the statistics
+	// preceding the value.
+	Update(ctx context.Context, attr model.Attr) (prev model.Stats, err error)
+
+	// Get returns the statistics of the attribute key and entity preceding the last added value.
+	Get(ctx context.Context, attr model.Attr) (prev model.Stats, err error)
+}
@@ -3,17 +3,34 @@ package storage
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/awakari/conditions-number/model"
 	"io"
 )
 
 type Storage interface {
 	io.Closer
-	Create(ctx context.Context, interestId, k string, o model.Op, v float64) (id string, err error)
+	// Create returns the id of the new or the existing same condition and adds the interest reference to it.
+	Create(ctx context.Context, interestId string, cond model.Condition) (id string, err error)
 	LockCreate(ctx context.Context, id string) (err error)
 	UnlockCreate(ctx context.Context, id string) (err error)
+	// Delete removes the interest reference from the condition, the condition is deleted when no references remain.
 	Delete(ctx context.Context, interestId, id string) (err error)
-	SearchPage(ctx context.Context, key string, val float64, limit uint32, cursor string) (ids []string, err error)
+	// SearchPage returns the conditions matching the attribute and the attribute values statistics preceding the value.
+	// The first page (empty cursor) updates the state of the stateful conditions, the following pages reuse it.
+	// The zero limit means no limit, the same applies to SearchMultiPage.
+	SearchPage(ctx context.Context, attr model.Attr, limit uint32, cursor string) (ids []string, stats model.Stats, err error)
+	// SearchMultiPage returns the cross-attribute conditions holding for the attributes and the negated exact key
+	// conditions of the absent attributes.
+	SearchMultiPage(ctx context.Context, attrs map[string]float64, limit uint32, cursor string) (ids []string, err error)
+}
+
+// KeyMigration is implemented by the storage able to normalize the keys of the already stored conditions.
+type KeyMigration interface {
+	// NormalizeKeys updates the condition keys and the terms keys to the normalized ones, the state of the stateful
+	// conditions is moved to the normalized keys too. The condition becoming the same as another existing one is left
+	// as is and never matches anymore, returns the ids of such conditions to recreate them.
+	NormalizeKeys(ctx context.Context, norm model.KeyNorm) (updated int64, conflicts []string, err error)
 }
 
 var ErrInternal = errors.New("internal failure")
@@ -21,3 +38,22 @@ var ErrInternal = errors.New("internal failure")
 var ErrConflict = errors.New("already exists")
 
 var ErrNotFound = errors.New("not found")
+
+var ErrInvalid = errors.New("invalid argument")
+
+// InvalidError is ErrInvalid caused by the specified request field.
+type InvalidError struct {
+	Field string
+	Err   error
+}
+
+func (e InvalidError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", ErrInvalid, e.Field, e.Err)
+}
+
+func (e InvalidError) Unwrap() []error {
+	return []error{
+		ErrInvalid,
+		e.Err,
+	}
+}
@@ -9,6 +9,16 @@ import (
 type storageMock struct {
 }
 
+// condMockTolerance is the tolerant equality condition matched by the mock search of its key.
+var condMockTolerance = model.Condition{
+	Key: "tolerance",
+	Op:  model.OpEq,
+	Val: 0.3,
+	Tolerance: model.Tolerance{
+		Abs: 1e-9,
+	},
+}
+
 func NewStorageMock() Storage {
 	return storageMock{}
 }
@@ -17,14 +27,27 @@ func (sm storageMock) Close() error {
 	return nil
 }
 
-func (sm storageMock) Create(ctx context.Context, interestId, k string, o model.Op, v float64) (id string, err error) {
-	switch k {
-	case "fail":
-		err = ErrInternal
-	case "conflict":
-		err = ErrConflict
-	default:
-		id = "cond0"
+func (sm storageMock) Create(ctx context.Context, interestId string, cond model.Condition) (id string, err error) {
+	switch {
+	case cond.Op.IsBitwise():
+		_, err = cond.BitMask()
+	case cond.Op == model.OpMod:
+		err = cond.Mod.Validate()
+	case cond.Op == model.OpCyclicRange:
+		_, err = cond.CyclicRange()
+	}
+	if err == nil {
+		err = cond.ValidateNot()
+	}
+	if err == nil {
+		switch cond.Key {
+		case "fail":
+			err = ErrInternal
+		case "conflict":
+			err = ErrConflict
+		default:
+			id = "cond0"
+		}
 	}
 	return
 }
@@ -49,10 +72,34 @@ func (sm storageMock) Delete(ctx context.Context, interestId, id string) (err er
 	return
 }
 
-func (sm storageMock) SearchPage(ctx context.Context, key string, val float64, limit uint32, cursor string) (ids []string, err error) {
-	switch key {
+func (sm storageMock) SearchPage(ctx context.Context, attr model.Attr, limit uint32, cursor string) (ids []string, stats model.Stats, err error) {
+	switch attr.Key {
 	case "fail":
 		err = ErrInternal
+	case condMockTolerance.Key:
+		if limit > 0 && condMockTolerance.MatchesAttr(attr) {
+			ids = append(ids, "cond0")
+		}
+	case "latency":
+		stats = model.Stats{
+			Count: 2,
+			Mean:  2,
+			M2:    2,
+		}
+		fallthrough
+	default:
+		for i := uint32(0); i < limit; i++ {
+			ids = append(ids, fmt.Sprintf("cond%d", i))
+		}
+	}
+	return
+}
+
+func (sm storageMock) SearchMultiPage(ctx context.Context, attrs map[string]float64, limit uint32, cursor string) (ids []string, err error) {
+	_, fail := attrs["fail"]
+	switch fail {
+	case true:
+		err = ErrInternal
 	default:
 		for i := uint32(0); i < limit; i++ {
 			ids = append(ids, fmt.Sprintf("cond%d", i))
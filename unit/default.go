@@ -0,0 +1,57 @@
+package unit
+
+const DimLength = "length"
+const DimMass = "mass"
+const DimTemperature = "temperature"
+const DimTime = "time"
+const DimInformation = "information"
+
+var Defaults = []Unit{
+	// length
+	{Symbol: "m", Dimension: DimLength, Scale: 1},
+	{Symbol: "km", Dimension: DimLength, Scale: 1e3},
+	{Symbol: "cm", Dimension: DimLength, Scale: 1e-2},
+	{Symbol: "mm", Dimension: DimLength, Scale: 1e-3},
+	{Symbol: "in", Dimension: DimLength, Scale: 0.0254},
+	{Symbol: "ft", Dimension: DimLength, Scale: 0.3048},
+	{Symbol: "yd", Dimension: DimLength, Scale: 0.9144},
+	{Symbol: "mi", Dimension: DimLength, Scale: 1609.344},
+	// mass
+	{Symbol: "kg", Dimension: DimMass, Scale: 1},
+	{Symbol: "g", Dimension: DimMass, Scale: 1e-3},
+	{Symbol: "mg", Dimension: DimMass, Scale: 1e-6},
+	{Symbol: "t", Dimension: DimMass, Scale: 1e3},
+	{Symbol: "oz", Dimension: DimMass, Scale: 0.028349523125},
+	{Symbol: "lb", Dimension: DimMass, Scale: 0.45359237},
+	// temperature
+	{Symbol: "K", Dimension: DimTemperature, Scale: 1},
+	{Symbol: "°C", Dimension: DimTemperature, Scale: 1, Offset: 273.15},
+	{Symbol: "°F", Dimension: DimTemperature, Scale: 5.0 / 9, Offset: 273.15 - 32*5.0/9},
+	// time
+	{Symbol: "s", Dimension: DimTime, Scale: 1},
+	{Symbol: "ns", Dimension: DimTime, Scale: 1e-9},
+	{Symbol: "us", Dimension: DimTime, Scale: 1e-6},
+	{Symbol: "ms", Dimension: DimTime, Scale: 1e-3},
+	{Symbol: "min", Dimension: DimTime, Scale: 60},
+	{Symbol: "h", Dimension: DimTime, Scale: 3600},
+	{Symbol: "d", Dimension: DimTime, Scale: 86400},
+	// information
+	{Symbol: "B", Dimension: DimInformation, Scale: 1},
+	{Symbol: "bit", Dimension: DimInformation, Scale: 0.125},
+	{Symbol: "kB", Dimension: DimInformation, Scale: 1e3},
+	{Symbol: "MB", Dimension: DimInformation, Scale: 1e6},
+	{Symbol: "GB", Dimension: DimInformation, Scale: 1e9},
+	{Symbol: "TB", Dimension: DimInformation, Scale: 1e12},
+	{Symbol: "KiB", Dimension: DimInformation, Scale: 1 << 10},
+	{Symbol: "MiB", Dimension: DimInformation, Scale: 1 << 20},
+	{Symbol: "GiB", Dimension: DimInformation, Scale: 1 << 30},
+	{Symbol: "TiB", Dimension: DimInformation, Scale: 1 << 40},
+}
+
+func NewDefaultRegistry() Registry {
+	r, err := NewRegistry(Defaults...)
+	if err != nil {
+		panic(err) // defaults are consistent
+	}
+	return r
+}
@@ -0,0 +1,136 @@
+package unit
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Unit converts the value to the base unit of the dimension: base = v * Scale + Offset.
+type Unit struct {
+	Symbol    string
+	Dimension string
+	Scale     float64
+	Offset    float64
+}
+
+type Registry interface {
+
+	// Register adds the unit. The base unit (Scale = 1, Offset = 0) of the dimension should be registered first.
+	Register(u Unit) (err error)
+
+	// Normalize converts the value to the base unit of the same dimension and returns the base unit symbol.
+	Normalize(v float64, symbol string) (base float64, baseSymbol string, err error)
+
+	// Convert converts the value between the units of the same dimension.
+	Convert(v float64, from, to string) (dst float64, err error)
+
+	// Lookup returns the registered unit.
+	Lookup(symbol string) (u Unit, err error)
+}
+
+var ErrUnknown = errors.New("unknown unit")
+
+var ErrIncompatible = errors.New("incompatible unit dimensions")
+
+var ErrConflict = errors.New("unit already registered")
+
+var ErrInvalid = errors.New("invalid unit")
+
+type registry struct {
+	lock  sync.RWMutex
+	units map[string]Unit
+	bases map[string]string
+}
+
+func NewRegistry(units ...Unit) (r Registry, err error) {
+	reg := &registry{
+		units: map[string]Unit{},
+		bases: map[string]string{},
+	}
+	for _, u := range units {
+		err = reg.Register(u)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		r = reg
+	}
+	return
+}
+
+func (u Unit) IsBase() bool {
+	return u.Scale == 1 && u.Offset == 0
+}
+
+func (u Unit) ToBase(v float64) float64 {
+	return v*u.Scale + u.Offset
+}
+
+func (u Unit) FromBase(v float64) float64 {
+	return (v - u.Offset) / u.Scale
+}
+
+func (r *registry) Register(u Unit) (err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	_, exists := r.units[u.Symbol]
+	_, baseExists := r.bases[u.Dimension]
+	switch {
+	case u.Symbol == "":
+		err = fmt.Errorf("%w: empty symbol", ErrInvalid)
+	case u.Scale == 0:
+		err = fmt.Errorf("%w: zero scale, symbol=%s", ErrInvalid, u.Symbol)
+	case exists:
+		err = fmt.Errorf("%w: %s", ErrConflict, u.Symbol)
+	case u.IsBase() && baseExists:
+		err = fmt.Errorf("%w: base unit of %s is %s", ErrConflict, u.Dimension, r.bases[u.Dimension])
+	case !u.IsBase() && !baseExists:
+		err = fmt.Errorf("%w: no base unit for %s", ErrUnknown, u.Dimension)
+	default:
+		r.units[u.Symbol] = u
+		if u.IsBase() {
+			r.bases[u.Dimension] = u.Symbol
+		}
+	}
+	return
+}
+
+func (r *registry) Normalize(v float64, symbol string) (base float64, baseSymbol string, err error) {
+	var u Unit
+	u, err = r.Lookup(symbol)
+	if err == nil {
+		base = u.ToBase(v)
+		r.lock.RLock()
+		baseSymbol = r.bases[u.Dimension]
+		r.lock.RUnlock()
+	}
+	return
+}
+
+func (r *registry) Convert(v float64, from, to string) (dst float64, err error) {
+	var uFrom, uTo Unit
+	uFrom, err = r.Lookup(from)
+	if err == nil {
+		uTo, err = r.Lookup(to)
+	}
+	if err == nil && uFrom.Dimension != uTo.Dimension {
+		err = fmt.Errorf("%w: %s (%s) vs %s (%s)", ErrIncompatible, from, uFrom.Dimension, to, uTo.Dimension)
+	}
+	if err == nil {
+		dst = uTo.FromBase(uFrom.ToBase(v))
+	}
+	return
+}
+
+func (r *registry) Lookup(symbol string) (u Unit, err error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var found bool
+	u, found = r.units[symbol]
+	if !found {
+		err = fmt.Errorf("%w: %s", ErrUnknown, symbol)
+	}
+	return
+}
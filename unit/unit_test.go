@@ -0,0 +1,152 @@
+package unit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRegistry_Register(t *testing.T) {
+	r, err := NewRegistry(Unit{Symbol: "m", Dimension: DimLength, Scale: 1})
+	require.Nil(t, err)
+	cases := map[string]struct {
+		u   Unit
+		err error
+	}{
+		"ok": {
+			u: Unit{Symbol: "km", Dimension: DimLength, Scale: 1000},
+		},
+		"ok base": {
+			u: Unit{Symbol: "kg", Dimension: DimMass, Scale: 1},
+		},
+		"duplicate symbol": {
+			u:   Unit{Symbol: "m", Dimension: DimLength, Scale: 1},
+			err: ErrConflict,
+		},
+		"second base": {
+			u:   Unit{Symbol: "meter", Dimension: DimLength, Scale: 1},
+			err: ErrConflict,
+		},
+		"missing base": {
+			u:   Unit{Symbol: "ms", Dimension: DimTime, Scale: 1e-3},
+			err: ErrUnknown,
+		},
+		"zero scale": {
+			u:   Unit{Symbol: "x", Dimension: DimLength},
+			err: ErrInvalid,
+		},
+		"empty symbol": {
+			u:   Unit{Dimension: DimLength, Scale: 2},
+			err: ErrInvalid,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			err = r.Register(c.u)
+			assert.ErrorIs(t, err, c.err)
+		})
+	}
+}
+
+func TestRegistry_Normalize(t *testing.T) {
+	r := NewDefaultRegistry()
+	cases := map[string]struct {
+		v          float64
+		symbol     string
+		base       float64
+		baseSymbol string
+		err        error
+	}{
+		"km": {
+			v:          1.5,
+			symbol:     "km",
+			base:       1500,
+			baseSymbol: "m",
+		},
+		"base": {
+			v:          1.5,
+			symbol:     "m",
+			base:       1.5,
+			baseSymbol: "m",
+		},
+		"celsius": {
+			v:          20,
+			symbol:     "°C",
+			base:       293.15,
+			baseSymbol: "K",
+		},
+		"fahrenheit": {
+			v:          212,
+			symbol:     "°F",
+			base:       373.15,
+			baseSymbol: "K",
+		},
+		"MiB": {
+			v:          1,
+			symbol:     "MiB",
+			base:       1048576,
+			baseSymbol: "B",
+		},
+		"unknown": {
+			symbol: "parsec",
+			err:    ErrUnknown,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			base, baseSymbol, err := r.Normalize(c.v, c.symbol)
+			assert.InDelta(t, c.base, base, 1e-9)
+			assert.Equal(t, c.baseSymbol, baseSymbol)
+			assert.ErrorIs(t, err, c.err)
+		})
+	}
+}
+
+func TestRegistry_Convert(t *testing.T) {
+	r := NewDefaultRegistry()
+	cases := map[string]struct {
+		v    float64
+		from string
+		to   string
+		dst  float64
+		err  error
+	}{
+		"km to mi": {
+			v:    1.609344,
+			from: "km",
+			to:   "mi",
+			dst:  1,
+		},
+		"celsius to fahrenheit": {
+			v:    -40,
+			from: "°C",
+			to:   "°F",
+			dst:  -40,
+		},
+		"MB to MiB": {
+			v:    1048.576,
+			from: "MB",
+			to:   "MiB",
+			dst:  1000,
+		},
+		"incompatible": {
+			v:    1,
+			from: "km",
+			to:   "K",
+			err:  ErrIncompatible,
+		},
+		"unknown": {
+			v:    1,
+			from: "km",
+			to:   "parsec",
+			err:  ErrUnknown,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			dst, err := r.Convert(c.v, c.from, c.to)
+			assert.InDelta(t, c.dst, dst, 1e-9)
+			assert.ErrorIs(t, err, c.err)
+		})
+	}
+}